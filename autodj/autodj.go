@@ -0,0 +1,242 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package autodj keeps the queue of MPD from running out,
+// adding songs picked by strategies as it empties, and removing
+// the songs already played.
+package autodj
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/playcount"
+)
+
+const (
+	DefaultMinQueue   = 5
+	DefaultKeepPlayed = 10
+)
+
+// DJ tops up the queue on "playlist" and "player" idle events.
+// It assumes the queue is played in order, so it isn't of much
+// use in random mode.
+type DJ struct {
+	// Strategies are tried in order, until one has candidates
+	// left once the excluded songs are removed.
+	Strategies []Strategy
+	// MinQueue is the number of songs to keep after the current one.
+	MinQueue int
+	// KeepPlayed is the number of songs to keep before the current
+	// one. Negative values keep them all.
+	KeepPlayed int
+	// AvoidPlayedWithin leaves out the songs played recently,
+	// from the lastplayed sticker of the playcount package.
+	AvoidPlayedWithin time.Duration
+	Logger            *slog.Logger
+
+	c    *mpdclient.MPDClient
+	done chan struct{}
+}
+
+func New(c *mpdclient.MPDClient, strategies ...Strategy) *DJ {
+	return &DJ{
+		Strategies: strategies,
+		MinQueue:   DefaultMinQueue,
+		KeepPlayed: DefaultKeepPlayed,
+		Logger:     c.Logger,
+		c:          c,
+		done:       make(chan struct{}),
+	}
+}
+
+// Start tops up the queue, then keeps it topped up until Close is called.
+func (d *DJ) Start() error {
+	events := d.c.Idle("playlist", "player")
+	if err := d.Step(); err != nil {
+		events.Close()
+		return err
+	}
+	go func() {
+		defer events.Close()
+		for {
+			select {
+			case <-d.done:
+				return
+			case _, ok := <-events.Ch:
+				if !ok {
+					return
+				}
+			}
+			if err := d.Step(); err != nil {
+				d.Logger.Warn("auto-DJ step failed", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *DJ) Close() {
+	close(d.done)
+}
+
+// plan returns the number of songs to add at the end of a queue
+// of n songs, and the number of songs to remove at its start,
+// the current song being at position current.
+func plan(n, current, minQueue, keepPlayed int) (int, int) {
+	if current < 0 {
+		current = -1
+	}
+	add := minQueue - (n - current - 1)
+	if add < 0 {
+		add = 0
+	}
+	remove := 0
+	if keepPlayed >= 0 && current > keepPlayed {
+		remove = current - keepPlayed
+	}
+	return add, remove
+}
+
+// Step tops up and trims the queue once.
+func (d *DJ) Step() error {
+	state, err := d.c.PlayerState()
+	if err != nil {
+		return err
+	}
+	queue, err := d.c.Queue()
+	if err != nil {
+		return err
+	}
+	current := state.Song
+	if state.State == mpdclient.StateStop {
+		current = -1
+	}
+	add, remove := plan(len(queue), current, d.MinQueue, d.KeepPlayed)
+	if add == 0 && remove == 0 {
+		return nil
+	}
+
+	var cmds []string
+	added := 0
+	if add > 0 {
+		var song *mpdclient.Song
+		if current >= 0 && current < len(queue) {
+			song = &queue[current]
+		}
+		uris, err := d.pick(queue, song, add)
+		if err != nil {
+			return err
+		}
+		for _, uri := range uris {
+			cmd := mpdclient.Command{Name: "add", Args: []string{uri}}
+			cmds = append(cmds, cmd.String())
+		}
+		added = len(uris)
+	}
+	if remove > 0 {
+		cmds = append(cmds, fmt.Sprintf("delete 0:%d", remove))
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+	l := d.c.BeginCommandList()
+	for _, cmd := range cmds {
+		l.Cmd(cmd)
+	}
+	res := l.End()
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.MPDErr != nil {
+		return res.MPDErr
+	}
+	d.Logger.Debug("auto-DJ step", "added", added, "removed", remove)
+	return nil
+}
+
+// pick picks n songs not in the queue nor played recently.
+func (d *DJ) pick(queue []mpdclient.Song, current *mpdclient.Song, n int) ([]string, error) {
+	excluded := make(map[string]bool, len(queue))
+	for _, song := range queue {
+		excluded[song.File] = true
+	}
+	if d.AvoidPlayedWithin > 0 {
+		stickers, err := findStickers(d.c, playcount.StickerLastPlayed)
+		if err != nil {
+			return nil, err
+		}
+		since := time.Now().Add(-d.AvoidPlayedWithin).Unix()
+		for _, s := range stickers {
+			if lastPlayed, err := strconv.ParseInt(s.Value, 10, 64); err == nil && lastPlayed > since {
+				excluded[s.Uri] = true
+			}
+		}
+	}
+	for _, strategy := range d.Strategies {
+		candidates, err := strategy.Candidates(d.c, current)
+		if err != nil {
+			return nil, err
+		}
+		kept := candidates[:0]
+		for _, candidate := range candidates {
+			if !excluded[candidate.URI] && candidate.Weight > 0 && !strings.Contains(candidate.URI, "://") {
+				kept = append(kept, candidate)
+			}
+		}
+		if len(kept) > 0 {
+			return sample(kept, n, rand.Float64), nil
+		}
+	}
+	return nil, nil
+}
+
+// sample picks n distinct candidates at random, by weight,
+// with the method of Efraimidis and Spirakis.
+func sample(candidates []Candidate, n int, random func() float64) []string {
+	type keyed struct {
+		uri string
+		key float64
+	}
+	seen := make(map[string]bool, len(candidates))
+	keys := make([]keyed, 0, len(candidates))
+	for _, c := range candidates {
+		if seen[c.URI] {
+			continue
+		}
+		seen[c.URI] = true
+		keys = append(keys, keyed{c.URI, math.Pow(random(), 1/c.Weight)})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key > keys[j].key })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	uris := make([]string, len(keys))
+	for i, k := range keys {
+		uris[i] = k.uri
+	}
+	return uris
+}
@@ -0,0 +1,96 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package autodj
+
+import (
+	"testing"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		n, current, minQueue, keepPlayed int
+		add, remove                      int
+	}{
+		{0, -1, 5, 10, 5, 0},
+		{3, -1, 5, 10, 2, 0},
+		{10, 2, 5, 10, 0, 0},
+		{10, 6, 5, 10, 2, 0},
+		{20, 15, 5, 10, 1, 5},
+		{20, 15, 5, -1, 1, 0},
+	}
+	for _, test := range tests {
+		add, remove := plan(test.n, test.current, test.minQueue, test.keepPlayed)
+		if add != test.add || remove != test.remove {
+			t.Fatalf("%+v: got add %d, remove %d", test, add, remove)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	candidates := []Candidate{{"a", 1}, {"b", 100}, {"a", 1}, {"c", 1}}
+	values := []float64{0.9, 0.5, 0.1}
+	i := 0
+	random := func() float64 {
+		v := values[i%len(values)]
+		i++
+		return v
+	}
+	uris := sample(candidates, 2, random)
+	// b weighs much more: 0.5^(1/100) is close to 1
+	if len(uris) != 2 || uris[0] != "b" || uris[1] != "a" {
+		t.Fatalf("Unexpected sample %q", uris)
+	}
+	if uris := sample(candidates, 5, random); len(uris) != 3 {
+		t.Fatalf("Expected the %d distinct candidates, got %q", 3, uris)
+	}
+}
+
+type fixedStrategy []Candidate
+
+func (s fixedStrategy) Candidates(c *mpdclient.MPDClient, current *mpdclient.Song) ([]Candidate, error) {
+	return append([]Candidate(nil), s...), nil
+}
+
+func TestRatedWithoutStickers(t *testing.T) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// MPD fails when no song has the sticker
+	s.Fail("sticker", mpdclient.AckNoExist, "no such sticker")
+	c, err := mpdclient.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	r := &Rated{Strategy: fixedStrategy{{"a", 1}, {"b", 3}}, Sticker: "rating", Default: 2}
+	candidates, err := r.Candidates(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].Weight != 2 || candidates[1].Weight != 6 {
+		t.Fatalf("Unexpected candidates %+v", candidates)
+	}
+}
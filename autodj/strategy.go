@@ -0,0 +1,146 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package autodj
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// Candidate is a song a strategy may add to the queue.
+// Songs of higher weights are picked more often.
+type Candidate struct {
+	URI    string
+	Weight float64
+}
+
+// Strategy returns the songs to pick from, given the current song,
+// which is nil when there is none.
+type Strategy interface {
+	Candidates(c *mpdclient.MPDClient, current *mpdclient.Song) ([]Candidate, error)
+}
+
+// DefaultLibraryTTL is how long Library keeps the list of songs.
+const DefaultLibraryTTL = 10 * time.Minute
+
+// Library picks among all the songs of the database.
+type Library struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	uris    []string
+	fetched time.Time
+}
+
+func (l *Library) Candidates(c *mpdclient.MPDClient, current *mpdclient.Song) ([]Candidate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ttl := l.TTL
+	if ttl == 0 {
+		ttl = DefaultLibraryTTL
+	}
+	if l.uris == nil || time.Since(l.fetched) > ttl {
+		songs, err := c.ListAllInfo("")
+		if err != nil {
+			return nil, err
+		}
+		l.uris = make([]string, len(songs))
+		for i, song := range songs {
+			l.uris[i] = song.File
+		}
+		l.fetched = time.Now()
+	}
+	candidates := make([]Candidate, len(l.uris))
+	for i, uri := range l.uris {
+		candidates[i] = Candidate{uri, 1}
+	}
+	return candidates, nil
+}
+
+// SameTag picks among the songs sharing a tag with the current song.
+type SameTag struct {
+	Tag string
+}
+
+var (
+	SameArtist = &SameTag{"Artist"}
+	SameAlbum  = &SameTag{"Album"}
+)
+
+func (s *SameTag) Candidates(c *mpdclient.MPDClient, current *mpdclient.Song) ([]Candidate, error) {
+	if current == nil || current.Tag(s.Tag) == "" {
+		return nil, nil
+	}
+	songs, err := c.Find(mpdclient.Eq(s.Tag, current.Tag(s.Tag)))
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]Candidate, len(songs))
+	for i, song := range songs {
+		candidates[i] = Candidate{song.File, 1}
+	}
+	return candidates, nil
+}
+
+// Rated weights the candidates of a strategy by the numeric value
+// of a sticker, like a rating. Songs without it weigh Default.
+type Rated struct {
+	Strategy Strategy
+	Sticker  string
+	Default  float64
+}
+
+func (r *Rated) Candidates(c *mpdclient.MPDClient, current *mpdclient.Song) ([]Candidate, error) {
+	candidates, err := r.Strategy.Candidates(c, current)
+	if err != nil || len(candidates) == 0 {
+		return candidates, err
+	}
+	stickers, err := findStickers(c, r.Sticker)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]float64, len(stickers))
+	for _, s := range stickers {
+		if value, err := strconv.ParseFloat(s.Value, 64); err == nil {
+			values[s.Uri] = value
+		}
+	}
+	for i := range candidates {
+		value, ok := values[candidates[i].URI]
+		if !ok {
+			value = r.Default
+		}
+		candidates[i].Weight *= value
+	}
+	return candidates, nil
+}
+
+// findStickers returns the songs which have the sticker name.
+// MPD fails when no song has it at all, which gives no songs.
+func findStickers(c *mpdclient.MPDClient, name string) (mpdclient.SongStickerList, error) {
+	stickers, err := c.StickerFind(mpdclient.StickerSongType, "", name)
+	if mpdErr, ok := err.(*mpdclient.MPDError); ok && mpdErr.Ack == mpdclient.AckNoExist {
+		return nil, nil
+	}
+	return stickers, err
+}
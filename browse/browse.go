@@ -0,0 +1,312 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+// Package browse caches the artists, albums and tracks of the MPD
+// database, for the user interfaces browsing it. The cache is filled
+// on the first query with list and count commands, the tracks of each
+// album when they are first asked for, and it is emptied on "database"
+// idle events.
+//
+//	b := browse.New(mpdc)
+//	b.Watch()
+//	defer b.Close()
+//	artist, err := b.Artist("The Beatles")
+//	for _, album := range artist.Albums {
+//		tracks, err := b.Tracks(album)
+//		// ...
+//	}
+//
+// The entities returned are shared by all the callers, and must not
+// be modified.
+package browse
+
+import (
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// VariousArtists is the artist of the albums without album artist
+// whose tracks have several artists.
+const VariousArtists = "Various Artists"
+
+// Artist is an artist of the database.
+type Artist struct {
+	Name string `json:"name"`
+	// Albums are the albums of the artist as album artist.
+	Albums []*Album `json:"albums"`
+	// AppearsOn are the albums of other artists with tracks
+	// of the artist.
+	AppearsOn []*Album `json:"appears_on,omitempty"`
+	// Tracks and Duration are the number of tracks of Albums
+	// and their total duration.
+	Tracks   uint          `json:"tracks"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Album is an album of the database.
+type Album struct {
+	Name string `json:"name"`
+	// Artist is the album artist, falling back to the artist
+	// of the tracks, or VariousArtists if they have several.
+	Artist string `json:"artist"`
+	// Artists are the artists of the tracks.
+	Artists  []string      `json:"artists"`
+	Tracks   uint          `json:"tracks"`
+	Duration time.Duration `json:"duration"`
+
+	// fallback is set when the tracks have no album artist,
+	// and dirs are then the directories of the tracks.
+	fallback bool
+	dirs     map[string]bool
+}
+
+// Track is a song of an album.
+type Track struct {
+	File    string   `json:"file"`
+	Title   string   `json:"title"`
+	Artists []string `json:"artists"`
+	// Disc and Number are 0 when unknown.
+	Disc     int           `json:"disc"`
+	Number   int           `json:"number"`
+	Duration time.Duration `json:"duration"`
+}
+
+// albumKey identifies an album, as albums of different
+// artists may have the same name.
+type albumKey struct {
+	artist, name string
+}
+
+// library is the content of the cache at a time.
+type library struct {
+	artists []*Artist
+	byName  map[string]*Artist
+	albums  []*Album
+	byKey   map[albumKey]*Album
+
+	mu     sync.Mutex
+	tracks map[*Album][]*Track
+}
+
+// Cache is a cache of the database of a client.
+// It is safe for concurrent use.
+type Cache struct {
+	Logger *slog.Logger
+
+	c      *mpdclient.MPDClient
+	mu     sync.RWMutex
+	lib    *library
+	gen    int
+	loadMu sync.Mutex
+	done   chan struct{}
+	once   sync.Once
+}
+
+// New returns an empty cache of the database of c.
+func New(c *mpdclient.MPDClient) *Cache {
+	return &Cache{
+		Logger: slog.New(slog.DiscardHandler),
+		c:      c,
+		done:   make(chan struct{}),
+	}
+}
+
+// Artists returns all the artists, album artists and track
+// artists, sorted by name.
+func (b *Cache) Artists() ([]*Artist, error) {
+	lib, err := b.library()
+	if err != nil {
+		return nil, err
+	}
+	return lib.artists, nil
+}
+
+// Artist returns the artist with a name, or nil.
+func (b *Cache) Artist(name string) (*Artist, error) {
+	lib, err := b.library()
+	if err != nil {
+		return nil, err
+	}
+	return lib.byName[name], nil
+}
+
+// Albums returns all the albums, sorted by artist and name.
+func (b *Cache) Albums() ([]*Album, error) {
+	lib, err := b.library()
+	if err != nil {
+		return nil, err
+	}
+	return lib.albums, nil
+}
+
+// Album returns the album of an artist with a name, or nil.
+func (b *Cache) Album(artist, name string) (*Album, error) {
+	lib, err := b.library()
+	if err != nil {
+		return nil, err
+	}
+	return lib.byKey[albumKey{artist, name}], nil
+}
+
+// Tracks returns the tracks of an album, sorted by disc and number.
+func (b *Cache) Tracks(album *Album) ([]*Track, error) {
+	lib, err := b.library()
+	if err != nil {
+		return nil, err
+	}
+	lib.mu.Lock()
+	tracks, ok := lib.tracks[album]
+	lib.mu.Unlock()
+	if ok {
+		return tracks, nil
+	}
+	tracks, err = b.fetchTracks(album)
+	if err != nil {
+		return nil, err
+	}
+	// Albums of a library invalidated since are not cached.
+	if lib.byKey[albumKey{album.Artist, album.Name}] == album {
+		lib.mu.Lock()
+		lib.tracks[album] = tracks
+		lib.mu.Unlock()
+	}
+	return tracks, nil
+}
+
+// filter returns the filter of the songs of an album.
+func (a *Album) filter() mpdclient.Filter {
+	switch {
+	case !a.fallback:
+		return mpdclient.And(mpdclient.Eq("Album", a.Name), mpdclient.Eq("AlbumArtist", a.Artist))
+	case a.Artist != VariousArtists:
+		return mpdclient.And(mpdclient.Eq("Album", a.Name), mpdclient.Eq("Artist", a.Artist))
+	}
+	return mpdclient.Eq("Album", a.Name)
+}
+
+func (b *Cache) fetchTracks(album *Album) ([]*Track, error) {
+	songs, err := b.c.Find(album.filter())
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]*Track, 0, len(songs))
+	for _, song := range songs {
+		if album.fallback && (song.AlbumArtist != "" || !album.dirs[path.Dir(song.File)]) {
+			continue
+		}
+		tracks = append(tracks, &Track{
+			File:     song.File,
+			Title:    song.Title,
+			Artists:  song.Tags["Artist"],
+			Disc:     number(song.Disc),
+			Number:   number(song.Track),
+			Duration: song.Duration,
+		})
+	}
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if tracks[i].Disc != tracks[j].Disc {
+			return tracks[i].Disc < tracks[j].Disc
+		}
+		if tracks[i].Number != tracks[j].Number {
+			return tracks[i].Number < tracks[j].Number
+		}
+		return tracks[i].File < tracks[j].File
+	})
+	return tracks, nil
+}
+
+// number parses track and disc numbers such as "3" or "3/12".
+func number(s string) int {
+	s, _, _ = strings.Cut(s, "/")
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+// Invalidate empties the cache. It is filled again
+// on the next query.
+func (b *Cache) Invalidate() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lib = nil
+	b.gen++
+}
+
+// Watch invalidates the cache each time a "database" idle event
+// occurs, until Close is called.
+func (b *Cache) Watch() {
+	events := b.c.Idle("database")
+	go func() {
+		defer events.Close()
+		for {
+			select {
+			case <-b.done:
+				return
+			case <-events.Ch:
+				b.Logger.Debug("database changed")
+				b.Invalidate()
+			}
+		}
+	}()
+}
+
+// Close stops watching the database.
+func (b *Cache) Close() {
+	b.once.Do(func() {
+		close(b.done)
+	})
+}
+
+// library returns the cached library, loading it if needed.
+func (b *Cache) library() (*library, error) {
+	b.mu.RLock()
+	lib := b.lib
+	b.mu.RUnlock()
+	if lib != nil {
+		return lib, nil
+	}
+
+	// Only one query loads the library, the others wait for it.
+	b.loadMu.Lock()
+	defer b.loadMu.Unlock()
+	b.mu.RLock()
+	lib, gen := b.lib, b.gen
+	b.mu.RUnlock()
+	if lib != nil {
+		return lib, nil
+	}
+	start := time.Now()
+	lib, err := load(b.c)
+	if err != nil {
+		return nil, err
+	}
+	b.Logger.Info("library loaded", "artists", len(lib.artists), "albums", len(lib.albums), "duration", time.Since(start))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Don't keep a library the database changed under.
+	if b.gen == gen {
+		b.lib = lib
+	}
+	return lib, nil
+}
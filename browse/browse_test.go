@@ -0,0 +1,235 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package browse
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+var responses = map[string]string{
+	`list "Album" "group" "AlbumArtist"`: "AlbumArtist: The Beatles\nAlbum: Abbey Road\nAlbum: Let It Be\n" +
+		"AlbumArtist: Queen\nAlbum: Greatest Hits\nAlbumArtist: ABBA\nAlbum: Greatest Hits\n" +
+		"AlbumArtist: \nAlbum: Mixtape\nAlbum: Solo Record",
+	`list "Artist" "group" "AlbumArtist" "group" "Album"`: "AlbumArtist: The Beatles\nAlbum: Abbey Road\nArtist: The Beatles\n" +
+		"Album: Let It Be\nArtist: Billy Preston\nArtist: The Beatles\n" +
+		"AlbumArtist: Queen\nAlbum: Greatest Hits\nArtist: Queen\nAlbumArtist: ABBA\nAlbum: Greatest Hits\nArtist: ABBA\n" +
+		"AlbumArtist: \nAlbum: Mixtape\nArtist: A\nArtist: B\nAlbum: Solo Record\nArtist: C",
+	`count "group" "Album"`: "Album: Abbey Road\nsongs: 17\nplaytime: 2832\nAlbum: Greatest Hits\nsongs: 36\nplaytime: 7200\n" +
+		"Album: Let It Be\nsongs: 12\nplaytime: 2100\nAlbum: Mixtape\nsongs: 2\nplaytime: 400\nAlbum: Solo Record\nsongs: 1\nplaytime: 200",
+	`count "((Album == 'Greatest Hits') AND (AlbumArtist == 'Queen'))" "group" "Album"`: "Album: Greatest Hits\nsongs: 17\nplaytime: 3500",
+	`count "((Album == 'Greatest Hits') AND (AlbumArtist == 'ABBA'))" "group" "Album"`:  "Album: Greatest Hits\nsongs: 19\nplaytime: 3700",
+	`find "((Album == 'Abbey Road') AND (AlbumArtist == 'The Beatles'))"`: "file: b.ogg\nTitle: Something\nArtist: The Beatles\nTrack: 2/17\n" +
+		"file: a.ogg\nTitle: Come Together\nArtist: The Beatles\nTrack: 1/17\nduration: 259.000",
+	`find "(Album == 'Mixtape')"`: "file: m1.ogg\nTitle: One\nArtist: A\n" +
+		"file: m2.ogg\nTitle: Two\nArtist: B\nDisc: 1\n" +
+		"file: other.ogg\nTitle: Other\nArtist: D\nAlbumArtist: D",
+	`find "(Album == 'Solo Record')"`: "file: c/solo.ogg\nTitle: Solo\nArtist: C\nduration: 200.000",
+}
+
+// newCache returns a cache of a fake server,
+// and the number of lists it received.
+func newCache(t *testing.T) (*Cache, *mpdtest.Server, *atomic.Int32) {
+	return newCacheOf(t, responses)
+}
+
+// newCacheOf returns a cache of a fake server answering
+// with responses.
+func newCacheOf(t *testing.T, responses map[string]string) (*Cache, *mpdtest.Server, *atomic.Int32) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	lists := new(atomic.Int32)
+	handler := func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		if r.Name == "list" {
+			lists.Add(1)
+		}
+		data, ok := responses[r.Command.String()]
+		if !ok {
+			return mpdserver.Errorf(mpdclient.AckArg, "unexpected %s", r.Command.String())
+		}
+		for _, line := range strings.Split(data, "\n") {
+			w.Line(line)
+		}
+		return nil
+	}
+	for _, cmd := range []string{"list", "count", "find"} {
+		s.Handle(cmd, handler)
+	}
+	c, err := mpdclient.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return New(c), s, lists
+}
+
+func names[T any](values []T, name func(T) string) string {
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = name(v)
+	}
+	return strings.Join(names, ", ")
+}
+
+func artistName(a *Artist) string { return a.Name }
+
+func albumName(a *Album) string { return a.Artist + "/" + a.Name }
+
+func TestBrowse(t *testing.T) {
+	b, _, _ := newCache(t)
+	artists, err := b.Artists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := names(artists, artistName); s != "A, ABBA, B, Billy Preston, C, Queen, The Beatles, Various Artists" {
+		t.Errorf("Unexpected artists %s", s)
+	}
+	albums, err := b.Albums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := names(albums, albumName); s != "ABBA/Greatest Hits, C/Solo Record, Queen/Greatest Hits, The Beatles/Abbey Road, The Beatles/Let It Be, Various Artists/Mixtape" {
+		t.Errorf("Unexpected albums %s", s)
+	}
+
+	beatles, err := b.Artist("The Beatles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if beatles.Tracks != 29 || beatles.Duration != 4932*time.Second || names(beatles.Albums, albumName) != "The Beatles/Abbey Road, The Beatles/Let It Be" {
+		t.Errorf("Unexpected artist %+v", beatles)
+	}
+	preston, _ := b.Artist("Billy Preston")
+	if len(preston.Albums) != 0 || names(preston.AppearsOn, albumName) != "The Beatles/Let It Be" {
+		t.Errorf("Unexpected artist %+v", preston)
+	}
+	queen, _ := b.Album("Queen", "Greatest Hits")
+	abba, _ := b.Album("ABBA", "Greatest Hits")
+	if queen.Tracks != 17 || abba.Tracks != 19 || abba.Duration != 3700*time.Second {
+		t.Errorf("Unexpected counts of the albums of the same name %+v %+v", queen, abba)
+	}
+	mixtape, _ := b.Album(VariousArtists, "Mixtape")
+	if mixtape == nil || strings.Join(mixtape.Artists, ",") != "A,B" || mixtape.Tracks != 2 {
+		t.Fatalf("Unexpected fallback album %+v", mixtape)
+	}
+	if album, _ := b.Album("Nobody", "Nothing"); album != nil {
+		t.Errorf("Expected no album, got %+v", album)
+	}
+
+	abbeyRoad, _ := b.Album("The Beatles", "Abbey Road")
+	tracks, err := b.Tracks(abbeyRoad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 || tracks[0].Title != "Come Together" || tracks[0].Number != 1 || tracks[0].Duration != 259*time.Second {
+		t.Errorf("Unexpected tracks %+v", tracks)
+	}
+	tracks, err = b.Tracks(mixtape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 || tracks[0].File != "m1.ogg" || tracks[1].Disc != 1 {
+		t.Errorf("Unexpected tracks %+v", tracks)
+	}
+}
+
+func TestFallbackAlbumsOfTheSameName(t *testing.T) {
+	b, _, _ := newCacheOf(t, map[string]string{
+		`list "Album" "group" "AlbumArtist"`:                  "AlbumArtist: \nAlbum: Greatest Hits",
+		`list "Artist" "group" "AlbumArtist" "group" "Album"`: "AlbumArtist: \nAlbum: Greatest Hits\nArtist: Queen\nArtist: ABBA",
+		`count "group" "Album"`:                               "Album: Greatest Hits\nsongs: 3\nplaytime: 600",
+		`find "(Album == 'Greatest Hits')"`: "file: Queen/Greatest Hits/1.ogg\nArtist: Queen\nduration: 100.000\n" +
+			"file: Queen/Greatest Hits/2.ogg\nArtist: Queen\nduration: 200.000\n" +
+			"file: ABBA/Greatest Hits/1.ogg\nArtist: ABBA\nduration: 300.000",
+		`find "((Album == 'Greatest Hits') AND (Artist == 'Queen'))"`: "file: Queen/Greatest Hits/2.ogg\nArtist: Queen\nTrack: 2\n" +
+			"file: Queen/Greatest Hits/1.ogg\nArtist: Queen\nTrack: 1",
+	})
+	albums, err := b.Albums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := names(albums, albumName); s != "ABBA/Greatest Hits, Queen/Greatest Hits" {
+		t.Fatalf("Unexpected albums %s", s)
+	}
+	queen, _ := b.Album("Queen", "Greatest Hits")
+	abba, _ := b.Album("ABBA", "Greatest Hits")
+	if queen.Tracks != 2 || queen.Duration != 300*time.Second || abba.Tracks != 1 || strings.Join(queen.Artists, ",") != "Queen" {
+		t.Errorf("Unexpected albums %+v %+v", queen, abba)
+	}
+	tracks, err := b.Tracks(queen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 || tracks[0].Number != 1 {
+		t.Errorf("Unexpected tracks %+v", tracks)
+	}
+}
+
+func TestCache(t *testing.T) {
+	b, s, lists := newCache(t)
+	// Each load lists the albums and the artists.
+	loads := func() int { return int(lists.Load()) / 2 }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			album, err := b.Album("The Beatles", "Abbey Road")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := b.Tracks(album); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := loads(); n != 1 {
+		t.Fatalf("Expected one load, got %d", n)
+	}
+
+	b.Watch()
+	defer b.Close()
+	s.Notify("database")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := b.Artists(); err != nil {
+			t.Fatal(err)
+		}
+		if loads() == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the cache to be invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
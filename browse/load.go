@@ -0,0 +1,252 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package browse
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// load fetches the artists and albums of the database of c.
+func load(c *mpdclient.MPDClient) (*library, error) {
+	lib := &library{
+		byName: make(map[string]*Artist),
+		byKey:  make(map[albumKey]*Album),
+		tracks: make(map[*Album][]*Track),
+	}
+
+	// The albums by album artist. MPD falls back to the artist
+	// for the songs without album artist, older versions list
+	// them without one.
+	rows, err := c.List("Album", mpdclient.Filter{}, "AlbumArtist")
+	if err != nil {
+		return nil, err
+	}
+	noAlbumArtist := make(map[string]bool)
+	for _, row := range rows {
+		name, artist := row["Album"], row["AlbumArtist"]
+		if name == "" {
+			continue
+		}
+		if artist == "" {
+			noAlbumArtist[name] = true
+			continue
+		}
+		lib.addAlbum(artist, name, false)
+	}
+
+	// The artists of the tracks of the albums.
+	rows, err = c.List("Artist", mpdclient.Filter{}, "AlbumArtist", "Album")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		name, artist, albumArtist := row["Album"], row["Artist"], row["AlbumArtist"]
+		if name == "" || artist == "" || albumArtist == "" {
+			continue
+		}
+		if album := lib.byKey[albumKey{albumArtist, name}]; album != nil {
+			album.Artists = append(album.Artists, artist)
+		}
+	}
+	names := make([]string, 0, len(noAlbumArtist))
+	for name := range noAlbumArtist {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := lib.addFallbackAlbums(c, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := lib.count(c); err != nil {
+		return nil, err
+	}
+
+	for _, album := range lib.albums {
+		artist := lib.artist(album.Artist)
+		artist.Albums = append(artist.Albums, album)
+		artist.Tracks += album.Tracks
+		artist.Duration += album.Duration
+		for _, name := range album.Artists {
+			if name != album.Artist {
+				a := lib.artist(name)
+				a.AppearsOn = append(a.AppearsOn, album)
+			}
+		}
+	}
+	sort.Slice(lib.albums, func(i, j int) bool {
+		a, b := lib.albums[i], lib.albums[j]
+		if a.Artist != b.Artist {
+			return less(a.Artist, b.Artist)
+		}
+		return less(a.Name, b.Name)
+	})
+	sort.Slice(lib.artists, func(i, j int) bool {
+		return less(lib.artists[i].Name, lib.artists[j].Name)
+	})
+	for _, artist := range lib.artists {
+		for _, albums := range [][]*Album{artist.Albums, artist.AppearsOn} {
+			sort.Slice(albums, func(i, j int) bool {
+				return less(albums[i].Name, albums[j].Name)
+			})
+		}
+	}
+	return lib, nil
+}
+
+// addFallbackAlbums adds the albums named name of the tracks without
+// album artist, counting their tracks. The tracks of a directory make
+// an album, so that the albums of different artists with the same
+// name stay apart.
+func (lib *library) addFallbackAlbums(c *mpdclient.MPDClient, name string) error {
+	songs, err := c.Find(mpdclient.Eq("Album", name))
+	if err != nil {
+		return err
+	}
+	var dirs []string
+	byDir := make(map[string][]mpdclient.Song)
+	for _, song := range songs {
+		if song.AlbumArtist != "" {
+			continue
+		}
+		dir := path.Dir(song.File)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], song)
+	}
+	for _, dir := range dirs {
+		var artists []string
+		seen := make(map[string]bool)
+		for _, song := range byDir[dir] {
+			for _, artist := range song.Tags["Artist"] {
+				if !seen[artist] {
+					seen[artist] = true
+					artists = append(artists, artist)
+				}
+			}
+		}
+		if len(artists) == 0 {
+			continue
+		}
+		albumArtist := artists[0]
+		if len(artists) > 1 {
+			albumArtist = VariousArtists
+		}
+		album := lib.addAlbum(albumArtist, name, true)
+		if !album.fallback {
+			continue
+		}
+		album.dirs[dir] = true
+		for _, artist := range artists {
+			if !contains(album.Artists, artist) {
+				album.Artists = append(album.Artists, artist)
+			}
+		}
+		for _, song := range byDir[dir] {
+			album.Tracks++
+			album.Duration += song.Duration
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// count sets the number of tracks and the duration of the albums.
+// The albums with a name of their own are counted at once, the
+// others one by one. The fallback albums are counted already.
+func (lib *library) count(c *mpdclient.MPDClient) error {
+	byName := make(map[string][]*Album)
+	for _, album := range lib.albums {
+		byName[album.Name] = append(byName[album.Name], album)
+	}
+	counts, err := c.CountGroup(mpdclient.Filter{}, "Album")
+	if err != nil {
+		return err
+	}
+	for _, count := range counts {
+		if albums := byName[count.Value]; len(albums) == 1 && !albums[0].fallback {
+			albums[0].Tracks, albums[0].Duration = count.Songs, count.Playtime
+		}
+	}
+	for _, albums := range byName {
+		if len(albums) == 1 {
+			continue
+		}
+		for _, album := range albums {
+			if album.fallback {
+				continue
+			}
+			counts, err := c.CountGroup(album.filter(), "Album")
+			if err != nil {
+				return err
+			}
+			for _, count := range counts {
+				album.Tracks += count.Songs
+				album.Duration += count.Playtime
+			}
+		}
+	}
+	return nil
+}
+
+func (lib *library) addAlbum(artist, name string, fallback bool) *Album {
+	key := albumKey{artist, name}
+	if album, ok := lib.byKey[key]; ok {
+		return album
+	}
+	album := &Album{Name: name, Artist: artist, fallback: fallback}
+	if fallback {
+		album.dirs = make(map[string]bool)
+	}
+	lib.byKey[key] = album
+	lib.albums = append(lib.albums, album)
+	return album
+}
+
+func (lib *library) artist(name string) *Artist {
+	if artist, ok := lib.byName[name]; ok {
+		return artist
+	}
+	artist := &Artist{Name: name}
+	lib.byName[name] = artist
+	lib.artists = append(lib.artists, artist)
+	return artist
+}
+
+// less orders names regardless of case.
+func less(a, b string) bool {
+	if la, lb := strings.ToLower(a), strings.ToLower(b); la != lb {
+		return la < lb
+	}
+	return a < b
+}
@@ -0,0 +1,93 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"fmt"
+)
+
+// Feature is a command, or a form of a command,
+// which not all the versions of MPD support.
+type Feature string
+
+const (
+	FeatureFilterExpressions   Feature = "filter expressions"
+	FeatureAddedSince          Feature = "added-since filter"
+	FeatureTagTypesToggle      Feature = "tagtypes disable/enable/clear/all"
+	FeatureTagTypesReset       Feature = "tagtypes available/reset"
+	FeatureProtocol            Feature = "protocol"
+	FeatureBinaryLimit         Feature = "binarylimit"
+	FeatureSingleOneshot       Feature = "single oneshot"
+	FeatureConsumeOneshot      Feature = "consume oneshot"
+	FeatureStickerInc          Feature = "sticker inc"
+	FeaturePlaylistAddPosition Feature = "playlistadd position"
+	FeatureAlbumArt            Feature = "albumart"
+	FeatureReadPicture         Feature = "readpicture"
+	FeatureGetVol              Feature = "getvol"
+	FeatureMounts              Feature = "mount"
+	FeatureNeighbors           Feature = "listneighbors"
+)
+
+// Capabilities maps the features to the first protocol version supporting them.
+var Capabilities = map[Feature]Version{
+	FeatureFilterExpressions:   {0, 21, 0},
+	FeatureAddedSince:          {0, 24, 0},
+	FeatureTagTypesToggle:      {0, 21, 0},
+	FeatureTagTypesReset:       {0, 24, 0},
+	FeatureProtocol:            {0, 24, 0},
+	FeatureBinaryLimit:         {0, 22, 4},
+	FeatureSingleOneshot:       {0, 21, 0},
+	FeatureConsumeOneshot:      {0, 24, 0},
+	FeatureStickerInc:          {0, 24, 0},
+	FeaturePlaylistAddPosition: {0, 23, 3},
+	FeatureAlbumArt:            {0, 21, 0},
+	FeatureReadPicture:         {0, 22, 0},
+	FeatureGetVol:              {0, 23, 0},
+	FeatureMounts:              {0, 19, 0},
+	FeatureNeighbors:           {0, 19, 0},
+}
+
+// ErrUnsupported is returned by the methods which need
+// a feature the MPD server doesn't support. Nothing is
+// sent to the server then.
+type ErrUnsupported struct {
+	Feature  Feature
+	Required Version
+	Server   Version
+}
+
+func (e *ErrUnsupported) Error() string {
+	return fmt.Sprintf("%s needs MPD protocol %s, server has %s", e.Feature, e.Required, e.Server)
+}
+
+// Supports reports whether the server supports f.
+// Unknown features are assumed to be supported.
+func (c *MPDClient) Supports(f Feature) bool {
+	required, ok := Capabilities[f]
+	return !ok || c.ProtocolVersion.AtLeast(required)
+}
+
+// require returns an *ErrUnsupported if the server doesn't support f.
+func (c *MPDClient) require(f Feature) error {
+	if c.Supports(f) {
+		return nil
+	}
+	return &ErrUnsupported{f, Capabilities[f], c.ProtocolVersion}
+}
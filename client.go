@@ -20,10 +20,13 @@
 package mpdclient
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/textproto"
 	"regexp"
 	"strconv"
@@ -32,11 +35,10 @@ import (
 	"time"
 )
 
-const network = "tcp"
-const Debug = false
+const defaultNetwork = "tcp"
 
 var responseRegexp = regexp.MustCompile(`(\w+): (.+)`)
-var mpdErrorRegexp = regexp.MustCompile(`ACK \[(\d+)@(\d+)\] {(\w+)} (.+)`)
+var mpdErrorRegexp = regexp.MustCompile(`ACK \[(\d+)@(\d+)\] {(\w*)} (.+)`)
 var mpdVersionRegexp = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
 
 type Info map[string]string
@@ -84,8 +86,26 @@ type MPDClient struct {
 	subscriptionConn *textproto.Conn
 	pingLoopCh       chan bool
 	idle             *idleState
+	idleCmdMu        sync.Mutex
 	idleListeners    []*idleListener
-	Logger           *log.Logger
+	listenersMu      sync.Mutex
+	interceptor      Interceptor
+	lostCh           chan struct{}
+	lostOnce         sync.Once
+	lostErr          error
+	// binaryLimit is the size of the largest binary chunk
+	// accepted on conn.
+	binaryLimit int
+	// messages are the messages read for other channels
+	// by ReadChannelMessages, not read by ReadMessages yet.
+	messages   []ChannelMessage
+	messagesMu sync.Mutex
+	// heartbeatWatchers counts the heartbeat watchers of the client,
+	// which subscribed to HeartbeatChannel if heartbeatSubscribed.
+	heartbeatMu         sync.Mutex
+	heartbeatWatchers   int
+	heartbeatSubscribed bool
+	Logger              *slog.Logger
 }
 
 type Version struct {
@@ -94,14 +114,52 @@ type Version struct {
 	Revision uint
 }
 
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Revision)
+}
+
+// AtLeast reports whether v is the same as or newer than other.
+func (v Version) AtLeast(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Revision >= other.Revision
+}
+
 type request uint
 
-type response struct {
+// Response is the response to a command: its lines without
+// the final OK, or the error that occurred.
+// Binary holds the binary data of commands like albumart.
+// ListOK holds, for each command of a command list that succeeded,
+// the number of lines of Data up to the end of its response.
+type Response struct {
 	Data   []string
+	Binary []byte
+	ListOK []int
 	Err    error
 	MPDErr *MPDError
 }
 
+// ACK error codes of MPDError.
+const (
+	AckNotList       = 1
+	AckArg           = 2
+	AckPassword      = 3
+	AckPermission    = 4
+	AckUnknown       = 5
+	AckNoExist       = 50
+	AckPlaylistMax   = 51
+	AckSystem        = 52
+	AckPlaylistLoad  = 53
+	AckUpdateAlready = 54
+	AckPlayerSync    = 55
+	AckExist         = 56
+)
+
 type MPDError struct {
 	Ack            uint
 	CommandListNum uint
@@ -113,25 +171,41 @@ func (me MPDError) Error() string {
 	return fmt.Sprintf("%d@%d %s: %s", me.Ack, me.CommandListNum, me.CurrentCommand, me.MessageText)
 }
 
-func (c *MPDClient) pingLoop() {
+// Line returns the error as MPD sends it.
+func (me MPDError) Line() string {
+	return fmt.Sprintf("ACK [%d@%d] {%s} %s", me.Ack, me.CommandListNum, me.CurrentCommand, me.MessageText)
+}
+
+func (c *MPDClient) pingLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-c.pingLoopCh:
 			return
-		case <-time.After(15 * time.Second):
-			time.Sleep(15 * time.Second)
+		case <-ticker.C:
 			err := c.Ping()
 			if err != nil {
-				c.Logger.Println(err)
+				c.Logger.Warn("ping failed", "error", err)
+				if _, ok := err.(*MPDError); !ok {
+					c.lose(err)
+					return
+				}
 			} else {
-				c.Logger.Println("PING OK")
+				c.Logger.Debug("ping ok")
 			}
 		}
 	}
 }
 
-func processConnData(conn *textproto.Conn) response {
-	res := response{Data: make([]string, 0)}
+// maxBinaryChunk bounds the binary chunks read from servers
+// whose limit wasn't set with WithBinaryLimit.
+const maxBinaryChunk = 1 << 24
+
+// processConnData reads a response from conn, failing on binary
+// chunks larger than limit.
+func processConnData(conn *textproto.Conn, limit int) Response {
+	res := Response{Data: make([]string, 0)}
 	for {
 		line, err := conn.ReadLine()
 		if err != nil {
@@ -141,6 +215,31 @@ func processConnData(conn *textproto.Conn) response {
 		if line == "OK" {
 			break
 		}
+		// Separates the responses of the commands of a list
+		if line == "list_OK" {
+			res.ListOK = append(res.ListOK, len(res.Data))
+			continue
+		}
+		if strings.HasPrefix(line, "binary: ") {
+			n, err := strconv.Atoi(line[len("binary: "):])
+			if err != nil {
+				res.Err = err
+				break
+			}
+			if n < 0 || n > limit {
+				res.Err = errors.New(fmt.Sprintf("Invalid binary size: %d", n))
+				break
+			}
+			// The data is followed by a newline
+			data := make([]byte, n+1)
+			if _, err := io.ReadFull(conn.R, data); err != nil {
+				res.Err = err
+				break
+			}
+			res.Binary = append(res.Binary, data[:n]...)
+			res.Data = append(res.Data, line)
+			continue
+		}
 		match := mpdErrorRegexp.FindStringSubmatch(line)
 		if match != nil {
 			ack, err := strconv.ParseUint(match[1], 0, 0)
@@ -161,53 +260,85 @@ func processConnData(conn *textproto.Conn) response {
 	return res
 }
 
-func (c *MPDClient) Cmd(cmd string) *response {
-	var r response
-	id, err := c.conn.Cmd(cmd)
+// logCmd logs a command and the outcome of its response.
+func (c *MPDClient) logCmd(cmd *Command, start time.Time, res *Response) {
+	level := slog.LevelDebug
+	if res.Err != nil {
+		level = slog.LevelWarn
+	}
+	ctx := context.Background()
+	if !c.Logger.Enabled(ctx, level) {
+		return
+	}
+	args := cmd.Args
+	if cmd.Name == "password" {
+		args = []string{redacted}
+	}
+	size := 0
+	for _, line := range res.Data {
+		size += len(line) + 1
+	}
+	attrs := []slog.Attr{
+		slog.String("command", cmd.Name),
+		slog.Any("args", args),
+		slog.Duration("duration", time.Since(start)),
+		slog.Int("lines", len(res.Data)),
+		slog.Int("size", size),
+	}
+	if res.MPDErr != nil {
+		attrs = append(attrs, slog.Uint64("ack", uint64(res.MPDErr.Ack)), slog.String("message", res.MPDErr.MessageText))
+	}
+	if res.Err != nil {
+		attrs = append(attrs, slog.Any("error", res.Err))
+	}
+	c.Logger.LogAttrs(ctx, level, "command", attrs...)
+}
+
+// Cmd sends a command line to MPD, through the interceptors
+// of the client, and returns its response.
+func (c *MPDClient) Cmd(cmd string) *Response {
+	return c.invoke(ParseCommand(cmd), c.send)
+}
+
+// send is the Invoker of the main connection.
+func (c *MPDClient) send(cmd *Command) *Response {
+	start := time.Now()
+	res := c.cmd(cmd.String())
+	c.logCmd(cmd, start, res)
+	if res.Err != nil {
+		c.lose(res.Err)
+	}
+	return res
+}
+
+func (c *MPDClient) cmd(cmd string) *Response {
+	var r Response
+	id, err := c.conn.Cmd("%s", cmd)
 	if err != nil {
 		r.Err = err
 		return &r
 	}
 	c.conn.StartResponse(id)
 	defer c.conn.EndResponse(id)
-	res := processConnData(c.conn)
+	res := processConnData(c.conn, c.binaryLimit)
 	return &res
 }
 
 func (c *MPDClient) Close() error {
-	// Shut down idle mode
-	c.Logger.Println("sending quit command")
-	c.idle.MaybeWait()
-	go func() {
-		c.idle.quitCh <- true
-	}()
-
-	id, err := c.subscriptionConn.Cmd("noidle")
-	if err != nil {
-		return err
+	// Shut down idle mode: the idle loops return
+	// when their connection is closed under them.
+	close(c.idle.quitCh)
+	if c.subscriptionConn != nil {
+		c.subscriptionConn.Close()
 	}
-	c.subscriptionConn.StartResponse(id)
-	c.subscriptionConn.EndResponse(id)
-	CloseConn(c.subscriptionConn)
-
-	c.Logger.Println("sending quit command")
-	go func() {
-		c.idle.quitCh <- true
-	}()
-
-	id, err = c.idleConn.Cmd("noidle")
-	if err != nil {
-		return err
+	if c.idleConn != nil {
+		c.idleConn.Close()
 	}
-	c.idleConn.StartResponse(id)
-	c.idleConn.EndResponse(id)
-	CloseConn(c.idleConn)
 
 	// Stop ping loop
 	close(c.pingLoopCh)
 	// Close connections properly
-	CloseConn(c.conn)
-	return nil
+	return CloseConn(c.conn)
 }
 
 func CloseConn(conn *textproto.Conn) error {
@@ -224,78 +355,179 @@ func CloseConn(conn *textproto.Conn) error {
 	return nil
 }
 
-func newConn(host string, port uint, password string) (*textproto.Conn, *Version, error) {
-	addr := fmt.Sprintf("%s:%d", host, port)
-	conn, err := textproto.Dial(network, addr)
+func newConn(network, address string, cfg *config, name string, timeouts bool) (*textproto.Conn, *Version, error) {
+	dialer := cfg.dialer
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: cfg.dialTimeout}
+	}
+	netConn, err := dialer.Dial(network, address)
 	if err != nil {
 		return nil, nil, err
 	}
+	if cfg.tlsConfig != nil {
+		tlsConfig := cfg.tlsConfig
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			if host, _, err := net.SplitHostPort(address); err == nil {
+				tlsConfig.ServerName = host
+			}
+		}
+		netConn = tls.Client(netConn, tlsConfig)
+	}
+	// Reads on idle connections have no timeout:
+	// bound the handshake and the greeting.
+	if cfg.dialTimeout > 0 {
+		netConn.SetDeadline(time.Now().Add(cfg.dialTimeout))
+	}
+	// Reads on idle connections block until something changes,
+	// so only the write timeout applies to them.
+	dc := &deadlineConn{Conn: netConn, writeTimeout: cfg.writeTimeout}
+	if timeouts {
+		dc.readTimeout = cfg.readTimeout
+	}
+	var rwc net.Conn = dc
+	if cfg.wireTrace && cfg.logger != nil {
+		rwc = &traceConn{Conn: dc, logger: cfg.logger, name: name}
+	}
+	conn := textproto.NewConn(rwc)
+
 	line, err := conn.ReadLine()
 	if err != nil {
+		conn.Close()
 		return nil, nil, err
 	}
 
-	if line[0:6] != "OK MPD" {
+	if !strings.HasPrefix(line, "OK MPD") {
+		conn.Close()
 		return nil, nil, errors.New("MPD: not OK")
 	}
 	m := mpdVersionRegexp.FindStringSubmatch(line)
 	if m == nil {
-		return conn, nil, errors.New("Unknown MPD protocol version")
+		conn.Close()
+		return nil, nil, errors.New("Unknown MPD protocol version")
 	}
 	mjr, _ := strconv.ParseUint(m[1], 0, 0)
 	mnr, _ := strconv.ParseUint(m[2], 0, 0)
 	rev, _ := strconv.ParseUint(m[3], 0, 0)
 	version := Version{uint(mjr), uint(mnr), uint(rev)}
 
-	if password != "" {
-		if err == nil && password != "" {
-			id, err := conn.Cmd("password %s", password)
-			conn.StartResponse(id)
-			defer conn.EndResponse(id)
-			line, err := conn.ReadLine()
-			if err != nil {
-				return nil, nil, err
-			}
-			if line != "OK" {
-				return nil, nil, errors.New(line)
-			}
+	if cfg.password != "" {
+		if err := rawCmd(conn, "password "+quoteArg(cfg.password)); err != nil {
+			conn.Close()
+			return nil, nil, err
 		}
 	}
+	if cfg.dialTimeout > 0 {
+		netConn.SetDeadline(time.Time{})
+	}
 
 	return conn, &version, nil
 }
 
-func newMPDClient(host string, port uint, password string) (*MPDClient, error) {
-	conn, version, err := newConn(host, port, password)
+// rawCmd sends cmd on conn and discards the response.
+func rawCmd(conn *textproto.Conn, cmd string) error {
+	id, err := conn.Cmd("%s", cmd)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	idleConn, _, err := newConn(host, port, password)
-	if err != nil {
-		return nil, err
+	conn.StartResponse(id)
+	defer conn.EndResponse(id)
+	res := processConnData(conn, maxBinaryChunk)
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.MPDErr != nil {
+		return res.MPDErr
 	}
-	subscriptionConn, _, err := newConn(host, port, password)
+	return nil
+}
+
+func newMPDClient(network, address string, cfg *config) (*MPDClient, error) {
+	conn, version, err := newConn(network, address, cfg, "command", true)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.binaryLimit > 0 {
+		if required := Capabilities[FeatureBinaryLimit]; !version.AtLeast(required) {
+			conn.Close()
+			return nil, &ErrUnsupported{FeatureBinaryLimit, required, *version}
+		}
+		err = rawCmd(conn, fmt.Sprintf("binarylimit %d", cfg.binaryLimit))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	var idleConn, subscriptionConn *textproto.Conn
+	if cfg.loops&IdleLoop != 0 {
+		idleConn, _, err = newConn(network, address, cfg, "idle", false)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if cfg.loops&SubscriptionLoop != 0 {
+		subscriptionConn, _, err = newConn(network, address, cfg, "subscription", false)
+		if err != nil {
+			conn.Close()
+			if idleConn != nil {
+				idleConn.Close()
+			}
+			return nil, err
+		}
+	}
 
-	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+	logger := cfg.logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
 
 	var m sync.Mutex
 	c := sync.NewCond(&m)
-	idleState := &idleState{c, false, make(chan bool), make(chan *request), make(chan *response)}
+	idleState := &idleState{c, false, make(chan bool), make(chan *request), make(chan *Response)}
+
+	host, port := address, uint(0)
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		host = h
+		if n, err := strconv.ParseUint(p, 10, 0); err == nil {
+			port = uint(n)
+		}
+	}
 
-	mpdc := &MPDClient{host, port, *version, conn, idleConn, subscriptionConn, make(chan bool), idleState, []*idleListener{}, logger}
-	go mpdc.pingLoop()
-	go mpdc.idleLoop()
-	go mpdc.subscriptionLoop()
+	mpdc := &MPDClient{
+		Host:             host,
+		Port:             port,
+		ProtocolVersion:  *version,
+		conn:             conn,
+		idleConn:         idleConn,
+		subscriptionConn: subscriptionConn,
+		pingLoopCh:       make(chan bool),
+		idle:             idleState,
+		idleListeners:    []*idleListener{},
+		interceptor:      ChainInterceptors(cfg.interceptors...),
+		lostCh:           make(chan struct{}),
+		binaryLimit:      maxBinaryChunk,
+		Logger:           logger,
+	}
+	if cfg.binaryLimit > 0 {
+		mpdc.binaryLimit = int(cfg.binaryLimit)
+	}
+	if cfg.loops&PingLoop != 0 && cfg.keepAlive > 0 {
+		go mpdc.pingLoop(cfg.keepAlive)
+	}
+	if idleConn != nil {
+		go mpdc.idleLoop()
+	}
+	if subscriptionConn != nil {
+		go mpdc.subscriptionLoop()
+	}
 	return mpdc, nil
 }
 
 func Connect(host string, port uint) (*MPDClient, error) {
-	return newMPDClient(host, port, "")
+	return Dial(defaultNetwork, net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)))
 }
 
 func ConnectAuth(host string, port uint, password string) (*MPDClient, error) {
-	return newMPDClient(host, port, password)
+	return Dial(defaultNetwork, net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)), WithPassword(password))
 }
@@ -20,10 +20,15 @@
 package mpdclient
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/textproto"
 	"regexp"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -362,6 +367,10 @@ func TestMpdResponseFailureRegexp(t *testing.T) {
 			`ACK [50@1] {play} song doesn't exist: "10240"`,
 			[]string{"50", "1", "play", `song doesn't exist: "10240"`},
 		},
+		regexpTestCase{
+			`ACK [5@0] {} unknown command "foo"`,
+			[]string{"5", "0", "", `unknown command "foo"`},
+		},
 	}
 	for _, test := range tests {
 		if err := test.Validate(mpdErrorRegexp); err != nil {
@@ -370,6 +379,17 @@ func TestMpdResponseFailureRegexp(t *testing.T) {
 	}
 }
 
+func TestMPDErrorLine(t *testing.T) {
+	mpdErr := MPDError{AckNoExist, 1, "play", `song doesn't exist: "10240"`}
+	line := mpdErr.Line()
+	if line != `ACK [50@1] {play} song doesn't exist: "10240"` {
+		t.Fatalf("Unexpected line %s", line)
+	}
+	if m := mpdErrorRegexp.FindStringSubmatch(line); m == nil || m[4] != mpdErr.MessageText {
+		t.Fatalf("Expected %s to parse back", line)
+	}
+}
+
 func TestMpdVersionRegexp(t *testing.T) {
 	tests := []regexpTestCase{
 		regexpTestCase{
@@ -544,8 +564,8 @@ func TestStickerFind(t *testing.T) {
 	if len(songSticker.Uri) == 0 {
 		t.Fatalf("Empty 'Uri' field")
 	}
-	if len(songSticker.Sticker) == 0 {
-		t.Fatalf("Empty 'Sticker' field")
+	if len(songSticker.Name) == 0 {
+		t.Fatalf("Empty 'Name' field")
 	}
 	if len(songSticker.Value) == 0 {
 		t.Fatalf("Empty 'Value' field")
@@ -553,3 +573,517 @@ func TestStickerFind(t *testing.T) {
 	// try a sort, just to check the interfaces are satisfied
 	sort.Sort(sort.Reverse(songStickers))
 }
+
+func TestDiffChannels(t *testing.T) {
+	before := map[string]bool{"a": true, "b": true}
+	after := map[string]bool{"b": true, "c": true}
+	diff := diffChannels(before, after)
+	if len(diff.Appeared) != 1 || diff.Appeared[0] != "c" {
+		t.Fatalf("Expected %q appeared, got %q", []string{"c"}, diff.Appeared)
+	}
+	if len(diff.Disappeared) != 1 || diff.Disappeared[0] != "a" {
+		t.Fatalf("Expected %q disappeared, got %q", []string{"a"}, diff.Disappeared)
+	}
+	if !diffChannels(after, after).Empty() {
+		t.Fatalf("Expected no difference")
+	}
+}
+
+func TestWatchPresence(t *testing.T) {
+	mpdc, err := Connect(mpdHost, mpdPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpdc.Close()
+	other, err := Connect(mpdHost, mpdPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	w, err := mpdc.WatchPresence()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	const name = "test-presence"
+	if err := other.Announce(name); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case diff := <-w.Ch:
+		if len(diff.Appeared) != 1 || diff.Appeared[0] != name {
+			t.Fatalf("Expected %s to appear, got %q", name, diff.Appeared)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No presence change received")
+	}
+
+	if err := other.Withdraw(name); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case diff := <-w.Ch:
+		if len(diff.Disappeared) != 1 || diff.Disappeared[0] != name {
+			t.Fatalf("Expected %s to disappear, got %q", name, diff.Disappeared)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No presence change received")
+	}
+	// Closing twice is fine
+	w.Close()
+}
+
+func TestHeartbeatExpiry(t *testing.T) {
+	w := &HeartbeatWatcher{expires: make(map[string]time.Time)}
+	w.c = &MPDClient{Logger: slog.New(slog.DiscardHandler)}
+	now := time.Now()
+	diff := w.update([]ChannelMessage{{HeartbeatChannel, "kiosk 1 10s"}, {HeartbeatChannel, "bad"}}, now)
+	if len(diff.Appeared) != 1 || diff.Appeared[0] != "kiosk 1" {
+		t.Fatalf("Expected %q to appear, got %+v", "kiosk 1", diff)
+	}
+	if diff := w.update(nil, now.Add(25*time.Second)); !diff.Empty() {
+		t.Fatalf("Expected no change within the expiry, got %+v", diff)
+	}
+	diff = w.update(nil, now.Add(31*time.Second))
+	if len(diff.Disappeared) != 1 || diff.Disappeared[0] != "kiosk 1" || len(w.Alive()) != 0 {
+		t.Fatalf("Expected %q to expire, got %+v", "kiosk 1", diff)
+	}
+}
+
+func TestWatchHeartbeats(t *testing.T) {
+	mpdc, err := Connect(mpdHost, mpdPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpdc.Close()
+	other, err := Connect(mpdHost, mpdPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	w, err := mpdc.WatchHeartbeats(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	const name = "test-heartbeat"
+	h := other.Heartbeat(name, 100*time.Millisecond)
+	select {
+	case diff := <-w.Ch:
+		if len(diff.Appeared) != 1 || diff.Appeared[0] != name {
+			t.Fatalf("Expected %s to appear, got %q", name, diff.Appeared)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No heartbeat received")
+	}
+
+	// The client stays connected, but stops sending heartbeats.
+	h.Close()
+	h.Close()
+	select {
+	case diff := <-w.Ch:
+		if len(diff.Disappeared) != 1 || diff.Disappeared[0] != name {
+			t.Fatalf("Expected %s to disappear, got %q", name, diff.Disappeared)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No heartbeat expiry")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		Line string
+		Name string
+		Args []string
+	}{
+		{"status", "status", nil},
+		{`sticker get song "a b.ogg" rating`, "sticker", []string{"get", "song", "a b.ogg", "rating"}},
+		{`sendmessage chan "say \"hi\" \\o/"`, "sendmessage", []string{"chan", `say "hi" \o/`}},
+		{`sticker find song "" rating`, "sticker", []string{"find", "song", "", "rating"}},
+	}
+	for _, test := range tests {
+		cmd := ParseCommand(test.Line)
+		if cmd.Name != test.Name {
+			t.Fatalf("%s: expected name %s, got %s", test.Line, test.Name, cmd.Name)
+		}
+		if fmt.Sprintf("%q", cmd.Args) != fmt.Sprintf("%q", test.Args) {
+			t.Fatalf("%s: expected args %q, got %q", test.Line, test.Args, cmd.Args)
+		}
+		reparsed := ParseCommand(cmd.String())
+		if fmt.Sprintf("%q", reparsed) != fmt.Sprintf("%q", cmd) {
+			t.Fatalf("%s: %q doesn't parse back to %q", test.Line, cmd.String(), cmd)
+		}
+	}
+}
+
+func TestChainInterceptors(t *testing.T) {
+	var calls []string
+	trace := func(name string) Interceptor {
+		return func(cmd *Command, next Invoker) *Response {
+			calls = append(calls, name)
+			return next(cmd)
+		}
+	}
+	final := func(cmd *Command) *Response {
+		calls = append(calls, "send "+cmd.Name)
+		return &Response{Data: []string{}}
+	}
+	chain := ChainInterceptors(trace("a"), trace("b"), DenyCommands("clear"))
+
+	res := chain(&Command{Name: "status"}, final)
+	if res.MPDErr != nil {
+		t.Fatal(res.MPDErr)
+	}
+	expected := []string{"a", "b", "send status"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("Expected calls %q, got %q", expected, calls)
+	}
+
+	calls = nil
+	res = chain(&Command{Name: "clear"}, final)
+	if res.MPDErr == nil || res.MPDErr.Ack != AckPermission {
+		t.Fatalf("Expected permission error, got %v", res.MPDErr)
+	}
+	expected = []string{"a", "b"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("Expected calls %q, got %q", expected, calls)
+	}
+}
+
+func TestStats(t *testing.T) {
+	mpdc, err := Connect(mpdHost, mpdPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpdc.Close()
+	stats, err := mpdc.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Songs == 0 {
+		t.Fatalf("No songs in the database")
+	}
+	if stats.Uptime == 0 {
+		t.Fatalf("Zero uptime")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	mpdc, err := Connect(mpdHost, mpdPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpdc.Close()
+	commands, err := mpdc.Commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, command := range commands {
+		if command == "status" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("status not found in %q", commands)
+	}
+
+	decoders, err := mpdc.Decoders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoders) == 0 {
+		t.Fatalf("No decoders")
+	}
+	if len(decoders[0].Suffixes) == 0 && len(decoders[0].MimeTypes) == 0 {
+		t.Fatalf("Decoder %s has no suffixes nor mime types", decoders[0].Plugin)
+	}
+}
+
+func TestTagTypes(t *testing.T) {
+	mpdc, err := Connect(mpdHost, mpdPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpdc.Close()
+	if err := mpdc.TagTypesClear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mpdc.TagTypesEnable("Artist", "Title"); err != nil {
+		t.Fatal(err)
+	}
+	tagTypes, err := mpdc.TagTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagTypes) != 2 {
+		t.Fatalf("Expected %d tag types, got %q", 2, tagTypes)
+	}
+	if err := mpdc.TagTypesAll(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	v := Version{0, 22, 4}
+	if !v.AtLeast(Version{0, 22, 4}) || !v.AtLeast(Version{0, 21, 9}) {
+		t.Fatalf("Expected %s to be at least 0.22.4 and 0.21.9", v)
+	}
+	if v.AtLeast(Version{0, 23, 0}) || v.AtLeast(Version{1, 0, 0}) {
+		t.Fatalf("Expected %s to be older than 0.23.0 and 1.0.0", v)
+	}
+}
+
+func TestFilterArgs(t *testing.T) {
+	f := And(Eq("Artist", "Bob's"), Base("music"))
+	expr := `((Artist == 'Bob\'s') AND (base 'music'))`
+	if f.String() != expr {
+		t.Fatalf("Expected %s, got %s", expr, f.String())
+	}
+
+	mpdc := &MPDClient{ProtocolVersion: Version{0, 21, 0}}
+	args, err := mpdc.filterArgs(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1 || args[0] != expr {
+		t.Fatalf("Expected %q, got %q", []string{expr}, args)
+	}
+
+	mpdc.ProtocolVersion = Version{0, 20, 0}
+	args, err = mpdc.filterArgs(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 4 || args[0] != "Artist" || args[3] != "music" {
+		t.Fatalf("Expected legacy arguments, got %q", args)
+	}
+	if _, err := mpdc.filterArgs(Contains("Title", "x")); err == nil {
+		t.Fatal("Expected an error for contains on MPD 0.20")
+	} else if _, ok := err.(*ErrUnsupported); !ok {
+		t.Fatalf("Expected *ErrUnsupported, got %T", err)
+	}
+}
+
+func TestParseMounts(t *testing.T) {
+	mounts, err := parseMounts([]string{
+		"mount: ",
+		"storage: /home/foo/music",
+		"mount: nas",
+		"storage: nfs://192.168.1.4/export/mp3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 2 || mounts[0].Point != "" || mounts[1].Storage != "nfs://192.168.1.4/export/mp3" {
+		t.Fatalf("Unexpected mounts %v", mounts)
+	}
+
+	diff := diffMounts(mounts, []Mount{mounts[0], Mount{"nas", "smb://nas/music"}})
+	if len(diff.Mounted) != 1 || diff.Mounted[0].Storage != "smb://nas/music" {
+		t.Fatalf("Expected %s to be mounted again, got %v", "nas", diff.Mounted)
+	}
+	if len(diff.Unmounted) != 1 || diff.Unmounted[0] != mounts[1] {
+		t.Fatalf("Expected %v to be unmounted, got %v", mounts[1], diff.Unmounted)
+	}
+}
+
+func TestDiffNeighbors(t *testing.T) {
+	before := []Neighbor{{"smb://FOO", "FOO"}, {"smb://BAR", "BAR"}}
+	after := []Neighbor{{"smb://BAR", "BAR"}, {"upnp://baz", "baz"}}
+	diff := diffNeighbors(before, after)
+	if len(diff.Appeared) != 1 || diff.Appeared[0].URI != "upnp://baz" {
+		t.Fatalf("Expected %s to appear, got %v", "upnp://baz", diff.Appeared)
+	}
+	if len(diff.Disappeared) != 1 || diff.Disappeared[0].URI != "smb://FOO" {
+		t.Fatalf("Expected %s to disappear, got %v", "smb://FOO", diff.Disappeared)
+	}
+}
+
+func TestCommandList(t *testing.T) {
+	mpdc, err := Connect(mpdHost, mpdPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpdc.Close()
+
+	playlistName := fmt.Sprintf("test-%d", time.Now().Unix())
+	const songUri = "tests/song.ogg"
+	defer mpdc.Rm(playlistName)
+
+	l := mpdc.BeginCommandList()
+	l.Cmd(fmt.Sprintf("playlistadd \"%s\" \"%s\"", playlistName, songUri))
+	l.Cmd(fmt.Sprintf("playlistadd \"%s\" \"%s\"", playlistName, "tests/missing.ogg"))
+	l.Cmd(fmt.Sprintf("playlistadd \"%s\" \"%s\"", playlistName, songUri))
+	res := l.End()
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res.MPDErr == nil || res.MPDErr.CommandListNum != 1 {
+		t.Fatalf("Expected the command #%d to fail, got %v", 1, res.MPDErr)
+	}
+
+	songs, err := mpdc.ListPlaylist(playlistName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(songs) != 1 || songs[0] != songUri {
+		t.Fatalf("Expected %q, got %q", []string{songUri}, songs)
+	}
+}
+
+func TestCommandListInterceptors(t *testing.T) {
+	mpdc := &MPDClient{interceptor: DenyCommands("clear")}
+	l := mpdc.BeginCommandList()
+	l.Cmd("play")
+	l.Cmd("clear")
+	l.Cmd("play")
+	res := l.End()
+	if res.MPDErr == nil || res.MPDErr.Ack != AckPermission || res.MPDErr.CommandListNum != 1 {
+		t.Fatalf("Expected a permission error on command #%d, got %v", 1, res.MPDErr)
+	}
+}
+
+func TestCommandLineBreak(t *testing.T) {
+	var sent []string
+	mpdc := &MPDClient{interceptor: func(cmd *Command, next Invoker) *Response {
+		return next(cmd)
+	}}
+	final := func(cmd *Command) *Response {
+		sent = append(sent, cmd.String())
+		return &Response{Data: []string{}}
+	}
+	for _, cmd := range []*Command{
+		{"add", []string{"song.ogg\nclear"}},
+		{"add", []string{"song.ogg\r"}},
+		{"clear\nplay", nil},
+	} {
+		res := mpdc.invoke(cmd, final)
+		if res.MPDErr == nil || res.MPDErr.Ack != AckArg {
+			t.Fatalf("Expected an argument error for %q, got %v", cmd.String(), res.MPDErr)
+		}
+	}
+	if len(sent) != 0 {
+		t.Fatalf("Expected nothing sent, got %q", sent)
+	}
+
+	l := mpdc.BeginCommandList()
+	l.Cmd("play")
+	l.Cmd("add \"song.ogg\nclear\"")
+	res := l.End()
+	if res.MPDErr == nil || res.MPDErr.Ack != AckArg || res.MPDErr.CommandListNum != 1 {
+		t.Fatalf("Expected an argument error on command #%d, got %v", 1, res.MPDErr)
+	}
+}
+
+func TestCommandListInterceptorsQueue(t *testing.T) {
+	var responses []*Response
+	mpdc := &MPDClient{interceptor: func(cmd *Command, next Invoker) *Response {
+		switch cmd.Name {
+		case "ping":
+			// Answered here, left out of the list
+			return &Response{Data: []string{}}
+		case "play":
+			cmd = &Command{"pause", []string{"0"}}
+		}
+		res := next(cmd)
+		responses = append(responses, res)
+		return res
+	}}
+	l := mpdc.BeginCommandList()
+	l.Cmd("play")
+	l.Cmd("ping")
+	l.Cmd("status")
+	if l.Len() != 2 || l.cmds[0].String() != `pause "0"` || l.cmds[1].Name != "status" {
+		t.Fatalf("Unexpected commands %v", l.cmds)
+	}
+	// next only queues the commands
+	for _, res := range responses {
+		if len(res.Data) != 0 || res.Err != nil || res.MPDErr != nil {
+			t.Fatalf("Expected an empty response, got %+v", res)
+		}
+	}
+}
+
+type bufferConn struct {
+	*strings.Reader
+}
+
+func (bufferConn) Write(p []byte) (int, error) { return len(p), nil }
+func (bufferConn) Close() error                { return nil }
+
+func TestProcessBinaryData(t *testing.T) {
+	data := "size: 8\ntype: image/png\nbinary: 4\nOK\n\x00\nOK\n"
+	conn := textproto.NewConn(bufferConn{strings.NewReader(data)})
+	res := processConnData(conn, maxBinaryChunk)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if string(res.Binary) != "OK\n\x00" {
+		t.Fatalf("Expected binary %q, got %q", "OK\n\x00", res.Binary)
+	}
+	if len(res.Data) != 3 || res.Data[1] != "type: image/png" {
+		t.Fatalf("Unexpected data %v", res.Data)
+	}
+}
+
+func TestProcessBinaryDataInvalidSize(t *testing.T) {
+	for _, data := range []string{
+		"binary: -1\nOK\n",
+		"binary: 9\n12345678\n\nOK\n",
+	} {
+		conn := textproto.NewConn(bufferConn{strings.NewReader(data)})
+		if res := processConnData(conn, 8); res.Err == nil {
+			t.Fatalf("%q: expected an error", data)
+		}
+	}
+}
+
+func TestProcessListOK(t *testing.T) {
+	data := "a: 1\nlist_OK\nlist_OK\nb: 2\nlist_OK\nOK\n"
+	conn := textproto.NewConn(bufferConn{strings.NewReader(data)})
+	res := processConnData(conn, maxBinaryChunk)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if fmt.Sprint(res.ListOK) != "[1 1 2]" {
+		t.Fatalf("Expected %v, got %v", []int{1, 1, 2}, res.ListOK)
+	}
+}
+
+func TestDialTLSTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// Accept the connections and never answer the handshake
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := Dial("tcp", ln.Addr().String(), WithTLS(&tls.Config{}), WithDialTimeout(100*time.Millisecond), WithLoops(IdleLoop))
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Handshake not bounded by the dial timeout")
+	}
+}
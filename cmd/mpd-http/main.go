@@ -0,0 +1,88 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Command mpd-http serves a REST API for a MPD server.
+
+//go:debug httpmuxgo121=0
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/httpapi"
+)
+
+func main() {
+	var (
+		network    = flag.String("mpd.network", "tcp", "Network of the MPD server (tcp or unix).")
+		address    = flag.String("mpd.address", "localhost:6600", "Address of the MPD server.")
+		listenAddr = flag.String("web.listen-address", ":8600", "Address to serve the API on.")
+		corsOrigin = flag.String("web.cors-origin", "", "Origin allowed to make cross-origin requests, if any.")
+	)
+	flag.Parse()
+
+	var opts []mpdclient.Option
+	// Read from the environment to keep it out of the process list
+	if password := os.Getenv("MPD_PASSWORD"); password != "" {
+		opts = append(opts, mpdclient.WithPassword(password))
+	}
+
+	s := httpapi.New(nil)
+	go func() {
+		for {
+			c, err := mpdclient.Dial(*network, *address, opts...)
+			if err != nil {
+				log.Printf("connecting to %s: %v", *address, err)
+			} else {
+				s.SetClient(c)
+				err := s.Events.Watch(c)
+				s.SetClient(nil)
+				c.Close()
+				log.Printf("lost connection to %s: %v", *address, err)
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	var h http.Handler = s
+	if *corsOrigin != "" {
+		h = cors(*corsOrigin, h)
+	}
+	log.Printf("serving the API of %s on %s", *address, *listenAddr)
+	log.Fatal(http.ListenAndServe(*listenAddr, h))
+}
+
+// cors allows requests from origin to h.
+func cors(origin string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
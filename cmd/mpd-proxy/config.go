@@ -0,0 +1,161 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config is the configuration file of the proxy.
+//
+//	{
+//		"default": "guest",
+//		"users": {
+//			"admin": {"password": "s3cret", "allow": ["*"]},
+//			"guest": {
+//				"allow": ["*"],
+//				"deny": ["clear", "delete", "deleteid", "rm", "save", "update", "rescan"],
+//				"rate": 2,
+//				"burst": 20
+//			}
+//		}
+//	}
+type Config struct {
+	// Default is the user of the connections until they send
+	// a password. Without it, they can only send a password.
+	Default string           `json:"default"`
+	Users   map[string]*User `json:"users"`
+}
+
+// User is a user of the proxy.
+type User struct {
+	Name string `json:"-"`
+	// Password is the password which identifies the user,
+	// sent with the password command.
+	Password string `json:"password"`
+	// Allow and Deny are the commands the user may and may not
+	// send, * matching all of them. Deny has precedence.
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+	// Rate is the number of commands per second the user may send,
+	// in bursts of up to Burst commands. A zero rate is no limit.
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+
+	limiter *limiter
+}
+
+// LoadConfig reads and checks a configuration file.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg Config
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %v", path, err))
+	}
+	if err := cfg.init(); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %v", path, err))
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) init() error {
+	passwords := make(map[string]string)
+	for name, u := range cfg.Users {
+		u.Name = name
+		if u.Password != "" {
+			if other, ok := passwords[u.Password]; ok {
+				return errors.New(fmt.Sprintf("Users %s and %s have the same password", other, name))
+			}
+			passwords[u.Password] = name
+		}
+		if u.Rate > 0 {
+			burst := u.Burst
+			if burst < 1 {
+				burst = 1
+			}
+			u.limiter = newLimiter(u.Rate, burst)
+		}
+	}
+	if cfg.Default != "" && cfg.Users[cfg.Default] == nil {
+		return errors.New(fmt.Sprintf("Unknown default user %s", cfg.Default))
+	}
+	return nil
+}
+
+// user returns the user with password, or nil.
+func (cfg *Config) user(password string) *User {
+	for _, u := range cfg.Users {
+		if u.Password != "" && u.Password == password {
+			return u
+		}
+	}
+	return nil
+}
+
+func matches(patterns []string, command string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == command {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the user may send command.
+func (u *User) Allows(command string) bool {
+	return !matches(u.Deny, command) && matches(u.Allow, command)
+}
+
+// limiter is a token bucket.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow takes a token if there is one.
+func (l *limiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
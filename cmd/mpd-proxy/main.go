@@ -0,0 +1,102 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Command mpd-proxy is a proxy to a MPD server, with users,
+// command permissions, rate limits and an audit log.
+//
+// The users are identified by their password, and the commands
+// they may send are set in a JSON configuration file, see Config.
+// The connections to MPD use the password of MPD_PASSWORD.
+//
+// The commands are sent to MPD over a few shared connections,
+// command lists as command lists, and the idle events received on
+// a single one. After a wrong password, a host waits before trying
+// another, longer after each failure.
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+)
+
+func main() {
+	var (
+		network       = flag.String("mpd.network", "tcp", "Network of the MPD server (tcp or unix).")
+		address       = flag.String("mpd.address", "localhost:6600", "Address of the MPD server.")
+		conns         = flag.Int("mpd.conns", 4, "Number of connections to the MPD server for the commands.")
+		listenNetwork = flag.String("listen.network", "tcp", "Network to listen on (tcp or unix).")
+		listenAddr    = flag.String("listen.address", ":6601", "Address or unix socket path to listen on.")
+		configPath    = flag.String("config", "mpd-proxy.json", "Path of the configuration file.")
+		auditPath     = flag.String("audit.log", "", "Path of the audit log, - for stderr. No audit log if empty.")
+	)
+	flag.Parse()
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var opts []mpdclient.Option
+	// Read from the environment to keep it out of the process list
+	if password := os.Getenv("MPD_PASSWORD"); password != "" {
+		opts = append(opts, mpdclient.WithPassword(password))
+	}
+	if *conns < 1 {
+		*conns = 1
+	}
+
+	p := NewProxy(cfg, *network, *address, *conns, opts...)
+	p.Logger = slog.Default()
+	switch *auditPath {
+	case "":
+	case "-":
+		p.Audit = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	default:
+		f, err := os.OpenFile(*auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		p.Audit = slog.New(slog.NewJSONHandler(f, nil))
+	}
+
+	ln, err := net.Listen(*listenNetwork, *listenAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.Start()
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		// Closing the listener removes the unix socket
+		p.Close()
+	}()
+	log.Printf("proxying %s on %s", *address, *listenAddr)
+	if err := p.Server.Serve(ln); err != nil && err != mpdserver.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
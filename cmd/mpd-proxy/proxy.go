@@ -0,0 +1,501 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+)
+
+// unsupported are the commands acting on the state of the connection
+// to MPD, which the connections to the proxy don't have their own of.
+var unsupported = map[string]bool{
+	"tagtypes":     true,
+	"protocol":     true,
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"readmessages": true,
+}
+
+// local are the commands the proxy answers itself,
+// which it doesn't forward in command lists.
+var local = map[string]bool{
+	"password":    true,
+	"commands":    true,
+	"binarylimit": true,
+}
+
+// maxPasswordDelay bounds the delay between the password attempts
+// of a host.
+const maxPasswordDelay = 10 * time.Minute
+
+// sessionKey is the key of the session of a connection.
+type sessionKey struct{}
+
+type session struct {
+	mu   sync.Mutex
+	user *User
+	// slot is the upstream connection of the session
+	slot int
+}
+
+func (s *session) User() *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
+
+func (s *session) setUser(u *User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = u
+}
+
+// Proxy forwards the commands of its clients to MPD,
+// over a few shared connections.
+type Proxy struct {
+	Server *mpdserver.Server
+	// Audit logs the commands of the clients.
+	Audit  *slog.Logger
+	Logger *slog.Logger
+	// RetryInterval is the time between reconnections to MPD.
+	RetryInterval time.Duration
+	// PasswordDelay is the time a host waits to try another password
+	// after a wrong one, doubled with each failure.
+	PasswordDelay time.Duration
+
+	cfg      *Config
+	upstream *upstream
+	mu       sync.Mutex
+	sessions int
+	// backoffs are the failed password attempts by host.
+	backoffs map[string]*backoff
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// backoff holds the failed password attempts of a host.
+type backoff struct {
+	failures int
+	until    time.Time
+}
+
+// NewProxy returns a proxy to the MPD server at address, using
+// conns connections for the commands and one for the idle events.
+func NewProxy(cfg *Config, network, address string, conns int, opts ...mpdclient.Option) *Proxy {
+	p := &Proxy{
+		Server:        mpdserver.NewServer(),
+		Audit:         slog.New(slog.DiscardHandler),
+		Logger:        slog.New(slog.DiscardHandler),
+		RetryInterval: 5 * time.Second,
+		PasswordDelay: time.Second,
+		cfg:           cfg,
+		upstream:      &upstream{network: network, address: address, opts: opts, clients: make([]*mpdclient.MPDClient, conns)},
+		backoffs:      make(map[string]*backoff),
+		done:          make(chan struct{}),
+	}
+	p.Server.NotFound = p.forward
+	p.Server.ListHandler = p.forwardList
+	p.Server.Handle("password", p.password)
+	p.Server.Handle("commands", p.commands)
+	p.Server.Handle("ping", p.local(func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error { return nil }))
+	p.Server.Handle("binarylimit", p.local(mpdserver.BinaryLimit))
+	p.Server.OnConnect = p.connect
+	return p
+}
+
+// Start starts relaying the idle events of MPD to the clients.
+func (p *Proxy) Start() {
+	p.wg.Add(1)
+	go p.relayIdle()
+}
+
+// Close closes the server and the connections to MPD.
+func (p *Proxy) Close() error {
+	close(p.done)
+	err := p.Server.Close()
+	p.wg.Wait()
+	p.upstream.close()
+	return err
+}
+
+func (p *Proxy) connect(c *mpdserver.Conn) {
+	p.mu.Lock()
+	slot := p.sessions % len(p.upstream.clients)
+	p.sessions++
+	p.mu.Unlock()
+	c.SetValue(sessionKey{}, &session{user: p.cfg.Users[p.cfg.Default], slot: slot})
+}
+
+func sessionOf(c *mpdserver.Conn) *session {
+	return c.Value(sessionKey{}).(*session)
+}
+
+// audit logs a command of a client and its outcome.
+func (p *Proxy) audit(r *mpdserver.Request, user *User, start time.Time, err error) {
+	args := r.Args
+	if r.Name == "password" {
+		args = []string{"***"}
+	}
+	name := ""
+	if user != nil {
+		name = user.Name
+	}
+	attrs := []slog.Attr{
+		slog.String("user", name),
+		slog.String("remote", r.Conn.RemoteAddr().String()),
+		slog.String("command", r.Name),
+		slog.Any("args", args),
+		slog.Duration("duration", time.Since(start)),
+	}
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+		if mpdErr, ok := err.(*mpdclient.MPDError); ok {
+			attrs = append(attrs, slog.Uint64("ack", uint64(mpdErr.Ack)))
+		}
+	}
+	p.Audit.LogAttrs(r.Conn.Context(), level, "command", attrs...)
+}
+
+// password identifies the user of the connection. It isn't sent
+// to MPD, the connections to MPD have the password of the proxy.
+func (p *Proxy) password(w *mpdserver.ResponseWriter, r *mpdserver.Request) (err error) {
+	start := time.Now()
+	s := sessionOf(r.Conn)
+	defer func() { p.audit(r, s.User(), start, err) }()
+	if len(r.Args) != 1 {
+		return mpdserver.Errorf(mpdclient.AckArg, "wrong number of arguments for \"%s\"", r.Name)
+	}
+	host := remoteHost(r.Conn)
+	if !p.passwordAllowed(host, start) {
+		return mpdserver.Errorf(mpdclient.AckPassword, "too many incorrect passwords, try again later")
+	}
+	u := p.cfg.user(r.Args[0])
+	p.passwordTried(host, u != nil, start)
+	if u == nil {
+		return mpdserver.Errorf(mpdclient.AckPassword, "incorrect password")
+	}
+	s.setUser(u)
+	return nil
+}
+
+func remoteHost(c *mpdserver.Conn) string {
+	addr := c.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// passwordAllowed reports whether host may try a password.
+func (p *Proxy) passwordAllowed(host string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := p.backoffs[host]
+	return b == nil || !now.Before(b.until)
+}
+
+// passwordTried records a password attempt of host. After a failure,
+// the host waits before its next attempt.
+func (p *Proxy) passwordTried(host string, ok bool, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ok {
+		delete(p.backoffs, host)
+		return
+	}
+	// Forget the hosts which stopped trying
+	for h, b := range p.backoffs {
+		if now.Sub(b.until) > maxPasswordDelay {
+			delete(p.backoffs, h)
+		}
+	}
+	b := p.backoffs[host]
+	if b == nil {
+		b = &backoff{}
+		p.backoffs[host] = b
+	}
+	delay := p.PasswordDelay
+	for i := 0; i < b.failures && delay < maxPasswordDelay; i++ {
+		delay *= 2
+	}
+	b.failures++
+	b.until = now.Add(min(delay, maxPasswordDelay))
+}
+
+// local returns the handler of a command the proxy answers itself,
+// checked and audited like the forwarded commands.
+func (p *Proxy) local(h mpdserver.HandlerFunc) mpdserver.HandlerFunc {
+	return func(w *mpdserver.ResponseWriter, r *mpdserver.Request) (err error) {
+		start := time.Now()
+		u := sessionOf(r.Conn).User()
+		defer func() { p.audit(r, u, start, err) }()
+		if err := p.check(u, r.Name); err != nil {
+			return err
+		}
+		return h(w, r)
+	}
+}
+
+// check returns the error of a command the user may not send.
+func (p *Proxy) check(u *User, command string) error {
+	if u == nil || !u.Allows(command) {
+		return mpdserver.Errorf(mpdclient.AckPermission, "you don't have permission for \"%s\"", command)
+	}
+	if u.limiter != nil && !u.limiter.allow(time.Now()) {
+		return mpdserver.Errorf(mpdclient.AckPermission, "rate limit exceeded")
+	}
+	if unsupported[command] {
+		return mpdserver.Errorf(mpdclient.AckUnknown, "\"%s\" is not supported by the proxy", command)
+	}
+	return nil
+}
+
+// forward sends a command to MPD, and its response to the client.
+func (p *Proxy) forward(w *mpdserver.ResponseWriter, r *mpdserver.Request) (err error) {
+	start := time.Now()
+	s := sessionOf(r.Conn)
+	u := s.User()
+	defer func() { p.audit(r, u, start, err) }()
+	if err := p.check(u, r.Name); err != nil {
+		return err
+	}
+	c, err := p.upstream.client(s.slot)
+	if err != nil {
+		p.Logger.Warn("connection to MPD failed", "error", err)
+		return mpdserver.Errorf(mpdclient.AckSystem, "MPD is unavailable")
+	}
+	res := c.Cmd(r.Command.String())
+	return w.WriteResponse(limitBinary(res, r.Conn.BinaryLimit()))
+}
+
+// forwardList sends a command list to MPD as a command list, and
+// the responses of its commands to the client. A command the user may
+// not send, or one the proxy answers itself, fails the list there.
+func (p *Proxy) forwardList(w *mpdserver.ResponseWriter, r *mpdserver.ListRequest) error {
+	start := time.Now()
+	s := sessionOf(r.Conn)
+	u := s.User()
+	n := len(r.Commands)
+	var checkErr *mpdclient.MPDError
+	for i, cmd := range r.Commands {
+		err := p.check(u, cmd.Name)
+		if err == nil && local[cmd.Name] {
+			err = mpdserver.Errorf(mpdclient.AckUnknown, "\"%s\" is not supported in command lists by the proxy", cmd.Name)
+		}
+		if err != nil {
+			n, checkErr = i, err.(*mpdclient.MPDError)
+			checkErr.CommandListNum = uint(i)
+			break
+		}
+	}
+	res := &mpdclient.Response{}
+	if n > 0 {
+		c, err := p.upstream.client(s.slot)
+		if err != nil {
+			p.Logger.Warn("connection to MPD failed", "error", err)
+			return mpdserver.Errorf(mpdclient.AckSystem, "MPD is unavailable")
+		}
+		l := c.BeginCommandList()
+		for _, cmd := range r.Commands[:n] {
+			l.Cmd(cmd.String())
+		}
+		res = l.End()
+	}
+	var err error
+	switch {
+	case res.Err != nil:
+		err = &mpdclient.MPDError{Ack: mpdclient.AckSystem, CommandListNum: uint(len(res.ListOK)), MessageText: res.Err.Error()}
+	case res.MPDErr != nil:
+		err = res.MPDErr
+	case checkErr != nil:
+		err = checkErr
+	}
+	for i, cmd := range r.Commands {
+		if i < len(res.ListOK) {
+			p.audit(&mpdserver.Request{Command: *cmd, Conn: r.Conn, ListNum: i}, u, start, nil)
+			continue
+		}
+		if err != nil {
+			p.audit(&mpdserver.Request{Command: *cmd, Conn: r.Conn, ListNum: i}, u, start, err)
+		}
+		break
+	}
+	for i, cmdRes := range splitList(res) {
+		if err := w.WriteResponse(limitBinary(cmdRes, r.Conn.BinaryLimit())); err != nil {
+			return &mpdclient.MPDError{Ack: mpdclient.AckSystem, CommandListNum: uint(i), MessageText: err.Error()}
+		}
+		w.ListOK()
+	}
+	return err
+}
+
+// splitList returns the responses of the commands of a command list
+// that succeeded.
+func splitList(res *mpdclient.Response) []*mpdclient.Response {
+	var responses []*mpdclient.Response
+	binary := res.Binary
+	start := 0
+	for _, end := range res.ListOK {
+		cmdRes := &mpdclient.Response{Data: res.Data[start:end]}
+		for _, line := range cmdRes.Data {
+			if n, ok := strings.CutPrefix(line, "binary: "); ok {
+				size, err := strconv.Atoi(n)
+				if err != nil || size < 0 || size > len(binary) {
+					size = len(binary)
+				}
+				cmdRes.Binary = append(cmdRes.Binary, binary[:size]...)
+				binary = binary[size:]
+			}
+		}
+		responses = append(responses, cmdRes)
+		start = end
+	}
+	return responses
+}
+
+// limitBinary cuts the binary of res to the binary limit the client
+// set. The chunked commands, like albumart, ask for the rest at the
+// next offset.
+func limitBinary(res *mpdclient.Response, limit int) *mpdclient.Response {
+	if len(res.Binary) <= limit {
+		return res
+	}
+	data := make([]string, len(res.Data))
+	for i, line := range res.Data {
+		if strings.HasPrefix(line, "binary: ") {
+			line = "binary: " + strconv.Itoa(limit)
+		}
+		data[i] = line
+	}
+	return &mpdclient.Response{Data: data, Binary: res.Binary[:limit], Err: res.Err, MPDErr: res.MPDErr}
+}
+
+// commands lists the commands of MPD the user may send.
+func (p *Proxy) commands(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+	u := sessionOf(r.Conn).User()
+	c, err := p.upstream.client(sessionOf(r.Conn).slot)
+	if err != nil {
+		return mpdserver.Errorf(mpdclient.AckSystem, "MPD is unavailable")
+	}
+	commands, err := c.Commands()
+	if err != nil {
+		return err
+	}
+	commands = append(commands, "password", "ping", "close", "idle", "noidle", "binarylimit")
+	sort.Strings(commands)
+	for i, command := range commands {
+		if i > 0 && command == commands[i-1] {
+			continue
+		}
+		if command == "password" || (u != nil && u.Allows(command) && !unsupported[command]) {
+			w.Field("command", command)
+		}
+	}
+	return nil
+}
+
+// relayIdle notifies the clients of the idle events of MPD,
+// received on a single connection.
+func (p *Proxy) relayIdle() {
+	defer p.wg.Done()
+	for {
+		opts := append(p.upstream.opts[:len(p.upstream.opts):len(p.upstream.opts)], mpdclient.WithLoops(mpdclient.IdleLoop))
+		c, err := mpdclient.Dial(p.upstream.network, p.upstream.address, opts...)
+		if err == nil {
+			events := c.Idle()
+		relay:
+			for {
+				select {
+				case <-p.done:
+					events.Close()
+					c.Close()
+					return
+				case <-c.Lost():
+					p.Logger.Warn("idle connection to MPD lost", "error", c.Err())
+					break relay
+				case subsystem := <-events.Ch:
+					p.Server.Notify(subsystem)
+				}
+			}
+			events.Close()
+			c.Close()
+		} else {
+			p.Logger.Warn("idle connection to MPD failed", "error", err)
+		}
+		select {
+		case <-p.done:
+			return
+		case <-time.After(p.RetryInterval):
+		}
+	}
+}
+
+// upstream is the pool of connections to MPD the commands
+// are sent on.
+type upstream struct {
+	network, address string
+	opts             []mpdclient.Option
+	mu               sync.Mutex
+	clients          []*mpdclient.MPDClient
+}
+
+// client returns the client of a slot, connecting it again
+// if it was lost.
+func (u *upstream) client(slot int) (*mpdclient.MPDClient, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	c := u.clients[slot]
+	if c != nil && c.Err() == nil {
+		return c, nil
+	}
+	if c != nil {
+		c.Close()
+		u.clients[slot] = nil
+	}
+	opts := append(u.opts[:len(u.opts):len(u.opts)], mpdclient.WithLoops(mpdclient.PingLoop))
+	c, err := mpdclient.Dial(u.network, u.address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	u.clients[slot] = c
+	return c, nil
+}
+
+func (u *upstream) close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i, c := range u.clients {
+		if c != nil {
+			c.Close()
+			u.clients[i] = nil
+		}
+	}
+}
@@ -0,0 +1,278 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+// syncBuffer is a buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProxy(t *testing.T) {
+	up, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	up.Respond("status", "state: stop\nvolume: 10")
+	up.Respond("clear", "")
+	up.Respond("add", "")
+
+	cfg := &Config{
+		Default: "guest",
+		Users: map[string]*User{
+			"admin": {Password: "s3cret", Allow: []string{"*"}},
+			"guest": {Allow: []string{"*"}, Deny: []string{"clear"}},
+			"slow":  {Password: "slow", Allow: []string{"add", "ping"}, Rate: 0.001, Burst: 2},
+		},
+	}
+	if err := cfg.init(); err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(cfg, "tcp", up.Addr, 2)
+	p.PasswordDelay = 50 * time.Millisecond
+	var audit syncBuffer
+	p.Audit = slog.New(slog.NewJSONHandler(&audit, nil))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start()
+	go p.Server.Serve(ln)
+	defer p.Close()
+
+	c, err := mpdclient.Dial("tcp", ln.Addr().String(), mpdclient.WithLoops(mpdclient.IdleLoop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Guest
+	if res := c.Cmd("status"); res.MPDErr != nil || len(res.Data) != 2 || res.Data[1] != "volume: 10" {
+		t.Fatalf("Unexpected status %+v", res)
+	}
+	if err := c.Clear(); err == nil || err.(*mpdclient.MPDError).Ack != mpdclient.AckPermission {
+		t.Fatalf("Expected a permission error, got %v", err)
+	}
+	if res := c.Cmd("tagtypes"); res.MPDErr == nil || res.MPDErr.Ack != mpdclient.AckUnknown {
+		t.Fatalf("Expected tagtypes to be unsupported, got %+v", res.MPDErr)
+	}
+	if res := c.Cmd("password nope"); res.MPDErr == nil || res.MPDErr.Ack != mpdclient.AckPassword {
+		t.Fatalf("Expected a password error, got %+v", res.MPDErr)
+	}
+	if res := c.Cmd("password s3cret"); res.MPDErr == nil || !strings.Contains(res.MPDErr.MessageText, "try again later") {
+		t.Fatalf("Expected to wait after a wrong password, got %+v", res.MPDErr)
+	}
+	time.Sleep(p.PasswordDelay)
+
+	// Admin
+	if res := c.Cmd("password s3cret"); res.MPDErr != nil {
+		t.Fatal(res.MPDErr)
+	}
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range up.Commands() {
+		if cmd.Name == "password" {
+			t.Fatal("Expected the password not to be forwarded")
+		}
+	}
+
+	// Rate limited
+	c.Cmd("password slow")
+	for i := 0; i < 2; i++ {
+		if err := c.Add("a.ogg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Add("a.ogg"); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("Expected the rate limit to be exceeded, got %v", err)
+	}
+	if err := c.Ping(); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("Expected the rate limit to be exceeded, got %v", err)
+	}
+
+	// Idle events of MPD are relayed
+	events := c.Idle("playlist")
+	defer events.Close()
+	for i := 0; ; i++ {
+		up.Notify("playlist")
+		select {
+		case <-events.Ch:
+		case <-time.After(50 * time.Millisecond):
+			// The relay may not be idle yet
+			if i < 20 {
+				continue
+			}
+			t.Fatal("Expected a playlist event")
+		}
+		break
+	}
+
+	log := audit.String()
+	if !strings.Contains(log, `"user":"admin","remote"`) || !strings.Contains(log, `"command":"clear"`) || !strings.Contains(log, `"command":"ping"`) || strings.Contains(log, "s3cret") {
+		t.Fatalf("Unexpected audit log:\n%s", log)
+	}
+}
+
+func TestProxyBinaryLimit(t *testing.T) {
+	up, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	cover := bytes.Repeat([]byte("0123456789"), 100)
+	up.Handle("albumart", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		offset, _ := strconv.Atoi(r.Args[1])
+		return w.Chunk(cover, offset)
+	})
+
+	cfg := &Config{Default: "guest", Users: map[string]*User{"guest": {Allow: []string{"*"}}}}
+	if err := cfg.init(); err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(cfg, "tcp", up.Addr, 1)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start()
+	go p.Server.Serve(ln)
+	defer p.Close()
+
+	c, err := mpdclient.Dial("tcp", ln.Addr().String(), mpdclient.WithLoops(0), mpdclient.WithBinaryLimit(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	res := c.Cmd("albumart a.ogg 0")
+	if res.Err != nil || res.MPDErr != nil {
+		t.Fatalf("albumart failed: %v %v", res.Err, res.MPDErr)
+	}
+	if len(res.Binary) != 128 {
+		t.Fatalf("Expected a chunk of %d bytes, got %d", 128, len(res.Binary))
+	}
+	data, err := c.AlbumArt("a.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, cover) {
+		t.Fatalf("Expected the cover of %d bytes, got %d", len(cover), len(data))
+	}
+}
+
+func TestProxyCommandList(t *testing.T) {
+	up, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	up.Respond("status", "state: stop")
+	up.Fail("play", mpdclient.AckNoExist, "No such song")
+	var mu sync.Mutex
+	var added []string
+	up.Handle("add", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// The position in the list upstream
+		added = append(added, r.Args[0]+"@"+strconv.Itoa(r.ListNum))
+		return nil
+	})
+
+	cfg := &Config{Default: "guest", Users: map[string]*User{"guest": {Allow: []string{"*"}, Deny: []string{"clear"}}}}
+	if err := cfg.init(); err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(cfg, "tcp", up.Addr, 1)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Server.Serve(ln)
+	defer p.Close()
+
+	c, err := mpdclient.Dial("tcp", ln.Addr().String(), mpdclient.WithLoops(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, tt := range []struct {
+		cmds   []string
+		failed int
+		ack    uint
+	}{
+		{[]string{"status", "add a.ogg", "add b.ogg"}, -1, 0},
+		{[]string{"add c.ogg", "clear", "add d.ogg"}, 1, mpdclient.AckPermission},
+		{[]string{"add e.ogg", "play", "add f.ogg"}, 1, mpdclient.AckNoExist},
+		{[]string{"ping", "password nope"}, 1, mpdclient.AckUnknown},
+	} {
+		l := c.BeginCommandList()
+		for _, cmd := range tt.cmds {
+			l.Cmd(cmd)
+		}
+		res := l.End()
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if tt.failed < 0 {
+			if res.MPDErr != nil || len(res.ListOK) != len(tt.cmds) || res.Data[0] != "state: stop" {
+				t.Fatalf("%v: unexpected response %+v", tt.cmds, res)
+			}
+			continue
+		}
+		if res.MPDErr == nil || res.MPDErr.Ack != tt.ack || res.MPDErr.CommandListNum != uint(tt.failed) || len(res.ListOK) != tt.failed {
+			t.Fatalf("%v: expected command %d to fail with %d, got %+v", tt.cmds, tt.failed, tt.ack, res)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := "[a.ogg@1 b.ogg@2 c.ogg@0 e.ogg@0]"; fmt.Sprint(added) != want {
+		t.Fatalf("Expected %s to be added, got %v", want, added)
+	}
+}
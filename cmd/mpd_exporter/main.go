@@ -0,0 +1,56 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Command mpd_exporter exposes the state of a MPD server
+// as Prometheus metrics.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/exporter"
+)
+
+func main() {
+	var (
+		network     = flag.String("mpd.network", "tcp", "Network of the MPD server (tcp or unix).")
+		address     = flag.String("mpd.address", "localhost:6600", "Address of the MPD server.")
+		listenAddr  = flag.String("web.listen-address", ":9162", "Address to expose the metrics on.")
+		metricsPath = flag.String("web.telemetry-path", "/metrics", "Path to expose the metrics on.")
+	)
+	flag.Parse()
+
+	var opts []mpdclient.Option
+	// Read from the environment to keep it out of the process list
+	if password := os.Getenv("MPD_PASSWORD"); password != "" {
+		opts = append(opts, mpdclient.WithPassword(password))
+	}
+
+	e := exporter.New(*network, *address, opts...)
+	e.Start()
+	defer e.Close()
+
+	http.Handle(*metricsPath, e)
+	log.Printf("exposing metrics of %s on %s%s", *address, *listenAddr, *metricsPath)
+	log.Fatal(http.ListenAndServe(*listenAddr, nil))
+}
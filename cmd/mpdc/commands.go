@@ -0,0 +1,602 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// env is what the commands run with.
+type env struct {
+	c     *mpdclient.MPDClient
+	p     *printer
+	stdin io.Reader
+}
+
+type command struct {
+	args string
+	help string
+	// min and max bound the number of arguments, max is -1
+	// for no bound.
+	min, max int
+	// loops are the background loops of the client the command needs.
+	loops mpdclient.Loop
+	run   func(e *env, args []string) error
+}
+
+const (
+	songFormat   = "{{song .}}"
+	fileFormat   = "{{.File}}"
+	queueFormat  = "{{.Pos}}\t{{.Id}}\t{{song .}}\t{{duration .Duration}}"
+	statusFormat = "{{with .Current}}{{song .}}\n{{end}}" +
+		"[{{.State}}] #{{.Song}} {{duration .Elapsed}}{{with .Current}}/{{duration .Duration}}{{end}}\n" +
+		"volume: {{.Volume}}%  repeat: {{onoff .Repeat}}  random: {{onoff .Random}}  " +
+		"single: {{mode .Single}}  consume: {{mode .Consume}}"
+	statsFormat = "artists: {{.Artists}}\nalbums: {{.Albums}}\nsongs: {{.Songs}}\n" +
+		"uptime: {{duration .Uptime}}\nplaytime: {{duration .Playtime}}\n" +
+		"db playtime: {{duration .DBPlaytime}}\ndb update: {{.DBUpdate}}"
+)
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"status":  {"", "Show the player state and the current song.", 0, 0, 0, status},
+		"current": {"", "Show the current song.", 0, 0, 0, current},
+		"stats":   {"", "Show the statistics of the server.", 0, 0, 0, stats},
+
+		"play":      {"[position]", "Start playing, at a position of the queue.", 0, 1, 0, play},
+		"pause":     {"", "Pause.", 0, 0, 0, simple(func(c *mpdclient.MPDClient) error { return c.Pause(true) })},
+		"resume":    {"", "Resume playing.", 0, 0, 0, simple(func(c *mpdclient.MPDClient) error { return c.Pause(false) })},
+		"toggle":    {"", "Toggle between play and pause.", 0, 0, 0, toggle},
+		"stop":      {"", "Stop playing.", 0, 0, 0, simple((*mpdclient.MPDClient).Stop)},
+		"next":      {"", "Play the next song.", 0, 0, 0, simple((*mpdclient.MPDClient).Next)},
+		"prev":      {"", "Play the previous song.", 0, 0, 0, simple((*mpdclient.MPDClient).Previous)},
+		"seek":      {"[+-]<[[h:]m:]s>", "Seek in the current song, relatively with + or -.", 1, 1, 0, seek},
+		"volume":    {"[+-]<volume>", "Set the volume, relatively with + or -.", 1, 1, 0, volume},
+		"random":    {"<on|off>", "Set the random mode.", 1, 1, 0, setBool((*mpdclient.MPDClient).SetRandom)},
+		"repeat":    {"<on|off>", "Set the repeat mode.", 1, 1, 0, setBool((*mpdclient.MPDClient).SetRepeat)},
+		"single":    {"<on|off|oneshot>", "Set the single mode.", 1, 1, 0, setMode((*mpdclient.MPDClient).SetSingle)},
+		"consume":   {"<on|off|oneshot>", "Set the consume mode.", 1, 1, 0, setMode((*mpdclient.MPDClient).SetConsume)},
+		"crossfade": {"<seconds>", "Set the crossfade.", 1, 1, 0, crossfade},
+
+		"queue":  {"", "List the songs of the queue: position, id, song and duration.", 0, 0, 0, queue},
+		"add":    {"<uri|->...", "Add songs to the queue, reading their URIs from stdin with -.", 1, -1, 0, add},
+		"insert": {"<uri>...", "Add songs to the queue after the current song.", 1, -1, 0, insert},
+		"del":    {"<id>...", "Delete songs of the queue.", 1, -1, 0, del},
+		"clear":  {"", "Clear the queue.", 0, 0, 0, simple((*mpdclient.MPDClient).Clear)},
+		"prio":   {"<priority> <id>...", "Set the priority of songs of the queue.", 2, -1, 0, prio},
+
+		"playlists":    {"", "List the stored playlists.", 0, 0, 0, playlists},
+		"playlist":     {"<name>", "List the songs of a stored playlist.", 1, 1, 0, playlist},
+		"load":         {"<name>", "Add a stored playlist to the queue.", 1, 1, 0, withName((*mpdclient.MPDClient).Load)},
+		"save":         {"<name>", "Save the queue to a stored playlist.", 1, 1, 0, withName((*mpdclient.MPDClient).Save)},
+		"rm":           {"<name>", "Delete a stored playlist.", 1, 1, 0, withName((*mpdclient.MPDClient).Rm)},
+		"playlist-add": {"<name> <uri>...", "Add songs to a stored playlist.", 2, -1, 0, playlistAdd},
+
+		"sticker": {"get <uri> <name> | set <uri> <name> <value> | find <uri> <name> | list <uri>",
+			"Get, set, find or list the stickers of songs.", 2, 4, 0, sticker},
+
+		"send":      {"<channel> <message>", "Send a message to a channel.", 2, 2, 0, send},
+		"channels":  {"", "List the channels with subscribers.", 0, 0, 0, channels},
+		"subscribe": {"<channel>...", "Subscribe to channels and print their messages.", 1, -1, mpdclient.SubscriptionLoop, subscribe},
+
+		"idle":     {"[subsystem]...", "Wait for a change of the subsystems, and print them.", 0, -1, mpdclient.IdleLoop, idle(true)},
+		"idleloop": {"[subsystem]...", "Print the changes of the subsystems as they happen.", 0, -1, mpdclient.IdleLoop, idle(false)},
+
+		"find":     {"<tag> <value>... | <expression>", "Find songs with exactly matching tags.", 1, -1, 0, find(false)},
+		"search":   {"<tag> <value>... | <expression>", "Search songs, ignoring case.", 1, -1, 0, find(true)},
+		"listall":  {"[uri]", "List the songs of the database.", 0, 1, 0, listAll},
+		"albumart": {"<uri>", "Write the cover of a song to stdout.", 1, 1, 0, albumArt},
+	}
+}
+
+func simple(f func(c *mpdclient.MPDClient) error) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		return f(e.c)
+	}
+}
+
+func withName(f func(c *mpdclient.MPDClient, name string) error) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		return f(e.c, args[0])
+	}
+}
+
+// statusView is the player state with the current song.
+type statusView struct {
+	*mpdclient.PlayerState
+	Current *mpdclient.Song `json:"current,omitempty"`
+}
+
+func status(e *env, args []string) error {
+	state, err := e.c.PlayerState()
+	if err != nil {
+		return err
+	}
+	song, err := e.c.Playing()
+	if err != nil {
+		return err
+	}
+	return e.p.print(statusView{state, song}, statusFormat)
+}
+
+func current(e *env, args []string) error {
+	song, err := e.c.Playing()
+	if err != nil || song == nil {
+		return err
+	}
+	return e.p.print(song, songFormat)
+}
+
+func stats(e *env, args []string) error {
+	stats, err := e.c.Stats()
+	if err != nil {
+		return err
+	}
+	return e.p.print(stats, statsFormat)
+}
+
+func play(e *env, args []string) error {
+	pos := -1
+	if len(args) == 1 {
+		var err error
+		if pos, err = strconv.Atoi(args[0]); err != nil {
+			return errUsage
+		}
+	}
+	return e.c.Play(pos)
+}
+
+func toggle(e *env, args []string) error {
+	state, err := e.c.PlayerState()
+	if err != nil {
+		return err
+	}
+	switch state.State {
+	case mpdclient.StatePlay:
+		return e.c.Pause(true)
+	case mpdclient.StatePause:
+		return e.c.Pause(false)
+	}
+	return e.c.Play(-1)
+}
+
+// parseTime parses a time as seconds, m:ss or h:mm:ss.
+func parseTime(s string) (time.Duration, error) {
+	var d time.Duration
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, errUsage
+		}
+		d = d*60 + time.Duration(n*float64(time.Second))
+	}
+	return d, nil
+}
+
+// relative splits the + or - sign of a relative value off s.
+func relative(s string) (string, int) {
+	switch {
+	case strings.HasPrefix(s, "+"):
+		return s[1:], 1
+	case strings.HasPrefix(s, "-"):
+		return s[1:], -1
+	}
+	return s, 0
+}
+
+func seek(e *env, args []string) error {
+	s, sign := relative(args[0])
+	t, err := parseTime(s)
+	if err != nil {
+		return err
+	}
+	state, err := e.c.PlayerState()
+	if err != nil {
+		return err
+	}
+	if state.SongId < 0 {
+		return errors.New("No current song")
+	}
+	if sign != 0 {
+		t = state.Elapsed + time.Duration(sign)*t
+		if t < 0 {
+			t = 0
+		}
+	}
+	return e.c.SeekId(state.SongId, t)
+}
+
+func volume(e *env, args []string) error {
+	s, sign := relative(args[0])
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return errUsage
+	}
+	if sign != 0 {
+		state, err := e.c.PlayerState()
+		if err != nil {
+			return err
+		}
+		v = state.Volume + sign*v
+	}
+	return e.c.SetVolume(min(max(v, 0), 100))
+}
+
+func setBool(f func(c *mpdclient.MPDClient, on bool) error) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		switch args[0] {
+		case "on", "1":
+			return f(e.c, true)
+		case "off", "0":
+			return f(e.c, false)
+		}
+		return errUsage
+	}
+}
+
+func setMode(f func(c *mpdclient.MPDClient, mode mpdclient.PlaybackMode) error) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		switch args[0] {
+		case "on", "1":
+			return f(e.c, mpdclient.ModeOn)
+		case "off", "0":
+			return f(e.c, mpdclient.ModeOff)
+		case "oneshot":
+			return f(e.c, mpdclient.ModeOneshot)
+		}
+		return errUsage
+	}
+}
+
+func crossfade(e *env, args []string) error {
+	d, err := parseTime(args[0])
+	if err != nil {
+		return err
+	}
+	return e.c.SetCrossfade(d)
+}
+
+func queue(e *env, args []string) error {
+	songs, err := e.c.Queue()
+	if err != nil {
+		return err
+	}
+	return printList(e.p, songs, queueFormat)
+}
+
+// uris returns args, or the lines of stdin for -.
+func uris(e *env, args []string) ([]string, error) {
+	if len(args) != 1 || args[0] != "-" {
+		return args, nil
+	}
+	var uris []string
+	scanner := bufio.NewScanner(e.stdin)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			uris = append(uris, line)
+		}
+	}
+	return uris, scanner.Err()
+}
+
+func add(e *env, args []string) error {
+	uris, err := uris(e, args)
+	if err != nil {
+		return err
+	}
+	if len(uris) == 0 {
+		return nil
+	}
+	cl := e.c.BeginCommandList()
+	for _, uri := range uris {
+		cl.Cmd((&mpdclient.Command{Name: "add", Args: []string{uri}}).String())
+	}
+	return responseErr(cl.End())
+}
+
+func insert(e *env, args []string) error {
+	state, err := e.c.PlayerState()
+	if err != nil {
+		return err
+	}
+	pos := -1
+	if state.Song >= 0 {
+		pos = state.Song + 1
+	}
+	for _, uri := range args {
+		if _, err := e.c.AddId(uri, pos); err != nil {
+			return err
+		}
+		if pos >= 0 {
+			pos++
+		}
+	}
+	return nil
+}
+
+// ids parses song ids.
+func ids(args []string) ([]int, error) {
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, errUsage
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func del(e *env, args []string) error {
+	ids, err := ids(args)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := e.c.DeleteId(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func prio(e *env, args []string) error {
+	prio, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errUsage
+	}
+	ids, err := ids(args[1:])
+	if err != nil {
+		return err
+	}
+	return e.c.PrioId(prio, ids...)
+}
+
+func playlists(e *env, args []string) error {
+	playlists, err := e.c.ListPlaylists()
+	if err != nil {
+		return err
+	}
+	return printList(e.p, playlists, "{{.Name}}")
+}
+
+func playlist(e *env, args []string) error {
+	songs, err := e.c.ListPlaylistInfo(args[0])
+	if err != nil {
+		return err
+	}
+	return printList(e.p, songs, fileFormat)
+}
+
+func playlistAdd(e *env, args []string) error {
+	uris, err := uris(e, args[1:])
+	if err != nil {
+		return err
+	}
+	for _, uri := range uris {
+		if err := e.c.PlaylistAdd(args[0], uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sticker(e *env, args []string) error {
+	const stype = mpdclient.StickerSongType
+	switch {
+	case args[0] == "get" && len(args) == 3:
+		value, err := e.c.StickerGet(stype, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return errors.New("No such sticker")
+		}
+		return e.p.print(mpdclient.SongSticker{Uri: args[1], Name: args[2], Value: value}, "{{.Value}}")
+	case args[0] == "set" && len(args) == 4:
+		return e.c.StickerSet(stype, args[1], args[2], args[3])
+	case args[0] == "find" && len(args) == 3:
+		stickers, err := e.c.StickerFind(stype, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		return printList(e.p, stickers, "{{.Uri}}\t{{.Value}}")
+	case args[0] == "list" && len(args) == 2:
+		stickers, err := e.c.StickerList(stype, args[1])
+		if err != nil {
+			return err
+		}
+		return printList(e.p, stickers, "{{.Name}}={{.Value}}")
+	}
+	return errUsage
+}
+
+func send(e *env, args []string) error {
+	return e.c.SendMessage(args[0], args[1])
+}
+
+func channels(e *env, args []string) error {
+	channels, err := e.c.Channels()
+	if err != nil {
+		return err
+	}
+	return printList(e.p, channels, "{{.}}")
+}
+
+// interrupted returns a channel closed on the first interrupt signal.
+func interrupted() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	return ch
+}
+
+func subscribe(e *env, args []string) error {
+	events := e.c.Idle("message")
+	defer events.Close()
+	for _, channel := range args {
+		if err := e.c.Subscribe(channel); err != nil {
+			return err
+		}
+	}
+	interrupt := interrupted()
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case <-e.c.Lost():
+			return e.c.Err()
+		case <-events.Ch:
+		}
+		msgs, err := e.c.ReadMessages()
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if err := e.p.stream(msg, "{{.Channel}}: {{.Message}}"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type idleEvent struct {
+	Subsystem string    `json:"subsystem"`
+	Time      time.Time `json:"time"`
+}
+
+func idle(once bool) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		events := e.c.Idle(args...)
+		defer events.Close()
+		interrupt := interrupted()
+		for {
+			select {
+			case <-interrupt:
+				return nil
+			case <-e.c.Lost():
+				return e.c.Err()
+			case subsystem := <-events.Ch:
+				if err := e.p.stream(idleEvent{subsystem, time.Now()}, "{{.Subsystem}}"); err != nil {
+					return err
+				}
+				if once {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// filter returns the filter of the tag and value pairs of args,
+// or of the expression of args.
+func filter(args []string) (mpdclient.Filter, error) {
+	if len(args) == 1 {
+		if !strings.HasPrefix(args[0], "(") {
+			return mpdclient.Filter{}, errUsage
+		}
+		return mpdclient.RawFilter(args[0]), nil
+	}
+	if len(args)%2 != 0 {
+		return mpdclient.Filter{}, errUsage
+	}
+	filters := make([]mpdclient.Filter, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		filters = append(filters, mpdclient.Eq(args[i], args[i+1]))
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return mpdclient.And(filters...), nil
+}
+
+func find(ignoreCase bool) func(e *env, args []string) error {
+	return func(e *env, args []string) error {
+		f, err := filter(args)
+		if err != nil {
+			return err
+		}
+		var songs []mpdclient.Song
+		if ignoreCase {
+			songs, err = e.c.Search(f)
+		} else {
+			songs, err = e.c.Find(f)
+		}
+		if err != nil {
+			return err
+		}
+		return printList(e.p, songs, fileFormat)
+	}
+}
+
+func listAll(e *env, args []string) error {
+	uri := ""
+	if len(args) == 1 {
+		uri = args[0]
+	}
+	songs, err := e.c.ListAllInfo(uri)
+	if err != nil {
+		return err
+	}
+	return printList(e.p, songs, fileFormat)
+}
+
+func albumArt(e *env, args []string) error {
+	data, err := e.c.AlbumArt(args[0])
+	var mpdErr *mpdclient.MPDError
+	if (err == nil && data == nil) || (errors.As(err, &mpdErr) && mpdErr.Ack == mpdclient.AckNoExist) {
+		if e.c.Supports(mpdclient.FeatureReadPicture) {
+			data, _, err = e.c.ReadPicture(args[0])
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return errors.New("No album art")
+	}
+	if e.p.json {
+		return e.p.print(map[string]interface{}{"type": http.DetectContentType(data), "data": data}, "")
+	}
+	_, err = e.p.w.Write(data)
+	return err
+}
+
+// responseErr returns the error of a response.
+func responseErr(res *mpdclient.Response) error {
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.MPDErr != nil {
+		return res.MPDErr
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Command mpdc controls a MPD server from the command line.
+//
+// Usage:
+//
+//	mpdc [flags] <command> [arguments]
+//
+// The server is read from the MPD_HOST and MPD_PORT environment
+// variables, as mpc does: MPD_HOST is a host name or the path of
+// a unix socket, optionally prefixed with a password and @.
+//
+// The output of the commands is formatted with a text/template
+// applied to each item (-format), or is JSON (-json):
+//
+//	mpdc -format '{{.Artist}} - {{.Title}}' queue
+//	mpdc -json status
+//
+// Run mpdc help for the list of commands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+const (
+	defaultHost = "localhost"
+	defaultPort = "6600"
+)
+
+// errUsage reports a wrong usage of a command.
+var errUsage = errors.New("usage")
+
+// server returns the network, the address and the password
+// of the server to connect to.
+func server(host, port string) (network, address, password string) {
+	if host == "" {
+		host = defaultHost
+	}
+	if port == "" {
+		port = defaultPort
+	}
+	// An @ at the start is an abstract unix socket, not a password
+	if i := strings.Index(host, "@"); i > 0 {
+		password, host = host[:i], host[i+1:]
+	}
+	if strings.HasPrefix(host, "/") || strings.HasPrefix(host, "@") {
+		return "unix", host, password
+	}
+	return "tcp", host + ":" + port, password
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: mpdc [flags] <command> [arguments]")
+	fmt.Fprintln(w, "\nFlags:")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(w, "  %-36s %s\n", strings.TrimSpace(name+" "+cmd.args), cmd.help)
+	}
+}
+
+// run runs mpdc with args, and returns its exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) int {
+	fs := flag.NewFlagSet("mpdc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		host    = fs.String("host", getenv("MPD_HOST"), "Host or unix socket of the MPD server, [password@]host.")
+		port    = fs.String("port", getenv("MPD_PORT"), "Port of the MPD server.")
+		format  = fs.String("format", "", "Template of the output of each item, see the text/template package.")
+		asJSON  = fs.Bool("json", false, "Output JSON.")
+		timeout = fs.Duration("timeout", 10*time.Second, "Timeout of the connection and of the commands.")
+	)
+	fs.Usage = func() { usage(stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	name, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	if name == "help" {
+		usage(stdout, fs)
+		return 0
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "mpdc: unknown command %q\n", name)
+		return 2
+	}
+	if len(cmdArgs) < cmd.min || (cmd.max >= 0 && len(cmdArgs) > cmd.max) {
+		fmt.Fprintf(stderr, "Usage: mpdc %s %s\n", name, cmd.args)
+		return 2
+	}
+
+	p := &printer{w: stdout, json: *asJSON, format: *format}
+	network, address, password := server(*host, *port)
+	opts := []mpdclient.Option{
+		mpdclient.WithDialTimeout(*timeout),
+		mpdclient.WithLoops(cmd.loops),
+	}
+	if cmd.loops == 0 {
+		opts = append(opts, mpdclient.WithReadTimeout(*timeout))
+	}
+	if password != "" {
+		opts = append(opts, mpdclient.WithPassword(password))
+	}
+	c, err := mpdclient.Dial(network, address, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "mpdc: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	err = cmd.run(&env{c, p, stdin}, cmdArgs)
+	if err == errUsage {
+		fmt.Fprintf(stderr, "Usage: mpdc %s %s\n", name, cmd.args)
+		return 2
+	}
+	if err != nil {
+		var mpdErr *mpdclient.MPDError
+		if errors.As(err, &mpdErr) {
+			err = errors.New(mpdErr.MessageText)
+		}
+		fmt.Fprintf(stderr, "mpdc: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv))
+}
@@ -0,0 +1,93 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		host, port                 string
+		network, address, password string
+	}{
+		{"", "", "tcp", "localhost:6600", ""},
+		{"secret@music.lan", "6601", "tcp", "music.lan:6601", "secret"},
+		{"/run/mpd/socket", "", "unix", "/run/mpd/socket", ""},
+		{"@mpd", "", "unix", "@mpd", ""},
+		{"secret@@mpd", "", "unix", "@mpd", "secret"},
+	}
+	for _, test := range tests {
+		network, address, password := server(test.host, test.port)
+		if network != test.network || address != test.address || password != test.password {
+			t.Errorf("Expected %s %s %s for %q, got %s %s %s", test.network, test.address, test.password, test.host, network, address, password)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Respond("status", "volume: 40\nstate: pause\nsong: 1\nsongid: 7\nelapsed: 62.000")
+	s.Respond("currentsong", "file: b.ogg\nArtist: B\nTitle: Bee\nduration: 125.000\nPos: 1\nId: 7")
+	s.Respond("replay_gain_status", "replay_gain_mode: off")
+	s.Respond("add", "")
+	host, port, _ := strings.Cut(s.Addr, ":")
+	getenv := func(key string) string {
+		return map[string]string{"MPD_HOST": host, "MPD_PORT": port}[key]
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-format", `{{.State}} {{duration .Elapsed}}\t{{with .Current}}{{song .}}{{end}}`, "status"}, nil, &stdout, &stderr, getenv); code != 0 {
+		t.Fatalf("Expected success, got %d: %s", code, stderr.String())
+	}
+	if out := stdout.String(); out != "pause 1:02\tB - Bee\n" {
+		t.Fatalf("Unexpected output %q", out)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"add", "-"}, strings.NewReader("a.ogg\n\nc d.ogg\n"), &stdout, &stderr, getenv); code != 0 {
+		t.Fatalf("Expected success, got %d: %s", code, stderr.String())
+	}
+	var added []string
+	for _, cmd := range s.Commands() {
+		if cmd.Name == "add" {
+			added = append(added, cmd.Args[0])
+		}
+	}
+	if len(added) != 2 || added[1] != "c d.ogg" {
+		t.Fatalf("Unexpected songs added %v", added)
+	}
+
+	stderr.Reset()
+	if code := run([]string{"volume", "loud"}, nil, &stdout, &stderr, getenv); code != 2 {
+		t.Fatalf("Expected a usage error, got %d", code)
+	}
+	if code := run([]string{"clear"}, nil, &stdout, &stderr, getenv); code != 1 || !strings.Contains(stderr.String(), "unknown command") {
+		t.Fatalf("Expected the error of MPD, got %d: %s", code, stderr.String())
+	}
+}
@@ -0,0 +1,148 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+var funcs = template.FuncMap{
+	"duration": formatDuration,
+	"song":     formatSong,
+	"onoff": func(b bool) string {
+		if b {
+			return "on"
+		}
+		return "off"
+	},
+	"mode": func(mode mpdclient.PlaybackMode) string {
+		switch mode {
+		case mpdclient.ModeOff:
+			return "off"
+		case mpdclient.ModeOn:
+			return "on"
+		}
+		return string(mode)
+	},
+	"join": strings.Join,
+}
+
+// formatDuration formats d as m:ss, or h:mm:ss.
+func formatDuration(d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// formatSong returns "artist - title", or the name of the file
+// of songs without a title.
+func formatSong(song *mpdclient.Song) string {
+	switch {
+	case song.Title == "":
+		return song.File
+	case song.Artist == "":
+		return song.Title
+	}
+	return song.Artist + " - " + song.Title
+}
+
+// printer writes the output of the commands.
+type printer struct {
+	w    io.Writer
+	json bool
+	// format overrides the default templates of the commands
+	format string
+	tmpl   *template.Template
+}
+
+func (p *printer) template(format string) (*template.Template, error) {
+	if p.tmpl != nil {
+		return p.tmpl, nil
+	}
+	if p.format != "" {
+		format = p.format
+	}
+	// Let the users write \n and \t in the format
+	format = strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(format)
+	tmpl, err := template.New("format").Funcs(funcs).Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	p.tmpl = tmpl
+	return tmpl, nil
+}
+
+// print writes v as indented JSON, or with the template
+// followed by a newline.
+func (p *printer) print(v interface{}, format string) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	return p.execute(v, format)
+}
+
+// stream writes v on a line of its own in JSON, for the commands
+// which output as events come.
+func (p *printer) stream(v interface{}, format string) error {
+	if p.json {
+		return json.NewEncoder(p.w).Encode(v)
+	}
+	return p.execute(v, format)
+}
+
+func (p *printer) execute(v interface{}, format string) error {
+	tmpl, err := p.template(format)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(p.w, v); err != nil {
+		return err
+	}
+	_, err = io.WriteString(p.w, "\n")
+	return err
+}
+
+// printList prints the items of a list, as a JSON array
+// or with the template applied to each item.
+func printList[T any](p *printer, items []T, format string) error {
+	if p.json {
+		if items == nil {
+			items = []T{}
+		}
+		return p.print(items, format)
+	}
+	for i := range items {
+		if err := p.execute(&items[i], format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
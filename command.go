@@ -0,0 +1,92 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"strings"
+)
+
+// Command is a command name and its arguments, unquoted.
+type Command struct {
+	Name string
+	Args []string
+}
+
+// ParseCommand parses a command line.
+func ParseCommand(line string) *Command {
+	name, args := splitCommand(line)
+	return &Command{name, args}
+}
+
+// String returns the command line of cmd, with its arguments quoted.
+func (cmd *Command) String() string {
+	if len(cmd.Args) == 0 {
+		return cmd.Name
+	}
+	quoted := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		quoted[i] = quoteArg(arg)
+	}
+	return cmd.Name + " " + strings.Join(quoted, " ")
+}
+
+var argEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quoteArg returns s as a double-quoted command argument,
+// with backslashes and double quotes escaped.
+func quoteArg(s string) string {
+	return "\"" + argEscaper.Replace(s) + "\""
+}
+
+// splitCommand splits a command line into the command name
+// and its arguments, unquoted.
+func splitCommand(line string) (string, []string) {
+	var fields []string
+	var field strings.Builder
+	inField, inQuotes, escaped := false, false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case inQuotes && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+			inField = true
+		case !inQuotes && (r == ' ' || r == '\t'):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
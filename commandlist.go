@@ -0,0 +1,116 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"time"
+)
+
+// CommandList batches commands to send them to MPD at once,
+// between command_list_ok_begin and command_list_end.
+// MPD runs them in order and stops at the first failing one;
+// the CommandListNum of the MPDError of the response is its index.
+//
+// Each command goes through the interceptors of the client when it
+// is added, not when the list is sent: next only queues the command
+// and returns an empty response, so interceptors may deny or rewrite
+// the commands of a list, but can't time them or see their response.
+// An interceptor answering a command itself with an error fails the
+// whole list, and nothing is sent; one answering it with a success
+// leaves it out of the list.
+type CommandList struct {
+	c    *MPDClient
+	cmds []*Command
+	res  *Response
+}
+
+func (c *MPDClient) BeginCommandList() *CommandList {
+	return &CommandList{c: c}
+}
+
+// Cmd adds a command line to the list.
+func (l *CommandList) Cmd(cmd string) {
+	if l.res != nil {
+		return
+	}
+	res := l.c.invoke(ParseCommand(cmd), l.add)
+	if res.Err != nil || res.MPDErr != nil {
+		if res.MPDErr != nil {
+			res.MPDErr.CommandListNum = uint(len(l.cmds))
+		}
+		l.res = res
+	}
+}
+
+func (l *CommandList) add(cmd *Command) *Response {
+	l.cmds = append(l.cmds, cmd)
+	return &Response{Data: []string{}}
+}
+
+func (l *CommandList) Len() int {
+	return len(l.cmds)
+}
+
+// End sends the commands of the list and returns their response,
+// the lines of all the commands put together.
+func (l *CommandList) End() *Response {
+	if l.res != nil {
+		return l.res
+	}
+	if len(l.cmds) == 0 {
+		return &Response{Data: []string{}}
+	}
+	start := time.Now()
+	res := l.c.cmdList(l.cmds)
+	names := make([]string, len(l.cmds))
+	for i, cmd := range l.cmds {
+		names[i] = cmd.Name
+	}
+	l.c.logCmd(&Command{"command_list_ok_begin", names}, start, res)
+	if res.Err != nil {
+		l.c.lose(res.Err)
+	}
+	return res
+}
+
+func (c *MPDClient) cmdList(cmds []*Command) *Response {
+	var r Response
+	id := c.conn.Next()
+	c.conn.StartRequest(id)
+	err := c.conn.PrintfLine("command_list_ok_begin")
+	for _, cmd := range cmds {
+		if err != nil {
+			break
+		}
+		err = c.conn.PrintfLine("%s", cmd.String())
+	}
+	if err == nil {
+		err = c.conn.PrintfLine("command_list_end")
+	}
+	c.conn.EndRequest(id)
+	if err != nil {
+		r.Err = err
+		return &r
+	}
+	c.conn.StartResponse(id)
+	defer c.conn.EndResponse(id)
+	res := processConnData(c.conn, c.binaryLimit)
+	return &res
+}
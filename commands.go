@@ -52,6 +52,8 @@ func (p SongStickerList) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 
+// CurrentSong returns the fields of the current song as MPD sends
+// them. Playing returns it parsed into a Song.
 func (c *MPDClient) CurrentSong() (*Info, error) {
 	res := c.Cmd("currentsong")
 	if res.Err != nil {
@@ -86,10 +88,10 @@ func (c *MPDClient) Status() (*Info, error) {
 
 func (c *MPDClient) StickerGet(stype, uri, stickerName string) (string, error) {
 	res := c.Cmd(fmt.Sprintf(
-		"sticker get \"%s\" \"%s\" \"%s\"",
-		stype,
-		uri,
-		stickerName,
+		"sticker get %s %s %s",
+		quoteArg(stype),
+		quoteArg(uri),
+		quoteArg(stickerName),
 	))
 	if res.Err != nil {
 		return "", res.Err
@@ -119,11 +121,11 @@ func (c *MPDClient) StickerGet(stype, uri, stickerName string) (string, error) {
 
 func (c *MPDClient) StickerSet(stype, uri, stickerName, value string) error {
 	res := c.Cmd(fmt.Sprintf(
-		"sticker set \"%s\" \"%s\" \"%s\" \"%s\"",
-		stype,
-		uri,
-		stickerName,
-		value,
+		"sticker set %s %s %s %s",
+		quoteArg(stype),
+		quoteArg(uri),
+		quoteArg(stickerName),
+		quoteArg(value),
 	))
 	if res.Err != nil {
 		return res.Err
@@ -137,10 +139,10 @@ func (c *MPDClient) StickerSet(stype, uri, stickerName, value string) error {
 
 func (c *MPDClient) StickerFind(stype, uri, stickerName string) (SongStickerList, error) {
 	res := c.Cmd(fmt.Sprintf(
-		"sticker find \"%s\" \"%s\" \"%s\"",
-		stype,
-		uri,
-		stickerName,
+		"sticker find %s %s %s",
+		quoteArg(stype),
+		quoteArg(uri),
+		quoteArg(stickerName),
 	))
 	if res.Err != nil {
 		return nil, res.Err
@@ -182,6 +184,36 @@ func (c *MPDClient) StickerFind(stype, uri, stickerName string) (SongStickerList
 	return songStickers, nil
 }
 
+// StickerList returns all the stickers of an object.
+func (c *MPDClient) StickerList(stype, uri string) (SongStickerList, error) {
+	res := c.Cmd(fmt.Sprintf("sticker list %s %s", quoteArg(stype), quoteArg(uri)))
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		if res.MPDErr.Ack == AckNoExist {
+			return SongStickerList{}, nil
+		}
+		return nil, res.MPDErr
+	}
+	songStickers := make(SongStickerList, 0, len(res.Data))
+	for _, line := range res.Data {
+		key, pair, err := splitLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if key != "sticker" {
+			return nil, errors.New(fmt.Sprintf("Invalid input: %s, expected %s", key, "sticker"))
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Invalid input: %s", pair))
+		}
+		songStickers = append(songStickers, SongSticker{uri, name, value})
+	}
+	return songStickers, nil
+}
+
 func (c *MPDClient) Ping() error {
 	res := c.Cmd("ping")
 	if res.Err != nil {
@@ -192,3 +224,56 @@ func (c *MPDClient) Ping() error {
 	}
 	return nil
 }
+
+// StickerInc adds delta to the numeric value of a sticker,
+// creating it if needed. Servers which don't support sticker inc
+// get the value then set it, which isn't atomic.
+func (c *MPDClient) StickerInc(stype, uri, stickerName string, delta int) error {
+	cmd, err := c.stickerIncCmd(stype, uri, stickerName, delta)
+	if err != nil {
+		return err
+	}
+	return c.simpleCmd(cmd)
+}
+
+// StickerInc adds to the list the increment of a sticker, as
+// MPDClient.StickerInc does. Servers which don't support sticker
+// inc get the value now, and the list sets the new value.
+func (l *CommandList) StickerInc(stype, uri, stickerName string, delta int) error {
+	cmd, err := l.c.stickerIncCmd(stype, uri, stickerName, delta)
+	if err != nil {
+		return err
+	}
+	l.Cmd(cmd)
+	return nil
+}
+
+// stickerIncCmd returns the command adding delta to a sticker.
+func (c *MPDClient) stickerIncCmd(stype, uri, stickerName string, delta int) (string, error) {
+	if c.Supports(FeatureStickerInc) {
+		return fmt.Sprintf(
+			"sticker inc %s %s %s %s",
+			quoteArg(stype),
+			quoteArg(uri),
+			quoteArg(stickerName),
+			quoteArg(strconv.Itoa(delta)),
+		), nil
+	}
+	value, err := c.StickerGet(stype, uri, stickerName)
+	if err != nil {
+		return "", err
+	}
+	n := 0
+	if value != "" {
+		if n, err = strconv.Atoi(value); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf(
+		"sticker set %s %s %s %s",
+		quoteArg(stype),
+		quoteArg(uri),
+		quoteArg(stickerName),
+		quoteArg(strconv.Itoa(n+delta)),
+	), nil
+}
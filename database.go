@@ -0,0 +1,312 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter is a filter expression of the find and search commands.
+// Filters built from Eq, Base, ModifiedSince and And of them can be
+// sent with the old tag/value syntax to servers which don't support
+// filter expressions.
+type Filter struct {
+	expr string
+	// legacy holds the equivalent arguments of the old syntax,
+	// nil when there is none.
+	legacy []string
+	// feature is the feature the expression needs besides
+	// filter expressions, if any.
+	feature Feature
+}
+
+func (f Filter) String() string {
+	return f.expr
+}
+
+var filterValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `"`, `\"`)
+
+func filterValue(value string) string {
+	return "'" + filterValueEscaper.Replace(value) + "'"
+}
+
+// Eq matches the songs whose tag is value. The special tags
+// "any", "file" and "base" are accepted too.
+func Eq(tag, value string) Filter {
+	return Filter{expr: "(" + tag + " == " + filterValue(value) + ")", legacy: []string{tag, value}}
+}
+
+func Ne(tag, value string) Filter {
+	return Filter{expr: "(" + tag + " != " + filterValue(value) + ")"}
+}
+
+// Contains matches the songs whose tag contains value.
+func Contains(tag, value string) Filter {
+	return Filter{expr: "(" + tag + " contains " + filterValue(value) + ")"}
+}
+
+// Match matches the songs whose tag matches a regular expression.
+func Match(tag, pattern string) Filter {
+	return Filter{expr: "(" + tag + " =~ " + filterValue(pattern) + ")"}
+}
+
+// Base matches the songs in a directory of the database.
+func Base(dir string) Filter {
+	return Filter{expr: "(base " + filterValue(dir) + ")", legacy: []string{"base", dir}}
+}
+
+// ModifiedSince matches the songs modified since t.
+func ModifiedSince(t time.Time) Filter {
+	since := t.UTC().Format(time.RFC3339)
+	return Filter{expr: "(modified-since " + filterValue(since) + ")", legacy: []string{"modified-since", since}}
+}
+
+// AddedSince matches the songs added to the database since t (MPD 0.24).
+func AddedSince(t time.Time) Filter {
+	return Filter{expr: "(added-since " + filterValue(t.UTC().Format(time.RFC3339)) + ")", feature: FeatureAddedSince}
+}
+
+func Not(f Filter) Filter {
+	return Filter{expr: "(!" + f.expr + ")", feature: f.feature}
+}
+
+// And matches the songs all the filters match.
+func And(filters ...Filter) Filter {
+	exprs := make([]string, len(filters))
+	legacy := make([]string, 0)
+	var feature Feature
+	for i, f := range filters {
+		exprs[i] = f.expr
+		if legacy != nil && f.legacy != nil {
+			legacy = append(legacy, f.legacy...)
+		} else {
+			legacy = nil
+		}
+		if f.feature != "" {
+			feature = f.feature
+		}
+	}
+	return Filter{expr: "(" + strings.Join(exprs, " AND ") + ")", legacy: legacy, feature: feature}
+}
+
+// RawFilter is a filter expression written by hand.
+func RawFilter(expr string) Filter {
+	return Filter{expr: expr}
+}
+
+// filterArgs returns the arguments to send for f, falling back
+// to the old syntax when the server doesn't support filter expressions.
+func (c *MPDClient) filterArgs(f Filter) ([]string, error) {
+	if f.feature != "" {
+		if err := c.require(f.feature); err != nil {
+			return nil, err
+		}
+	}
+	if c.Supports(FeatureFilterExpressions) {
+		return []string{f.expr}, nil
+	}
+	if f.legacy == nil {
+		return nil, c.require(FeatureFilterExpressions)
+	}
+	return f.legacy, nil
+}
+
+// Find returns the songs of the database matching f exactly.
+func (c *MPDClient) Find(f Filter) ([]Song, error) {
+	return c.findSongs("find", f)
+}
+
+// Search is like Find, ignoring case.
+func (c *MPDClient) Search(f Filter) ([]Song, error) {
+	return c.findSongs("search", f)
+}
+
+func (c *MPDClient) findSongs(cmd string, f Filter) ([]Song, error) {
+	args, err := c.filterArgs(f)
+	if err != nil {
+		return nil, err
+	}
+	res := c.Cmd(joinCommand(cmd, args))
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	return parseSongs(res.Data)
+}
+
+// ListAllInfo returns the songs of the database under the
+// directory uri, or all of them if uri is empty.
+func (c *MPDClient) ListAllInfo(uri string) ([]Song, error) {
+	cmd := "listallinfo"
+	if uri != "" {
+		cmd += " " + quoteArg(uri)
+	}
+	res := c.Cmd(cmd)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	return parseSongs(res.Data)
+}
+
+// ListAllInfoFunc is like ListAllInfo, calling fn on the songs
+// instead of returning them. The database is walked one directory
+// at a time with lsinfo, so that only the songs of one directory
+// are held in memory. The walk stops at the first error fn returns.
+func (c *MPDClient) ListAllInfoFunc(uri string, fn func(song *Song) error) error {
+	dirs := []string{uri}
+	for len(dirs) > 0 {
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+		cmd := "lsinfo"
+		if dir != "" {
+			cmd += " " + quoteArg(dir)
+		}
+		res := c.Cmd(cmd)
+		if res.Err != nil {
+			return res.Err
+		}
+		if res.MPDErr != nil {
+			return res.MPDErr
+		}
+		songs, err := parseSongs(res.Data)
+		if err != nil {
+			return err
+		}
+		for i := range songs {
+			if err := fn(&songs[i]); err != nil {
+				return err
+			}
+		}
+		// Push the subdirectories in reverse order,
+		// to walk them in the order of MPD.
+		for i := len(res.Data) - 1; i >= 0; i-- {
+			if sub, ok := strings.CutPrefix(res.Data[i], "directory: "); ok {
+				dirs = append(dirs, sub)
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the values of tag in the songs matching f, or in all
+// the songs for the zero Filter. Each value comes with the values of
+// the group tags it was listed under, all keyed by tag name:
+//
+//	albums, err := c.List("Album", mpdclient.Filter{}, "AlbumArtist")
+//	// albums[0]["Album"], albums[0]["AlbumArtist"]
+func (c *MPDClient) List(tag string, f Filter, groups ...string) ([]map[string]string, error) {
+	args := []string{tag}
+	if f.expr != "" {
+		filterArgs, err := c.filterArgs(f)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, filterArgs...)
+	}
+	for _, group := range groups {
+		args = append(args, "group", group)
+	}
+	res := c.Cmd(joinCommand("list", args))
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	values := make([]map[string]string, 0)
+	current := make(map[string]string, len(groups))
+	for _, line := range res.Data {
+		key, value, err := splitLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(key, tag) {
+			current[key] = value
+			continue
+		}
+		v := make(map[string]string, len(current)+1)
+		for k, gv := range current {
+			v[k] = gv
+		}
+		v[key] = value
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// GroupCount is the number of songs with a value of a tag,
+// and their total duration.
+type GroupCount struct {
+	Value    string
+	Songs    uint
+	Playtime time.Duration
+}
+
+// CountGroup counts the songs matching f, or all the songs for
+// the zero Filter, by value of the group tag.
+func (c *MPDClient) CountGroup(f Filter, group string) ([]GroupCount, error) {
+	args := []string{}
+	if f.expr != "" {
+		filterArgs, err := c.filterArgs(f)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, filterArgs...)
+	}
+	args = append(args, "group", group)
+	res := c.Cmd(joinCommand("count", args))
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	counts := make([]GroupCount, 0)
+	for _, line := range res.Data {
+		key, value, err := splitLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.EqualFold(key, group):
+			counts = append(counts, GroupCount{Value: value})
+		case len(counts) == 0:
+		case key == "songs":
+			n, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return nil, err
+			}
+			counts[len(counts)-1].Songs = uint(n)
+		case key == "playtime":
+			counts[len(counts)-1].Playtime, err = parseSeconds(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,215 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"time"
+)
+
+const DefaultKeepAlive = 30 * time.Second
+
+// Loop identifies the background loops a client runs.
+type Loop uint
+
+const (
+	// PingLoop pings the server periodically, see WithKeepAlive.
+	PingLoop Loop = 1 << iota
+	// IdleLoop listens to the idle events of all subsystems
+	// on a dedicated connection.
+	IdleLoop
+	// SubscriptionLoop handles client-to-client messaging
+	// on a dedicated connection. Without it, the subscriptions
+	// are made on the main connection.
+	SubscriptionLoop
+
+	AllLoops = PingLoop | IdleLoop | SubscriptionLoop
+)
+
+// NetDialer opens the network connections to MPD.
+// *net.Dialer and most proxy dialers implement it.
+type NetDialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+type config struct {
+	password     string
+	dialTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	keepAlive    time.Duration
+	logger       *slog.Logger
+	wireTrace    bool
+	tlsConfig    *tls.Config
+	dialer       NetDialer
+	binaryLimit  uint
+	loops        Loop
+	interceptors []Interceptor
+}
+
+// Option configures a client created with Dial.
+type Option func(*config)
+
+func WithPassword(password string) Option {
+	return func(cfg *config) {
+		cfg.password = password
+	}
+}
+
+// WithDialTimeout bounds the time spent opening each connection,
+// and then the TLS handshake and the greeting of MPD. The dialer
+// given to WithNetDialer bounds the connection itself.
+func WithDialTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.dialTimeout = d
+	}
+}
+
+// WithReadTimeout bounds the time spent waiting for a response
+// on the command connection.
+func WithReadTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.readTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds the time spent sending a command.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.writeTimeout = d
+	}
+}
+
+// WithKeepAlive sets the interval between pings.
+// A zero interval disables pinging.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.keepAlive = interval
+	}
+}
+
+// WithLogger sets the logger of the client. Commands are logged
+// at debug level with their arguments, duration, response size
+// and ACK code.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cfg *config) {
+		cfg.logger = logger
+	}
+}
+
+// WithLogHandler is like WithLogger, creating the logger from h.
+func WithLogHandler(h slog.Handler) Option {
+	return func(cfg *config) {
+		cfg.logger = slog.New(h)
+	}
+}
+
+// WithWireTrace logs at debug level every protocol line sent
+// and received, passwords redacted. Without WithLogger, the lines
+// are logged with slog.Default().
+func WithWireTrace() Option {
+	return func(cfg *config) {
+		cfg.wireTrace = true
+	}
+}
+
+// WithTLS wraps the connections in TLS, for MPD servers
+// behind a TLS terminating proxy such as stunnel.
+// If tlsConfig has no ServerName, the host of the address is used.
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(cfg *config) {
+		cfg.tlsConfig = tlsConfig
+	}
+}
+
+// WithNetDialer sets the dialer used to open the connections.
+func WithNetDialer(dialer NetDialer) Option {
+	return func(cfg *config) {
+		cfg.dialer = dialer
+	}
+}
+
+// WithBinaryLimit sets the maximum size of the binary chunks
+// the server sends (binarylimit command).
+func WithBinaryLimit(size uint) Option {
+	return func(cfg *config) {
+		cfg.binaryLimit = size
+	}
+}
+
+// WithLoops sets which background loops the client starts.
+// All loops are started by default.
+func WithLoops(loops Loop) Option {
+	return func(cfg *config) {
+		cfg.loops = loops
+	}
+}
+
+// WithInterceptors adds interceptors wrapping every command
+// the client sends. The first one is the outermost.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(cfg *config) {
+		cfg.interceptors = append(cfg.interceptors, interceptors...)
+	}
+}
+
+// Dial connects to the MPD server at address on the named network
+// ("tcp", "tcp4", "tcp6" or "unix").
+func Dial(network, address string, opts ...Option) (*MPDClient, error) {
+	cfg := &config{
+		keepAlive: DefaultKeepAlive,
+		loops:     AllLoops,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.wireTrace && cfg.logger == nil {
+		cfg.logger = slog.Default()
+	}
+	return newMPDClient(network, address, cfg)
+}
+
+// deadlineConn sets a deadline on the underlying connection
+// before each read and write.
+type deadlineConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.readTimeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,310 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package exporter exposes the state of a MPD server and the health
+// of the client connected to it as Prometheus metrics.
+//
+// The state is refreshed on the idle events of the server rather than
+// polled; the counters that move continuously (uptime, playtime, elapsed)
+// are extrapolated between events.
+package exporter
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+const DefaultRetryInterval = 5 * time.Second
+
+var stateNames = []string{"play", "pause", "stop"}
+
+type Exporter struct {
+	// Metrics holds the client metrics of the connection to MPD.
+	Metrics *ClientMetrics
+	// RetryInterval is the time waited before reconnecting to MPD.
+	RetryInterval time.Duration
+
+	network string
+	address string
+	opts    []mpdclient.Option
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	mu           sync.Mutex
+	up           bool
+	connected    bool
+	stats        mpdclient.Info
+	statsTime    time.Time
+	status       mpdclient.Info
+	statusTime   time.Time
+	reconnects   uint64
+	idleEvents   map[string]uint64
+	scrapeErrors map[string]uint64
+}
+
+// New creates an exporter for the MPD server at address.
+// opts are passed to mpdclient.Dial when connecting.
+func New(network, address string, opts ...mpdclient.Option) *Exporter {
+	e := &Exporter{
+		Metrics:       NewClientMetrics(),
+		RetryInterval: DefaultRetryInterval,
+		network:       network,
+		address:       address,
+		done:          make(chan struct{}),
+		idleEvents:    make(map[string]uint64),
+		scrapeErrors:  make(map[string]uint64),
+	}
+	e.opts = append(opts, mpdclient.WithInterceptors(e.Metrics.Intercept))
+	return e
+}
+
+// Start connects to MPD and keeps the state up to date,
+// reconnecting when the connection is lost.
+func (e *Exporter) Start() {
+	e.wg.Add(1)
+	go e.run()
+}
+
+func (e *Exporter) Close() {
+	close(e.done)
+	e.wg.Wait()
+}
+
+func (e *Exporter) run() {
+	defer e.wg.Done()
+	for {
+		c, err := mpdclient.Dial(e.network, e.address, e.opts...)
+		if err == nil {
+			e.mu.Lock()
+			if e.connected {
+				e.reconnects++
+			}
+			e.connected = true
+			e.mu.Unlock()
+			e.watch(c)
+			c.Close()
+		}
+		e.mu.Lock()
+		e.up = false
+		e.mu.Unlock()
+
+		select {
+		case <-e.done:
+			return
+		case <-time.After(e.RetryInterval):
+		}
+	}
+}
+
+// watch refreshes the state on the idle events of c,
+// until c loses its connection or the exporter is closed.
+// ACK errors are counted as scrape errors, and only a
+// connection error makes it return.
+func (e *Exporter) watch(c *mpdclient.MPDClient) {
+	events := c.Idle()
+	defer events.Close()
+
+	if err := e.refreshStats(c); err != nil {
+		return
+	}
+	if err := e.refreshStatus(c); err != nil {
+		return
+	}
+	e.mu.Lock()
+	e.up = true
+	e.mu.Unlock()
+
+	for {
+		var err error
+		select {
+		case <-e.done:
+			return
+		case <-c.Lost():
+			return
+		case subsystem := <-events.Ch:
+			e.mu.Lock()
+			e.idleEvents[subsystem]++
+			e.mu.Unlock()
+			switch subsystem {
+			case "database", "update":
+				err = e.refreshStats(c)
+			case "player", "mixer", "options", "playlist":
+				err = e.refreshStatus(c)
+			}
+		}
+		if err != nil {
+			c.Logger.Warn("exporter: connection lost", "error", err)
+			return
+		}
+	}
+}
+
+func (e *Exporter) refreshStats(c *mpdclient.MPDClient) error {
+	stats, err := e.fetch(c, "stats")
+	if stats == nil {
+		return err
+	}
+	e.mu.Lock()
+	e.stats = stats
+	e.statsTime = time.Now()
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Exporter) refreshStatus(c *mpdclient.MPDClient) error {
+	status, err := e.fetch(c, "status")
+	if status == nil {
+		return err
+	}
+	e.mu.Lock()
+	e.status = status
+	e.statusTime = time.Now()
+	e.mu.Unlock()
+	return nil
+}
+
+// fetch sends command and parses its response.
+// It returns an error only if the connection failed; an ACK
+// or a malformed response is counted as a scrape error and
+// gives a nil Info.
+func (e *Exporter) fetch(c *mpdclient.MPDClient, command string) (mpdclient.Info, error) {
+	res := c.Cmd(command)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	var err error
+	info := make(mpdclient.Info)
+	if res.MPDErr != nil {
+		err = res.MPDErr
+	} else {
+		err = info.Fill(res.Data)
+	}
+	if err != nil {
+		c.Logger.Warn("exporter: refresh failed", "command", command, "error", err)
+		e.mu.Lock()
+		e.scrapeErrors[command]++
+		e.mu.Unlock()
+		return nil, nil
+	}
+	return info, nil
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteTo(w)
+}
+
+// WriteTo writes all the metrics in the Prometheus text format.
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	e.mu.Lock()
+	ew := &expositionWriter{w: w}
+	e.writeState(ew)
+	e.mu.Unlock()
+	if ew.err != nil {
+		return ew.n, ew.err
+	}
+	n, err := e.Metrics.WriteTo(w)
+	return ew.n + n, err
+}
+
+func (e *Exporter) writeState(ew *expositionWriter) {
+	now := time.Now()
+	ew.header("mpd_up", "Whether the exporter is connected to MPD.", "gauge")
+	if !e.up {
+		ew.sample("mpd_up", 0)
+	} else {
+		ew.sample("mpd_up", 1)
+		playing := e.status["state"] == "play"
+		sinceStats := now.Sub(e.statsTime).Seconds()
+		sinceStatus := now.Sub(e.statusTime).Seconds()
+
+		e.gauge(ew, e.stats, "artists", "mpd_artists", "Number of artists in the database.", 0)
+		e.gauge(ew, e.stats, "albums", "mpd_albums", "Number of albums in the database.", 0)
+		e.gauge(ew, e.stats, "songs", "mpd_songs", "Number of songs in the database.", 0)
+		e.gauge(ew, e.stats, "uptime", "mpd_uptime_seconds", "Time since MPD started.", sinceStats)
+		var playtime float64
+		if playing {
+			playtime = sinceStats
+		}
+		e.gauge(ew, e.stats, "playtime", "mpd_playtime_seconds", "Time MPD has been playing since it started.", playtime)
+		e.gauge(ew, e.stats, "db_playtime", "mpd_db_playtime_seconds", "Sum of the durations of the songs in the database.", 0)
+		e.gauge(ew, e.stats, "db_update", "mpd_db_update_timestamp_seconds", "Time of the last database update.", 0)
+
+		e.gauge(ew, e.status, "volume", "mpd_volume_percent", "Volume of the mixer.", 0)
+		ew.header("mpd_state", "Player state.", "gauge")
+		for _, state := range stateNames {
+			var v float64
+			if e.status["state"] == state {
+				v = 1
+			}
+			ew.sample("mpd_state", v, "state", state)
+		}
+		e.gauge(ew, e.status, "bitrate", "mpd_bitrate_kbps", "Bitrate of the current song.", 0)
+		e.gauge(ew, e.status, "playlistlength", "mpd_queue_length", "Number of songs in the queue.", 0)
+		var elapsed float64
+		if playing {
+			elapsed = sinceStatus
+		}
+		e.gauge(ew, e.status, "elapsed", "mpd_elapsed_seconds", "Elapsed time of the current song.", elapsed)
+	}
+
+	ew.header("mpd_client_reconnects_total", "Reconnections to MPD.", "counter")
+	ew.sample("mpd_client_reconnects_total", float64(e.reconnects))
+
+	ew.header("mpd_scrape_errors_total", "Commands of the exporter that failed with an ACK or a malformed response.", "counter")
+	commands := make([]string, 0, len(e.scrapeErrors))
+	for command := range e.scrapeErrors {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		ew.sample("mpd_scrape_errors_total", float64(e.scrapeErrors[command]), "command", command)
+	}
+
+	ew.header("mpd_client_idle_events_total", "Idle events received, by subsystem.", "counter")
+	subsystems := make([]string, 0, len(e.idleEvents))
+	for subsystem := range e.idleEvents {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+	for _, subsystem := range subsystems {
+		ew.sample("mpd_client_idle_events_total", float64(e.idleEvents[subsystem]), "subsystem", subsystem)
+	}
+}
+
+// gauge writes the value of key in info, plus offset, as a gauge.
+// Nothing is written if the key is missing or isn't a number.
+func (e *Exporter) gauge(ew *expositionWriter, info mpdclient.Info, key, name, help string, offset float64) {
+	v, ok := info[key]
+	if !ok {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return
+	}
+	ew.header(name, help, "gauge")
+	ew.sample(name, f+offset)
+}
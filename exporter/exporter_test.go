@@ -0,0 +1,74 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package exporter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+func TestExporterScrapeErrors(t *testing.T) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Respond("stats", "songs: 3")
+	s.Fail("status", mpdclient.AckPermission, "you don't have permission for \"status\"")
+
+	e := New("tcp", s.Addr)
+	e.RetryInterval = 10 * time.Millisecond
+	e.Start()
+	defer e.Close()
+
+	scrape := func() string {
+		var buf bytes.Buffer
+		if _, err := e.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(scrape(), "mpd_up 1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for the exporter to be up:\n%s", scrape())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Notify("player")
+	time.Sleep(100 * time.Millisecond)
+
+	out := scrape()
+	for _, expected := range []string{
+		"mpd_up 1",
+		"mpd_songs 3",
+		`mpd_scrape_errors_total{command="status"} 2`,
+		"mpd_client_reconnects_total 0",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Expected %s in:\n%s", expected, out)
+		}
+	}
+}
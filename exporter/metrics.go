@@ -0,0 +1,174 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// DefaultBuckets are the upper bounds, in seconds,
+// of the command latency histogram buckets.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// ClientMetrics collects client-side metrics of the commands
+// sent by the clients it intercepts.
+type ClientMetrics struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	latencies map[string]*histogram
+	ackErrors map[uint]uint64
+}
+
+func NewClientMetrics() *ClientMetrics {
+	return &ClientMetrics{
+		buckets:   DefaultBuckets,
+		latencies: make(map[string]*histogram),
+		ackErrors: make(map[uint]uint64),
+	}
+}
+
+// Intercept is an mpdclient.Interceptor recording the latency
+// of each command, and the ACK errors returned by MPD.
+func (m *ClientMetrics) Intercept(cmd *mpdclient.Command, next mpdclient.Invoker) *mpdclient.Response {
+	start := time.Now()
+	res := next(cmd)
+	m.observe(cmd.Name, time.Since(start), res)
+	return res
+}
+
+func (m *ClientMetrics) observe(command string, d time.Duration, res *mpdclient.Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.latencies[command]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latencies[command] = h
+	}
+	seconds := d.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+	if res.MPDErr != nil {
+		m.ackErrors[res.MPDErr.Ack]++
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *ClientMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ew := &expositionWriter{w: w}
+
+	ew.header("mpd_client_command_duration_seconds", "Latency of the commands sent to MPD.", "histogram")
+	commands := make([]string, 0, len(m.latencies))
+	for command := range m.latencies {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		h := m.latencies[command]
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += h.counts[i]
+			ew.sample("mpd_client_command_duration_seconds_bucket", float64(cumulative), "command", command, "le", formatFloat(bound))
+		}
+		ew.sample("mpd_client_command_duration_seconds_bucket", float64(h.count), "command", command, "le", "+Inf")
+		ew.sample("mpd_client_command_duration_seconds_sum", h.sum, "command", command)
+		ew.sample("mpd_client_command_duration_seconds_count", float64(h.count), "command", command)
+	}
+
+	ew.header("mpd_client_ack_errors_total", "ACK errors returned by MPD, by code.", "counter")
+	codes := make([]int, 0, len(m.ackErrors))
+	for code := range m.ackErrors {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		ew.sample("mpd_client_ack_errors_total", float64(m.ackErrors[uint(code)]), "code", strconv.Itoa(code))
+	}
+	return ew.n, ew.err
+}
+
+// expositionWriter writes metrics in the Prometheus text format,
+// keeping the first error.
+type expositionWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (ew *expositionWriter) printf(format string, a ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(ew.w, format, a...)
+	ew.n += int64(n)
+	ew.err = err
+}
+
+func (ew *expositionWriter) header(name, help, typ string) {
+	ew.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample; labels are name/value pairs.
+func (ew *expositionWriter) sample(name string, value float64, labels ...string) {
+	if len(labels) == 0 {
+		ew.printf("%s %s\n", name, formatFloat(value))
+		return
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	ew.printf("%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
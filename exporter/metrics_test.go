@@ -0,0 +1,59 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package exporter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+func TestClientMetrics(t *testing.T) {
+	m := NewClientMetrics()
+	ok := func(cmd *mpdclient.Command) *mpdclient.Response {
+		return &mpdclient.Response{}
+	}
+	ack := func(cmd *mpdclient.Command) *mpdclient.Response {
+		time.Sleep(2 * time.Millisecond)
+		return &mpdclient.Response{MPDErr: &mpdclient.MPDError{Ack: mpdclient.AckNoExist}}
+	}
+	m.Intercept(&mpdclient.Command{Name: "status"}, ok)
+	m.Intercept(&mpdclient.Command{Name: "status"}, ok)
+	m.Intercept(&mpdclient.Command{Name: "play"}, ack)
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		`mpd_client_command_duration_seconds_count{command="status"} 2`,
+		`mpd_client_command_duration_seconds_bucket{command="play",le="0.001"} 0`,
+		`mpd_client_command_duration_seconds_bucket{command="play",le="+Inf"} 1`,
+		`mpd_client_ack_errors_total{code="50"} 1`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Expected %s in:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+// Package failover keeps a client connected to the first healthy
+// of several MPD servers. When the active server stops answering pings
+// or the connection drops, the client switches to the next one, and
+// moves the queue and the playback position of the last snapshot to it.
+//
+//	f := failover.New([]failover.Endpoint{
+//		{"tcp", "mpd1.lan:6600"},
+//		{"tcp", "mpd2.lan:6600"},
+//	}, mpdclient.WithPassword(password))
+//	f.OnSwitch = func(s *failover.Switch) { log.Print(s) }
+//	err := f.Start()
+//	defer f.Close()
+//	err = f.Current().Play(-1)
+package failover
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// Endpoint is the address of a MPD server.
+type Endpoint struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
+
+func (e Endpoint) String() string {
+	return e.Network + "/" + e.Address
+}
+
+// Switch describes a switch from a server to another.
+type Switch struct {
+	From Endpoint
+	To   Endpoint
+	// Err is the reason From was left.
+	Err error
+	// RestoreErr is the error restoring the snapshot on To, if any.
+	RestoreErr error
+}
+
+func (s *Switch) String() string {
+	msg := fmt.Sprintf("Switched from %s to %s: %v", s.From, s.To, s.Err)
+	if s.RestoreErr != nil {
+		msg += fmt.Sprintf(" (restore failed: %v)", s.RestoreErr)
+	}
+	return msg
+}
+
+// Client is a MPD client failing over several servers,
+// in order of preference.
+type Client struct {
+	// Interval is the interval between pings of the active server.
+	Interval time.Duration
+	// PingTimeout is the time after which a ping is a failure.
+	PingTimeout time.Duration
+	// OnSwitch is called after each switch to another server.
+	OnSwitch func(s *Switch)
+	Logger   *slog.Logger
+
+	endpoints []Endpoint
+	opts      []mpdclient.Option
+
+	mu       sync.Mutex
+	c        *mpdclient.MPDClient
+	active   int
+	snapshot *mpdclient.Snapshot
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New returns a client for endpoints, the first being preferred.
+// The opts are used to dial all of them.
+func New(endpoints []Endpoint, opts ...mpdclient.Option) *Client {
+	return &Client{
+		Interval:    5 * time.Second,
+		PingTimeout: 5 * time.Second,
+		Logger:      slog.New(slog.DiscardHandler),
+		endpoints:   endpoints,
+		opts:        opts,
+	}
+}
+
+// Start connects to the first healthy server and starts watching it.
+func (f *Client) Start() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done != nil {
+		return errors.New("Failover client already started")
+	}
+	var lastErr error
+	for i := range f.endpoints {
+		c, err := f.dial(i)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		f.c, f.active = c, i
+		f.done = make(chan struct{})
+		f.wg.Add(1)
+		go f.run(f.done)
+		return nil
+	}
+	return errors.New(fmt.Sprintf("No MPD server reachable: %v", lastErr))
+}
+
+// Close stops watching the servers and closes the current client.
+func (f *Client) Close() error {
+	f.mu.Lock()
+	done := f.done
+	f.done = nil
+	f.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	close(done)
+	f.wg.Wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.c.Close()
+}
+
+// Current returns the client of the active server. It is closed
+// after a switch, so it should not be kept around.
+func (f *Client) Current() *mpdclient.MPDClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.c
+}
+
+// Active returns the endpoint of the active server.
+func (f *Client) Active() Endpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.endpoints[f.active]
+}
+
+// Snapshot returns the last snapshot of the active server, or nil.
+func (f *Client) Snapshot() *mpdclient.Snapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.snapshot
+}
+
+// dial connects to the endpoint i and checks it answers pings.
+func (f *Client) dial(i int) (*mpdclient.MPDClient, error) {
+	e := f.endpoints[i]
+	c, err := mpdclient.Dial(e.Network, e.Address, f.opts...)
+	if err != nil {
+		f.Logger.Warn("dial failed", "endpoint", e, "error", err)
+		return nil, err
+	}
+	if err := f.ping(c); err != nil {
+		f.Logger.Warn("ping failed", "endpoint", e, "error", err)
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// ping pings c, failing after PingTimeout. Only the network errors
+// are failures, MPD answering with an error is fine.
+func (f *Client) ping(c *mpdclient.MPDClient) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Ping()
+	}()
+	select {
+	case err := <-errCh:
+		if _, ok := err.(*mpdclient.MPDError); ok {
+			return nil
+		}
+		return err
+	case <-time.After(f.PingTimeout):
+		return errors.New(fmt.Sprintf("No answer to ping after %v", f.PingTimeout))
+	}
+}
+
+func (f *Client) run(done chan struct{}) {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+	for {
+		err := f.watch(f.Current(), ticker, done)
+		if err == nil {
+			return
+		}
+		if !f.failover(err, ticker, done) {
+			return
+		}
+	}
+}
+
+// watch snapshots c on changes, until it fails or done is closed.
+// It returns the failure, or nil when done.
+func (f *Client) watch(c *mpdclient.MPDClient, ticker *time.Ticker, done chan struct{}) error {
+	events := c.Idle("playlist", "player", "options", "mixer")
+	defer events.Close()
+	f.takeSnapshot(c)
+	for {
+		select {
+		case <-events.Ch:
+			f.takeSnapshot(c)
+		case <-ticker.C:
+			if err := f.ping(c); err != nil {
+				return err
+			}
+		case <-c.Lost():
+			return c.Err()
+		case <-done:
+			return nil
+		}
+	}
+}
+
+func (f *Client) takeSnapshot(c *mpdclient.MPDClient) {
+	s, err := c.Snapshot()
+	if err != nil {
+		f.Logger.Warn("snapshot failed", "error", err)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.snapshot = s
+}
+
+// failover switches to the next healthy server after the active one,
+// trying them all on each tick until one answers. It returns false
+// if done is closed first.
+func (f *Client) failover(cause error, ticker *time.Ticker, done chan struct{}) bool {
+	f.mu.Lock()
+	from, old := f.active, f.c
+	f.mu.Unlock()
+	f.Logger.Error("server failed", "endpoint", f.endpoints[from], "error", cause)
+	for {
+		for n := 1; n <= len(f.endpoints); n++ {
+			i := (from + n) % len(f.endpoints)
+			c, err := f.dial(i)
+			if err != nil {
+				continue
+			}
+			s := &Switch{From: f.endpoints[from], To: f.endpoints[i], Err: cause}
+			s.RestoreErr = f.restore(c)
+			f.mu.Lock()
+			f.c, f.active = c, i
+			f.mu.Unlock()
+			old.Close()
+			f.Logger.Info("switched server", "from", s.From, "to", s.To, "restore_error", s.RestoreErr)
+			if f.OnSwitch != nil {
+				f.OnSwitch(s)
+			}
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			return false
+		}
+	}
+}
+
+// restore puts the last snapshot on c, the elapsed time moved forward
+// by the time spent since it was taken if it was playing.
+func (f *Client) restore(c *mpdclient.MPDClient) error {
+	f.mu.Lock()
+	snapshot := f.snapshot
+	f.mu.Unlock()
+	if snapshot == nil {
+		return nil
+	}
+	s := *snapshot
+	if s.Player.State == mpdclient.StatePlay {
+		s.Player.Elapsed += time.Since(s.Time)
+	}
+	return c.Restore(&s)
+}
@@ -0,0 +1,105 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package failover
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+func newServer(t *testing.T) *mpdtest.Server {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	s.Respond("playlistinfo", "")
+	s.Respond("status", "state: stop\nvolume: 50")
+	s.Respond("replay_gain_status", "replay_gain_mode: off")
+	for _, cmd := range []string{"stop", "clear", "random", "repeat", "crossfade", "setvol", "replay_gain_mode", "seekid", "pause"} {
+		s.Respond(cmd, "")
+	}
+	s.Respond("addid", "Id: 7")
+	return s
+}
+
+func TestFailover(t *testing.T) {
+	primary, secondary := newServer(t), newServer(t)
+	primary.Respond("playlistinfo", "file: a.ogg\nPos: 0\nId: 1")
+	primary.Respond("status", "state: pause\nsong: 0\nsongid: 1\nelapsed: 42.000\nvolume: 50")
+
+	f := New([]Endpoint{
+		{"tcp", "127.0.0.1:1"},
+		{"tcp", primary.Addr},
+		{"tcp", secondary.Addr},
+	}, mpdclient.WithDialTimeout(time.Second))
+	f.Interval = 50 * time.Millisecond
+	switches := make(chan *Switch, 1)
+	f.OnSwitch = func(s *Switch) { switches <- s }
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Active().Address != primary.Addr {
+		t.Fatalf("Expected to start on %s, got %s", primary.Addr, f.Active())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Snapshot() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for a snapshot")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	primary.Close()
+	select {
+	case s := <-switches:
+		if s.From.Address != primary.Addr || s.To.Address != secondary.Addr || s.Err == nil || s.RestoreErr != nil {
+			t.Fatalf("Unexpected switch %v", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for a switch")
+	}
+	if f.Active().Address != secondary.Addr {
+		t.Fatalf("Expected to switch to %s, got %s", secondary.Addr, f.Active())
+	}
+	var cmds []string
+	for _, cmd := range secondary.Commands() {
+		switch cmd.Name {
+		case "addid", "seekid", "pause":
+			cmds = append(cmds, cmd.String())
+		}
+	}
+	expected := []string{`addid "a.ogg"`, `seekid "7" "42.000"`, `pause "1"`}
+	if strings.Join(cmds, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected %v, got %v", expected, cmds)
+	}
+}
+
+func TestNoServer(t *testing.T) {
+	f := New([]Endpoint{{"tcp", "127.0.0.1:1"}})
+	if err := f.Start(); err == nil {
+		f.Close()
+		t.Fatal("Expected an error")
+	}
+}
@@ -0,0 +1,357 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// StateEvent is the subsystem of the events carrying the current
+// state, sent first to new streams and to the resumed streams
+// whose missed events are no longer kept.
+const StateEvent = "state"
+
+// Event is an idle event of MPD, with the state of the player
+// for the subsystems affecting it.
+type Event struct {
+	// Id is the sequence number of the event.
+	Id        uint64    `json:"id"`
+	Subsystem string    `json:"subsystem"`
+	Time      time.Time `json:"time"`
+	// Status is set for the player, mixer, options, playlist
+	// and state events.
+	Status *mpdclient.PlayerState `json:"status,omitempty"`
+	// Song is the current song, set for the player, playlist
+	// and state events when there is one.
+	Song *mpdclient.Song `json:"song,omitempty"`
+}
+
+// Events streams the idle events of MPD to HTTP clients,
+// as Server-Sent Events or WebSocket text messages.
+//
+// Clients pick the subsystems with the subsystem query parameter
+// (e.g. ?subsystem=player,mixer), and resume a stream from the
+// Last-Event-ID header or the last_event_id query parameter.
+type Events struct {
+	// History is the number of events kept to resume streams.
+	History int
+	// KeepAlive is the interval between the keep-alive
+	// messages of the streams.
+	KeepAlive time.Duration
+	Logger    *slog.Logger
+
+	mu      sync.Mutex
+	seq     uint64
+	history []*Event
+	state   Event
+	streams map[*eventStream]struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// eventStream is the queue of events of a client.
+type eventStream struct {
+	subsystems []string
+	ch         chan *Event
+}
+
+func (s *eventStream) wants(subsystem string) bool {
+	if len(s.subsystems) == 0 || subsystem == StateEvent {
+		return true
+	}
+	for _, wanted := range s.subsystems {
+		if wanted == subsystem {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEvents returns an event stream handler keeping
+// the last 256 events.
+func NewEvents() *Events {
+	return &Events{
+		History:   256,
+		KeepAlive: 15 * time.Second,
+		Logger:    slog.New(slog.DiscardHandler),
+		streams:   make(map[*eventStream]struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Watch publishes the idle events of c, until c loses its connection
+// or the handler is closed. Sequence numbers go on across calls,
+// so Watch can be called again after a reconnection.
+func (e *Events) Watch(c *mpdclient.MPDClient) error {
+	events := c.Idle()
+	defer events.Close()
+
+	e.mu.Lock()
+	e.state.Time = time.Now()
+	e.mu.Unlock()
+	e.refresh(c, "player")
+
+	for {
+		select {
+		case <-e.done:
+			return nil
+		case <-c.Lost():
+			return c.Err()
+		case subsystem := <-events.Ch:
+			e.publish(c, subsystem)
+		}
+	}
+}
+
+// Close ends Watch and the streams, and refuses new ones.
+func (e *Events) Close() {
+	e.once.Do(func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		close(e.done)
+		for s := range e.streams {
+			close(s.ch)
+			delete(e.streams, s)
+		}
+	})
+}
+
+var errEventsClosed = errors.New("events closed")
+
+// refresh updates the state affected by a change of subsystem.
+func (e *Events) refresh(c *mpdclient.MPDClient, subsystem string) (*mpdclient.PlayerState, *mpdclient.Song) {
+	var status *mpdclient.PlayerState
+	var song *mpdclient.Song
+	var err error
+	switch subsystem {
+	case "player", "playlist":
+		if song, err = c.Playing(); err != nil {
+			e.Logger.Warn("current song refresh failed", "error", err)
+			return nil, nil
+		}
+		fallthrough
+	case "mixer", "options":
+		if status, err = c.PlayerState(); err != nil {
+			e.Logger.Warn("status refresh failed", "error", err)
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.state.Status = status
+	if subsystem == "player" || subsystem == "playlist" {
+		e.state.Song = song
+	}
+	return status, song
+}
+
+func (e *Events) publish(c *mpdclient.MPDClient, subsystem string) {
+	status, song := e.refresh(c, subsystem)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.seq++
+	ev := &Event{Id: e.seq, Subsystem: subsystem, Time: time.Now(), Status: status, Song: song}
+	e.state.Id, e.state.Time = ev.Id, ev.Time
+	e.history = append(e.history, ev)
+	if len(e.history) > e.History {
+		e.history = e.history[len(e.history)-e.History:]
+	}
+	for s := range e.streams {
+		if !s.wants(subsystem) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			// Too slow, the client resumes after a reconnection
+			close(s.ch)
+			delete(e.streams, s)
+		}
+	}
+}
+
+// subscribe registers a stream, and returns the events to send first:
+// the events after lastId if it is set and they are all kept,
+// the current state otherwise.
+// It fails once the handler is closed.
+func (e *Events) subscribe(s *eventStream, lastId string) ([]*Event, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case <-e.done:
+		return nil, errEventsClosed
+	default:
+	}
+	e.streams[s] = struct{}{}
+
+	if id, err := strconv.ParseUint(lastId, 10, 64); err == nil && id <= e.seq {
+		if id == e.seq {
+			return nil, nil
+		}
+		if len(e.history) > 0 && e.history[0].Id <= id+1 {
+			var missed []*Event
+			for _, ev := range e.history {
+				if ev.Id > id && s.wants(ev.Subsystem) {
+					missed = append(missed, ev)
+				}
+			}
+			return missed, nil
+		}
+	}
+	state := e.state
+	state.Id = e.seq
+	state.Subsystem = StateEvent
+	return []*Event{&state}, nil
+}
+
+func (e *Events) unsubscribe(s *eventStream) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.streams, s)
+}
+
+// sender sends the events of a stream to a client.
+type sender interface {
+	send(ev *Event) error
+	keepAlive() error
+	// closed is closed when the client goes away.
+	closed() <-chan struct{}
+}
+
+func (e *Events) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var subsystems []string
+	for _, v := range query["subsystem"] {
+		for _, subsystem := range strings.Split(v, ",") {
+			if subsystem != "" {
+				subsystems = append(subsystems, subsystem)
+			}
+		}
+	}
+	lastId := r.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = query.Get("last_event_id")
+	}
+	select {
+	case <-e.done:
+		writeError(w, errEventsClosed)
+		return
+	default:
+	}
+
+	var snd sender
+	if isWebSocket(r) {
+		ws, err := upgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		snd = ws
+	} else {
+		sse, err := newSSE(w, r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		snd = sse
+	}
+
+	s := &eventStream{subsystems: subsystems, ch: make(chan *Event, 64)}
+	backlog, err := e.subscribe(s, lastId)
+	if err != nil {
+		return
+	}
+	defer e.unsubscribe(s)
+	for _, ev := range backlog {
+		if err := snd.send(ev); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(e.KeepAlive)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case ev, ok := <-s.ch:
+			if !ok {
+				return
+			}
+			err = snd.send(ev)
+		case <-ticker.C:
+			err = snd.keepAlive()
+		case <-snd.closed():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sse sends events as Server-Sent Events.
+type sse struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+	r  *http.Request
+}
+
+func newSSE(w http.ResponseWriter, r *http.Request) (*sse, error) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	s := &sse{w, http.NewResponseController(w), r}
+	return s, s.rc.Flush()
+}
+
+func (s *sse) send(ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Id, ev.Subsystem, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sse) keepAlive() error {
+	if _, err := fmt.Fprint(s.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sse) closed() <-chan struct{} {
+	return s.r.Context().Done()
+}
@@ -0,0 +1,231 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+// watchFake starts watching the events of a fake server.
+func watchFake(t *testing.T) (*mpdtest.Server, *Events) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	s.Respond("status", "volume: 50\nstate: play\nsong: 0\nsongid: 1\nelapsed: 1.000")
+	s.Respond("currentsong", "file: a.ogg\nTitle: A\nPos: 0\nId: 1")
+	s.Respond("replay_gain_status", "replay_gain_mode: off")
+	c, err := mpdclient.Dial("tcp", s.Addr, mpdclient.WithLoops(mpdclient.IdleLoop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	e := NewEvents()
+	t.Cleanup(e.Close)
+	go e.Watch(c)
+	for i := 0; ; i++ {
+		e.mu.Lock()
+		ready := e.state.Status != nil
+		e.mu.Unlock()
+		if ready {
+			break
+		}
+		if i == 100 {
+			t.Fatal("Events never watched the client")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s, e
+}
+
+// waitSeq waits for the events to reach sequence number seq.
+func waitSeq(t *testing.T, e *Events, seq uint64) {
+	for i := 0; i < 100; i++ {
+		e.mu.Lock()
+		cur := e.seq
+		e.mu.Unlock()
+		if cur >= seq {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d events", seq)
+}
+
+// readSSE reads the next event of a Server-Sent Events stream.
+func readSSE(t *testing.T, r *bufio.Reader) (id, name string, ev Event) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && name != "" {
+			return
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			name = value
+		case "data":
+			if err := json.Unmarshal([]byte(value), &ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func getSSE(t *testing.T, url, lastId string) *bufio.Reader {
+	req, _ := http.NewRequest("GET", url, nil)
+	if lastId != "" {
+		req.Header.Set("Last-Event-ID", lastId)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", ct)
+	}
+	return bufio.NewReader(res.Body)
+}
+
+func TestEventsSSE(t *testing.T) {
+	s, e := watchFake(t)
+	e.History = 1
+	ts := httptest.NewServer(e)
+	t.Cleanup(ts.Close)
+
+	stream := getSSE(t, ts.URL+"?subsystem=player", "")
+	_, name, ev := readSSE(t, stream)
+	if name != StateEvent || ev.Status == nil || ev.Status.Volume != 50 || ev.Song == nil || ev.Song.File != "a.ogg" {
+		t.Fatalf("Unexpected first event %s %+v", name, ev)
+	}
+
+	s.Notify("mixer")
+	waitSeq(t, e, 1)
+	s.Respond("currentsong", "file: b.ogg\nPos: 1\nId: 2")
+	s.Notify("player")
+	id, name, ev := readSSE(t, stream)
+	if id != "2" || name != "player" || ev.Song == nil || ev.Song.File != "b.ogg" {
+		t.Fatalf("Expected the player event 2, got %s %s %+v", id, name, ev)
+	}
+
+	// Event 2 is kept
+	stream = getSSE(t, ts.URL, "1")
+	if id, name, _ := readSSE(t, stream); id != "2" || name != "player" {
+		t.Fatalf("Expected to resume at event 2, got %s %s", id, name)
+	}
+	// Event 1 is not
+	stream = getSSE(t, ts.URL, "0")
+	if id, name, ev := readSSE(t, stream); id != "2" || name != StateEvent || ev.Song.File != "b.ogg" {
+		t.Fatalf("Expected the state at event 2, got %s %s %+v", id, name, ev)
+	}
+}
+
+func TestEventsWebSocket(t *testing.T) {
+	s, e := watchFake(t)
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	io.WriteString(conn, "GET /?subsystem=options HTTP/1.1\r\nHost: localhost\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: "+key+"\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected %d, got %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+	// The example of RFC 6455
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected Sec-WebSocket-Accept %s", accept)
+	}
+
+	readMessage := func() (byte, []byte) {
+		var header [2]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			t.Fatal(err)
+		}
+		n := int(header[1])
+		if n == 126 {
+			var ext [2]byte
+			io.ReadFull(r, ext[:])
+			n = int(ext[0])<<8 | int(ext[1])
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			t.Fatal(err)
+		}
+		return header[0] & 0xf, payload
+	}
+	var ev Event
+	if op, payload := readMessage(); op != opText || json.Unmarshal(payload, &ev) != nil || ev.Subsystem != StateEvent {
+		t.Fatalf("Expected the state event, got %d %s", op, payload)
+	}
+	s.Notify("options")
+	if op, payload := readMessage(); op != opText || json.Unmarshal(payload, &ev) != nil || ev.Subsystem != "options" || ev.Id != 1 {
+		t.Fatalf("Expected the options event, got %d %s", op, payload)
+	}
+
+	// Masked close frame, with an empty payload
+	conn.Write([]byte{0x80 | opClose, 0x80, 1, 2, 3, 4})
+	if op, _ := readMessage(); op != opClose {
+		t.Fatalf("Expected a close frame, got %d", op)
+	}
+}
+
+func TestEventsClose(t *testing.T) {
+	e := NewEvents()
+	e.Close()
+	e.Close()
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if _, err := e.subscribe(&eventStream{ch: make(chan *Event, 1)}, ""); err == nil || len(e.streams) != 0 {
+		t.Fatal("Expected no subscription once closed")
+	}
+}
@@ -0,0 +1,197 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package httpapi exposes a MPD server as a JSON REST API,
+// for the clients which can't speak the MPD protocol.
+//
+// The API is described in OpenAPI format at /openapi.json.
+// The idle events are streamed at /events, see Events.
+package httpapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Server serves the API. It is an http.Handler.
+type Server struct {
+	// Events streams the idle events at /events,
+	// once watching the client.
+	Events *Events
+
+	mu  sync.RWMutex
+	c   *mpdclient.MPDClient
+	mux *http.ServeMux
+}
+
+// New returns a server for c, which may be nil until SetClient is called.
+func New(c *mpdclient.MPDClient) *Server {
+	s := &Server{Events: NewEvents(), c: c, mux: http.NewServeMux()}
+	s.routes()
+	return s
+}
+
+// SetClient replaces the client of the server,
+// after a reconnection for example.
+func (s *Server) SetClient(c *mpdclient.MPDClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c = c
+}
+
+func (s *Server) client() *mpdclient.MPDClient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.c
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handlerFunc is a handler with the client, whose error
+// is written as a JSON error.
+type handlerFunc func(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error
+
+func (s *Server) handle(pattern string, h handlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		c := s.client()
+		if c == nil {
+			writeError(w, errNotConnected)
+			return
+		}
+		rw := &responseWriter{ResponseWriter: w}
+		// Once the response is started, an error can't be
+		// written anymore: the client went away.
+		if err := h(c, rw, r); err != nil && !rw.started {
+			writeError(w, err)
+		}
+	})
+}
+
+// responseWriter records whether the response was started.
+type responseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
+
+var errNotConnected = errors.New("not connected to MPD")
+
+// badRequest is an error of the request itself.
+type badRequest struct {
+	err error
+}
+
+func (e *badRequest) Error() string {
+	return e.err.Error()
+}
+
+// StatusCode returns the HTTP status code for an error of the client.
+// MPD errors map by ACK code.
+func StatusCode(err error) int {
+	var mpdErr *mpdclient.MPDError
+	var unsupported *mpdclient.ErrUnsupported
+	var bad *badRequest
+	switch {
+	case errors.As(err, &mpdErr):
+		switch mpdErr.Ack {
+		case mpdclient.AckNotList, mpdclient.AckArg, mpdclient.AckUnknown:
+			return http.StatusBadRequest
+		case mpdclient.AckPassword:
+			return http.StatusUnauthorized
+		case mpdclient.AckPermission:
+			return http.StatusForbidden
+		case mpdclient.AckNoExist:
+			return http.StatusNotFound
+		case mpdclient.AckPlaylistMax, mpdclient.AckUpdateAlready, mpdclient.AckPlayerSync, mpdclient.AckExist:
+			return http.StatusConflict
+		}
+		return http.StatusInternalServerError
+	case errors.As(err, &unsupported):
+		return http.StatusNotImplemented
+	case errors.As(err, &bad):
+		return http.StatusBadRequest
+	case err == errNotConnected, err == errEventsClosed:
+		return http.StatusServiceUnavailable
+	}
+	// Errors of the connection to MPD
+	return http.StatusBadGateway
+}
+
+// Error is the body of the error responses.
+type Error struct {
+	Error string `json:"error"`
+	// Ack is the ACK code of MPD errors.
+	Ack uint `json:"ack,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	body := Error{Error: err.Error()}
+	var mpdErr *mpdclient.MPDError
+	if errors.As(err, &mpdErr) {
+		body.Ack = mpdErr.Ack
+		body.Error = mpdErr.MessageText
+	}
+	writeJSON(w, StatusCode(err), body)
+}
+
+// writeJSON encodes v before writing the headers, so that
+// an encoding error can still be sent as an error response.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// decode decodes the JSON body of r into v.
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return &badRequest{err}
+	}
+	return nil
+}
+
+func noContent(w http.ResponseWriter) error {
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
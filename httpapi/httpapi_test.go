@@ -0,0 +1,137 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//go:debug httpmuxgo121=0
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{&mpdclient.MPDError{Ack: mpdclient.AckNoExist}, http.StatusNotFound},
+		{&mpdclient.MPDError{Ack: mpdclient.AckArg}, http.StatusBadRequest},
+		{&mpdclient.MPDError{Ack: mpdclient.AckPermission}, http.StatusForbidden},
+		{&mpdclient.MPDError{Ack: mpdclient.AckExist}, http.StatusConflict},
+		{&mpdclient.MPDError{Ack: mpdclient.AckSystem}, http.StatusInternalServerError},
+		{fmt.Errorf("albumart: %w", &mpdclient.ErrUnsupported{}), http.StatusNotImplemented},
+		{&badRequest{errors.New("bad")}, http.StatusBadRequest},
+		{errNotConnected, http.StatusServiceUnavailable},
+		{errors.New("connection reset"), http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		if code := StatusCode(test.err); code != test.code {
+			t.Errorf("Expected %d for %v, got %d", test.code, test.err, code)
+		}
+	}
+}
+
+func TestNotConnected(t *testing.T) {
+	s := New(nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var body Error
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error == "" {
+		t.Fatal("Expected an error message")
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	var spec map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&spec); err != nil {
+		t.Fatalf("Invalid OpenAPI description: %v", err)
+	}
+}
+
+func TestLineBreaks(t *testing.T) {
+	fake, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	fake.Respond("sticker", "sticker: rating=5")
+	c, err := mpdclient.Dial("tcp", fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s := New(c)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/queue", strings.NewReader(`{"uri": "a.ogg\nclear"}`)),
+		httptest.NewRequest("GET", "/database/find?Artist="+url.QueryEscape("Air\r\nclear"), nil),
+		httptest.NewRequest("GET", "/stickers?name=rating&uri="+url.QueryEscape("a.ogg\nclear"), nil),
+		httptest.NewRequest("PUT", "/stickers", strings.NewReader(`{"uri": "a.ogg", "name": "rating", "value": "5\nclear"}`)),
+		httptest.NewRequest("DELETE", "/playlists/"+url.PathEscape("a\nclear"), nil),
+		httptest.NewRequest("PUT", "/playlists/a", strings.NewReader(`{"uris": ["a.ogg", "b.ogg\nclear"]}`)),
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s %s: expected %d, got %d", req.Method, req.URL, http.StatusBadRequest, w.Code)
+		}
+	}
+	if cmds := fake.Commands(); len(cmds) != 0 {
+		t.Fatalf("Expected no command sent, got %v", cmds)
+	}
+
+	// Quotes are escaped
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/stickers?name=rating&uri="+url.QueryEscape(`a" "b.ogg`), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+	cmds := fake.Commands()
+	expected := []string{"get", "song", `a" "b.ogg`, "rating"}
+	if len(cmds) != 1 || !reflect.DeepEqual(cmds[0].Args, expected) {
+		t.Fatalf("Expected sticker %q, got %v", expected, cmds)
+	}
+}
+
+func TestWriteJSONError(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := writeJSON(w, http.StatusOK, func() {}); err == nil {
+		t.Fatal("Expected an encoding error")
+	}
+	// Nothing is written, the error response can follow
+	if w.Body.Len() != 0 || len(w.Header()) != 0 {
+		t.Fatalf("Unexpected response %d %v %q", w.Code, w.Header(), w.Body)
+	}
+}
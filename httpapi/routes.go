@@ -0,0 +1,400 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPI)
+	})
+
+	s.mux.Handle("GET /events", s.Events)
+
+	s.handle("GET /status", getStatus)
+	s.handle("GET /currentsong", getCurrentSong)
+	s.handle("GET /stats", getStats)
+
+	s.handle("GET /queue", getQueue)
+	s.handle("POST /queue", postQueue)
+	s.handle("DELETE /queue", deleteQueue)
+	s.handle("DELETE /queue/{id}", deleteQueueSong)
+
+	s.handle("POST /player/{action}", postPlayer)
+	s.handle("PATCH /player/options", patchOptions)
+
+	s.handle("GET /database/find", getFind(false))
+	s.handle("GET /database/search", getFind(true))
+
+	s.handle("GET /stickers", getSticker)
+	s.handle("PUT /stickers", putSticker)
+	s.handle("GET /stickers/find", getStickerFind)
+
+	s.handle("GET /playlists", getPlaylists)
+	s.handle("GET /playlists/{name}", getPlaylist)
+	s.handle("PUT /playlists/{name}", putPlaylist)
+	s.handle("DELETE /playlists/{name}", deletePlaylist)
+	s.handle("POST /playlists/{name}/load", loadPlaylist)
+
+	s.handle("GET /albumart", getAlbumArt)
+}
+
+func getStatus(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	state, err := c.PlayerState()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, state)
+}
+
+func getCurrentSong(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	song, err := c.Playing()
+	if err != nil {
+		return err
+	}
+	if song == nil {
+		return writeJSON(w, http.StatusNotFound, Error{Error: "no current song"})
+	}
+	return writeJSON(w, http.StatusOK, song)
+}
+
+func getStats(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	stats, err := c.Stats()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, stats)
+}
+
+func getQueue(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	songs, err := c.Queue()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, songs)
+}
+
+type queueAdd struct {
+	URI string `json:"uri"`
+	// Pos is the position to add the song at, the end if nil.
+	Pos *int `json:"pos"`
+}
+
+func postQueue(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	var req queueAdd
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	pos := -1
+	if req.Pos != nil {
+		pos = *req.Pos
+	}
+	id, err := c.AddId(req.URI, pos)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, map[string]int{"id": id})
+}
+
+func deleteQueue(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	if err := c.Clear(); err != nil {
+		return err
+	}
+	return noContent(w)
+}
+
+func deleteQueueSong(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return &badRequest{err}
+	}
+	if err := c.DeleteId(id); err != nil {
+		return err
+	}
+	return noContent(w)
+}
+
+type playerRequest struct {
+	// Pos is the song to play, for play.
+	Pos *int `json:"pos"`
+	// Id and Position are the song and the time to seek to, in
+	// seconds, for seek.
+	Id       int     `json:"id"`
+	Position float64 `json:"position"`
+}
+
+func postPlayer(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	var req playerRequest
+	if r.ContentLength > 0 {
+		if err := decode(r, &req); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch action := r.PathValue("action"); action {
+	case "play":
+		pos := -1
+		if req.Pos != nil {
+			pos = *req.Pos
+		}
+		err = c.Play(pos)
+	case "pause":
+		err = c.Pause(true)
+	case "resume":
+		err = c.Pause(false)
+	case "stop":
+		err = c.Stop()
+	case "next":
+		err = c.Next()
+	case "previous":
+		err = c.Previous()
+	case "seek":
+		err = c.SeekId(req.Id, time.Duration(req.Position*float64(time.Second)))
+	default:
+		return &badRequest{errors.New(fmt.Sprintf("Unknown action: %s", action))}
+	}
+	if err != nil {
+		return err
+	}
+	return noContent(w)
+}
+
+// options are the player options to change, those left nil
+// are left as is.
+type options struct {
+	Random     *bool    `json:"random"`
+	Repeat     *bool    `json:"repeat"`
+	Single     *string  `json:"single"`
+	Consume    *string  `json:"consume"`
+	Crossfade  *float64 `json:"crossfade"`
+	Volume     *int     `json:"volume"`
+	ReplayGain *string  `json:"replay_gain"`
+}
+
+func patchOptions(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	var req options
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	var err error
+	set := func(f func() error) {
+		if err == nil {
+			err = f()
+		}
+	}
+	if req.Random != nil {
+		set(func() error { return c.SetRandom(*req.Random) })
+	}
+	if req.Repeat != nil {
+		set(func() error { return c.SetRepeat(*req.Repeat) })
+	}
+	if req.Single != nil {
+		set(func() error { return c.SetSingle(mpdclient.PlaybackMode(*req.Single)) })
+	}
+	if req.Consume != nil {
+		set(func() error { return c.SetConsume(mpdclient.PlaybackMode(*req.Consume)) })
+	}
+	if req.Crossfade != nil {
+		set(func() error { return c.SetCrossfade(time.Duration(*req.Crossfade * float64(time.Second))) })
+	}
+	if req.Volume != nil {
+		set(func() error { return c.SetVolume(*req.Volume) })
+	}
+	if req.ReplayGain != nil {
+		set(func() error { return c.SetReplayGainMode(*req.ReplayGain) })
+	}
+	if err != nil {
+		return err
+	}
+	return getStatus(c, w, r)
+}
+
+// getFind finds the songs whose tags are the values of the query
+// parameters, or matching the filter expression of the expr parameter.
+func getFind(ignoreCase bool) handlerFunc {
+	return func(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+		query := r.URL.Query()
+		var filters []mpdclient.Filter
+		tags := make([]string, 0, len(query))
+		for tag := range query {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			for _, value := range query[tag] {
+				if tag == "expr" {
+					filters = append(filters, mpdclient.RawFilter(value))
+				} else {
+					filters = append(filters, mpdclient.Eq(tag, value))
+				}
+			}
+		}
+		if len(filters) == 0 {
+			return &badRequest{errors.New("No filter")}
+		}
+		filter := filters[0]
+		if len(filters) > 1 {
+			filter = mpdclient.And(filters...)
+		}
+		var songs []mpdclient.Song
+		var err error
+		if ignoreCase {
+			songs, err = c.Search(filter)
+		} else {
+			songs, err = c.Find(filter)
+		}
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, songs)
+	}
+}
+
+type sticker struct {
+	URI   string `json:"uri"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func getSticker(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	uri, name := r.URL.Query().Get("uri"), r.URL.Query().Get("name")
+	if uri == "" || name == "" {
+		return &badRequest{errors.New("uri and name are required")}
+	}
+	value, err := c.StickerGet(mpdclient.StickerSongType, uri, name)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return writeJSON(w, http.StatusNotFound, Error{Error: "no such sticker"})
+	}
+	return writeJSON(w, http.StatusOK, sticker{uri, name, value})
+}
+
+func putSticker(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	var req sticker
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	if err := c.StickerSet(mpdclient.StickerSongType, req.URI, req.Name, req.Value); err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, req)
+}
+
+func getStickerFind(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	name, uri := r.URL.Query().Get("name"), r.URL.Query().Get("uri")
+	if name == "" {
+		return &badRequest{errors.New("name is required")}
+	}
+	found, err := c.StickerFind(mpdclient.StickerSongType, uri, name)
+	if err != nil {
+		return err
+	}
+	stickers := make([]sticker, len(found))
+	for i, s := range found {
+		stickers[i] = sticker{s.Uri, s.Name, s.Value}
+	}
+	return writeJSON(w, http.StatusOK, stickers)
+}
+
+func getPlaylists(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	playlists, err := c.ListPlaylists()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, playlists)
+}
+
+func getPlaylist(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	songs, err := c.ListPlaylistInfo(r.PathValue("name"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, songs)
+}
+
+func putPlaylist(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		URIs []string `json:"uris"`
+	}
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	if err := c.PlaylistReplace(r.PathValue("name"), req.URIs); err != nil {
+		return err
+	}
+	return noContent(w)
+}
+
+func deletePlaylist(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	if err := c.Rm(r.PathValue("name")); err != nil {
+		return err
+	}
+	return noContent(w)
+}
+
+func loadPlaylist(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	if err := c.Load(r.PathValue("name")); err != nil {
+		return err
+	}
+	return noContent(w)
+}
+
+// getAlbumArt returns the cover of the directory of a song,
+// or else the picture embedded in it.
+func getAlbumArt(c *mpdclient.MPDClient, w http.ResponseWriter, r *http.Request) error {
+	uri := r.URL.Query().Get("uri")
+	if uri == "" {
+		return &badRequest{errors.New("uri is required")}
+	}
+	data, err := c.AlbumArt(uri)
+	var mimeType string
+	var mpdErr *mpdclient.MPDError
+	if (err == nil && data == nil) || (errors.As(err, &mpdErr) && mpdErr.Ack == mpdclient.AckNoExist) {
+		if c.Supports(mpdclient.FeatureReadPicture) {
+			data, mimeType, err = c.ReadPicture(uri)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return writeJSON(w, http.StatusNotFound, Error{Error: "no album art"})
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "max-age=3600")
+	_, err = w.Write(data)
+	return err
+}
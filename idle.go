@@ -21,6 +21,7 @@ package mpdclient
 
 import (
 	"sync"
+	"time"
 )
 
 type idleState struct {
@@ -28,74 +29,168 @@ type idleState struct {
 	isIdle bool
 	quitCh chan bool
 	reqCh  chan *request
-	resCh  chan *response
+	resCh  chan *Response
 }
 
+// closing reports whether the client is being closed.
+func (is *idleState) closing() bool {
+	select {
+	case <-is.quitCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// MaybeWait waits for the subscription loop to be idle.
 func (is *idleState) MaybeWait() {
-	if !is.isIdle {
-		is.c.L.Lock()
+	is.c.L.Lock()
+	defer is.c.L.Unlock()
+	for !is.isIdle {
 		is.c.Wait()
-		is.c.L.Unlock()
+	}
+}
+
+func (is *idleState) setIdle(idle bool) {
+	is.c.L.Lock()
+	defer is.c.L.Unlock()
+	is.isIdle = idle
+	if idle {
+		is.c.Broadcast()
 	}
 }
 
 type idleListener struct {
 	Ch         chan string
-	active     bool
 	subsystems []string
+	done       chan struct{}
+	once       sync.Once
 }
 
+// Close stops the delivery of idle events to the listener.
+// Ch is left open, as an event may be being delivered.
 func (is *idleListener) Close() {
-	close(is.Ch)
-	is.active = false
+	is.once.Do(func() {
+		close(is.done)
+	})
+}
+
+func (is *idleListener) closed() bool {
+	select {
+	case <-is.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (is *idleListener) wants(subsystem string) bool {
+	if len(is.subsystems) == 0 {
+		return true
+	}
+	for _, wantedSubsystem := range is.subsystems {
+		if wantedSubsystem == subsystem {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *MPDClient) Idle(subsystems ...string) *idleListener {
-	is := idleListener{make(chan string), true, subsystems}
-	c.idleListeners = append(c.idleListeners, &is)
-	return &is
+	is := &idleListener{Ch: make(chan string), subsystems: subsystems, done: make(chan struct{})}
+	c.listenersMu.Lock()
+	defer c.listenersMu.Unlock()
+	// Drop the closed listeners while we're at it
+	listeners := make([]*idleListener, 0, len(c.idleListeners)+1)
+	for _, l := range c.idleListeners {
+		if !l.closed() {
+			listeners = append(listeners, l)
+		}
+	}
+	c.idleListeners = append(listeners, is)
+	return is
 }
 
 func (c *MPDClient) sendIdleChange(subsystem string) {
-	for i, idleListener := range c.idleListeners {
-		if idleListener.active == true {
-			if len(idleListener.subsystems) == 0 {
-				idleListener.Ch <- subsystem
-			} else {
-				for _, wantedSubsystem := range idleListener.subsystems {
-					if wantedSubsystem == subsystem {
-						c.Logger.Println("sending", subsystem, "to", i)
-						idleListener.Ch <- subsystem
-					}
-				}
-			}
+	c.listenersMu.Lock()
+	listeners := c.idleListeners
+	c.listenersMu.Unlock()
+	for i, idleListener := range listeners {
+		if idleListener.closed() || !idleListener.wants(subsystem) {
+			continue
+		}
+		c.Logger.Debug("sending idle change", "subsystem", subsystem, "listener", i)
+		select {
+		case idleListener.Ch <- subsystem:
+		case <-idleListener.done:
 		}
 	}
 }
 
+// lose marks the client as disconnected, after an error
+// on one of its connections.
+func (c *MPDClient) lose(err error) {
+	if c.idle.closing() {
+		return
+	}
+	c.lostOnce.Do(func() {
+		c.Logger.Error("connection lost", "error", err)
+		c.lostErr = err
+		close(c.lostCh)
+	})
+}
+
+// Lost returns a channel closed when the client loses its connection
+// to MPD. The client is unusable then, and should be closed.
+func (c *MPDClient) Lost() <-chan struct{} {
+	return c.lostCh
+}
+
+// Err returns the error that made the client lose its connection,
+// or nil if it is still connected.
+func (c *MPDClient) Err() error {
+	select {
+	case <-c.lostCh:
+		return c.lostErr
+	default:
+		return nil
+	}
+}
+
+// sendIdleChanges notifies the listeners of all the subsystems
+// reported by a single idle response, in order.
+func (c *MPDClient) sendIdleChanges(subsystems []string) {
+	for _, subsystem := range subsystems {
+		c.sendIdleChange(subsystem)
+	}
+}
+
 func (c *MPDClient) idleLoop() {
 	defer func() {
 		if err := recover(); err != nil {
-			c.Logger.Panicf("Panic in idleloop: %s\n", err)
+			c.Logger.Error("panic in idle loop", "error", err)
+			panic(err)
 		}
 	}()
 	for {
-		c.Logger.Println("Entering idle mode")
+		c.Logger.Debug("entering idle mode", "conn", "idle")
 		id, err := c.idleConn.Cmd("idle")
 		if err != nil {
-			panic(err)
+			if c.idle.closing() {
+				return
+			}
+			c.lose(err)
+			return
 		}
 
-		c.Logger.Println("Idle mode ready1")
 		c.idleConn.StartResponse(id)
-		c.Logger.Println("Idle mode ready2")
 
-		var subsystem *string
+		var subsystems []string
 		var idleErr error
 		for {
-			line, idleErr := c.idleConn.ReadLine()
-			if idleErr != nil {
-
+			line, err := c.idleConn.ReadLine()
+			if err != nil {
+				idleErr = err
 				break
 			}
 			if line == "OK" {
@@ -107,22 +202,25 @@ func (c *MPDClient) idleLoop() {
 				}
 				key := match[1]
 				if key == "changed" {
-					l := match[2]
-					subsystem = &l
+					subsystems = append(subsystems, match[2])
 				}
 			}
 		}
 
 		c.idleConn.EndResponse(id)
 		if idleErr != nil {
-			panic(idleErr)
+			if c.idle.closing() {
+				return
+			}
+			c.lose(idleErr)
+			return
 		}
 
-		if subsystem != nil {
-			c.Logger.Println("subsystem", *subsystem, "changed")
-			go c.sendIdleChange(*subsystem)
+		if len(subsystems) > 0 {
+			c.Logger.Debug("idle changes", "conn", "idle", "subsystems", subsystems)
+			go c.sendIdleChanges(subsystems)
 		} else {
-			c.Logger.Println("Noidle triggered")
+			c.Logger.Debug("noidle triggered", "conn", "idle")
 			select {
 			case <-c.idle.quitCh:
 				return
@@ -131,3 +229,49 @@ func (c *MPDClient) idleLoop() {
 		}
 	}
 }
+
+// idleWatcher runs refresh on each event of an idle subsystem,
+// and every interval if it is set, until Close is called.
+type idleWatcher struct {
+	c        *MPDClient
+	listener *idleListener
+	interval time.Duration
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (w *idleWatcher) init(c *MPDClient, subsystem string) {
+	w.c = c
+	w.listener = c.Idle(subsystem)
+	w.done = make(chan struct{})
+}
+
+func (w *idleWatcher) Close() {
+	w.once.Do(func() {
+		close(w.done)
+		w.listener.Close()
+	})
+}
+
+func (w *idleWatcher) loop(name string, refresh func() error) {
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-w.done:
+			return
+		case _, ok := <-w.listener.Ch:
+			if !ok {
+				return
+			}
+		case <-tick:
+		}
+		if err := refresh(); err != nil {
+			w.c.Logger.Warn(name+" watcher refresh failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Invoker sends a command to MPD and returns its response.
+type Invoker func(cmd *Command) *Response
+
+// Interceptor wraps the invocation of the commands of a client.
+// It may inspect or modify cmd before calling next, inspect the
+// response it returns, or short-circuit the command by returning
+// a response of its own without calling next.
+type Interceptor func(cmd *Command, next Invoker) *Response
+
+// ChainInterceptors composes interceptors into one.
+// The first interceptor is the outermost.
+func ChainInterceptors(interceptors ...Interceptor) Interceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+	return func(cmd *Command, next Invoker) *Response {
+		return interceptors[0](cmd, chainInvoker(interceptors[1:], next))
+	}
+}
+
+func chainInvoker(interceptors []Interceptor, final Invoker) Invoker {
+	if len(interceptors) == 0 {
+		return final
+	}
+	return func(cmd *Command) *Response {
+		return interceptors[0](cmd, chainInvoker(interceptors[1:], final))
+	}
+}
+
+func (c *MPDClient) invoke(cmd *Command, final Invoker) *Response {
+	final = checkInvoker(final)
+	if c.interceptor == nil {
+		return final(cmd)
+	}
+	return c.interceptor(cmd, final)
+}
+
+// checkInvoker wraps final so that a command whose name or
+// arguments contain a line break fails locally, instead of
+// being written to MPD as several commands.
+func checkInvoker(final Invoker) Invoker {
+	return func(cmd *Command) *Response {
+		for i, s := range append([]string{cmd.Name}, cmd.Args...) {
+			if strings.ContainsAny(s, "\r\n") {
+				msg := "line break in command name"
+				if i > 0 {
+					msg = fmt.Sprintf("line break in argument %d", i)
+				}
+				return &Response{
+					Data: []string{},
+					MPDErr: &MPDError{
+						Ack:            AckArg,
+						CurrentCommand: cmd.Name,
+						MessageText:    msg,
+					},
+				}
+			}
+		}
+		return final(cmd)
+	}
+}
+
+// DenyCommands returns an interceptor that refuses to send the
+// named commands, answering them with a permission error instead.
+func DenyCommands(names ...string) Interceptor {
+	denied := make(map[string]bool)
+	for _, name := range names {
+		denied[name] = true
+	}
+	return func(cmd *Command, next Invoker) *Response {
+		if denied[cmd.Name] {
+			return &Response{
+				Data: []string{},
+				MPDErr: &MPDError{
+					Ack:            AckPermission,
+					CurrentCommand: cmd.Name,
+					MessageText:    fmt.Sprintf("you don't have permission for \"%s\"", cmd.Name),
+				},
+			}
+		}
+		return next(cmd)
+	}
+}
@@ -0,0 +1,372 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+// Package libindex is a local full-text index of the MPD database,
+// for fast, fuzzy, diacritic-insensitive and ranked searches
+// across tags.
+//
+//	ix, err := libindex.LoadFile(path)
+//	if err != nil {
+//		ix = libindex.New()
+//	}
+//	err = ix.Watch(mpdc)
+//	defer ix.Close()
+//	results := ix.Search("beatels abey road", 20)
+//	// ...
+//	err = ix.SaveFile(path)
+package libindex
+
+import (
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// DefaultTags are the tags indexed by default.
+var DefaultTags = []string{"Title", "Artist", "AlbumArtist", "Album", "Composer", "Performer", "Genre"}
+
+// weights rank the matches in some tags above the others.
+var weights = map[string]float64{
+	"Title":       3,
+	"Artist":      2,
+	"AlbumArtist": 2,
+	"Album":       2,
+}
+
+// fileWeight is the weight of the words of the file names.
+const fileWeight = 0.5
+
+// Entry is a song of the index.
+type Entry struct {
+	File     string              `json:"file"`
+	Duration time.Duration       `json:"duration,omitempty"`
+	Tags     map[string][]string `json:"tags,omitempty"`
+}
+
+// Tag returns the first value of a tag, or an empty string.
+func (e *Entry) Tag(name string) string {
+	if values := e.Tags[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Index is an inverted index of the songs of the database.
+// It is safe for concurrent use.
+type Index struct {
+	Logger *slog.Logger
+
+	mu   sync.RWMutex
+	tags []string
+	data *data
+	done chan struct{}
+	once sync.Once
+}
+
+// data is the content of an index.
+type data struct {
+	// entries are indexed by id, nil once removed.
+	entries []*Entry
+	ids     map[string]int
+	// postings are the weights of the words in the entries,
+	// by word and id.
+	postings map[string]map[int]float64
+	// words are the words of postings, sorted.
+	words []string
+	// updated is the time of the database update
+	// the index is up to date with.
+	updated time.Time
+}
+
+func newData() *data {
+	return &data{ids: make(map[string]int), postings: make(map[string]map[int]float64)}
+}
+
+// New returns an empty index of tags, or of DefaultTags if none.
+func New(tags ...string) *Index {
+	if len(tags) == 0 {
+		tags = DefaultTags
+	}
+	return &Index{
+		Logger: slog.New(slog.DiscardHandler),
+		tags:   tags,
+		data:   newData(),
+		done:   make(chan struct{}),
+	}
+}
+
+// Len returns the number of songs in the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.data.ids)
+}
+
+// Updated returns the time of the database update the index
+// is up to date with, zero if it was never built.
+func (ix *Index) Updated() time.Time {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.data.updated
+}
+
+// Get returns the entry of a file, or nil.
+func (ix *Index) Get(file string) *Entry {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if id, ok := ix.data.ids[file]; ok {
+		return ix.data.entries[id]
+	}
+	return nil
+}
+
+func (ix *Index) entry(song *mpdclient.Song) *Entry {
+	e := &Entry{File: song.File, Duration: song.Duration, Tags: make(map[string][]string)}
+	for _, tag := range ix.tags {
+		if values := song.Tags[tag]; len(values) > 0 {
+			e.Tags[tag] = values
+		}
+	}
+	return e
+}
+
+// add indexes e, replacing the entry of the same file if any.
+func (d *data) add(e *Entry, tags []string) {
+	d.remove(e.File)
+	id := len(d.entries)
+	d.entries = append(d.entries, e)
+	d.ids[e.File] = id
+	index := func(text string, weight float64) {
+		for _, word := range tokenize(text) {
+			p := d.postings[word]
+			if p == nil {
+				p = make(map[int]float64)
+				d.postings[word] = p
+			}
+			p[id] = max(p[id], weight)
+		}
+	}
+	for _, tag := range tags {
+		weight, ok := weights[tag]
+		if !ok {
+			weight = 1
+		}
+		for _, value := range e.Tags[tag] {
+			index(value, weight)
+		}
+	}
+	index(strings.TrimSuffix(path.Base(e.File), path.Ext(e.File)), fileWeight)
+}
+
+// remove removes the entry of a file from the index.
+func (d *data) remove(file string) {
+	id, ok := d.ids[file]
+	if !ok {
+		return
+	}
+	e := d.entries[id]
+	d.entries[id] = nil
+	delete(d.ids, file)
+	words := tokenize(strings.TrimSuffix(path.Base(e.File), path.Ext(e.File)))
+	for _, values := range e.Tags {
+		for _, value := range values {
+			words = append(words, tokenize(value)...)
+		}
+	}
+	for _, word := range words {
+		if p := d.postings[word]; p != nil {
+			delete(p, id)
+			if len(p) == 0 {
+				delete(d.postings, word)
+			}
+		}
+	}
+}
+
+// sortWords lists the words of the postings, for the prefix
+// and fuzzy matches.
+func (d *data) sortWords() {
+	d.words = d.words[:0]
+	for word := range d.postings {
+		d.words = append(d.words, word)
+	}
+	sort.Strings(d.words)
+}
+
+// Build indexes all the songs of the database of c,
+// replacing the content of the index once done.
+func (ix *Index) Build(c *mpdclient.MPDClient) error {
+	stats, err := c.Stats()
+	if err != nil {
+		return err
+	}
+	d := newData()
+	err = c.ListAllInfoFunc("", func(song *mpdclient.Song) error {
+		d.add(ix.entry(song), ix.tags)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.sortWords()
+	d.updated = stats.DBUpdate
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.data = d
+	ix.Logger.Info("index built", "songs", len(d.ids), "words", len(d.words))
+	return nil
+}
+
+// Update indexes the songs added or modified in the database of c
+// since the last update, and removes the songs deleted from it.
+// The index is built if it never was.
+func (ix *Index) Update(c *mpdclient.MPDClient) error {
+	stats, err := c.Stats()
+	if err != nil {
+		return err
+	}
+	ix.mu.RLock()
+	since, n := ix.data.updated, len(ix.data.ids)
+	ix.mu.RUnlock()
+	if since.IsZero() {
+		return ix.Build(c)
+	}
+	if !stats.DBUpdate.After(since) && n == int(stats.Songs) {
+		return nil
+	}
+
+	songs, err := c.Find(mpdclient.ModifiedSince(since))
+	if err != nil {
+		return err
+	}
+	if c.Supports(mpdclient.FeatureAddedSince) {
+		added, err := c.Find(mpdclient.AddedSince(since))
+		if err != nil {
+			return err
+		}
+		songs = append(songs, added...)
+	}
+	ix.mu.Lock()
+	for i := range songs {
+		ix.data.add(ix.entry(&songs[i]), ix.tags)
+	}
+	n = len(ix.data.ids)
+	ix.mu.Unlock()
+
+	// The index has all the new songs, it has more songs than the
+	// database only if some were deleted. Songs added with an old
+	// modification time to servers without the added-since filter
+	// make a difference too.
+	if n != int(stats.Songs) {
+		if err := ix.sync(c); err != nil {
+			return err
+		}
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.data.sortWords()
+	ix.data.updated = stats.DBUpdate
+	ix.Logger.Info("index updated", "songs", len(ix.data.ids), "modified", len(songs))
+	return nil
+}
+
+// maxMissing is the number of missing songs above which
+// the index is rebuilt rather than updated.
+const maxMissing = 100
+
+// sync removes the songs no longer in the database from the index,
+// and adds the songs missing from it.
+func (ix *Index) sync(c *mpdclient.MPDClient) error {
+	res := c.Cmd("list file")
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.MPDErr != nil {
+		return res.MPDErr
+	}
+	files := make(map[string]bool, len(res.Data))
+	for _, line := range res.Data {
+		if file, ok := strings.CutPrefix(line, "file: "); ok {
+			files[file] = true
+		}
+	}
+	var missing []string
+	ix.mu.Lock()
+	for file := range ix.data.ids {
+		if !files[file] {
+			ix.data.remove(file)
+		}
+	}
+	for file := range files {
+		if _, ok := ix.data.ids[file]; !ok {
+			missing = append(missing, file)
+		}
+	}
+	ix.mu.Unlock()
+	if len(missing) > maxMissing {
+		return ix.Build(c)
+	}
+	for _, file := range missing {
+		songs, err := c.Find(mpdclient.Eq("file", file))
+		if err != nil {
+			return err
+		}
+		ix.mu.Lock()
+		for i := range songs {
+			ix.data.add(ix.entry(&songs[i]), ix.tags)
+		}
+		ix.mu.Unlock()
+	}
+	return nil
+}
+
+// Watch updates the index from c, then each time a "database"
+// idle event occurs, until Close is called.
+func (ix *Index) Watch(c *mpdclient.MPDClient) error {
+	events := c.Idle("database")
+	if err := ix.Update(c); err != nil {
+		events.Close()
+		return err
+	}
+	go func() {
+		defer events.Close()
+		for {
+			select {
+			case <-ix.done:
+				return
+			case <-events.Ch:
+			}
+			if err := ix.Update(c); err != nil {
+				ix.Logger.Warn("index update failed", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stops watching the database.
+func (ix *Index) Close() {
+	ix.once.Do(func() {
+		close(ix.done)
+	})
+}
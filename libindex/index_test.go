@@ -0,0 +1,159 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package libindex
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+var directories = map[string]string{
+	"":        "directory: Beatles\nfile: loose.ogg\nTitle: Let It Be\nArtist: Aretha Franklin\nplaylist: favorites",
+	"Beatles": "directory: Beatles/Abbey Road\nfile: Beatles/let it be.ogg\nTitle: Let It Be\nArtist: The Beatles\nAlbum: Let It Be\nduration: 243.000",
+	"Beatles/Abbey Road": "file: Beatles/Abbey Road/01.ogg\nTitle: Come Together\nArtist: The Beatles\nAlbum: Abbey Road\n" +
+		"file: Beatles/Abbey Road/02.ogg\nTitle: Something\nArtist: The Beatles\nAlbum: Abbey Road\nComposer: George Harrison",
+}
+
+func newServer(t *testing.T) (*mpdtest.Server, *mpdclient.MPDClient) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	s.Handle("lsinfo", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		dir := ""
+		if len(r.Args) > 0 {
+			dir = r.Args[0]
+		}
+		for _, line := range bytes.Split([]byte(directories[dir]), []byte("\n")) {
+			w.Line(string(line))
+		}
+		return nil
+	})
+	s.Respond("stats", "songs: 4\ndb_update: 1700000000")
+	c, err := mpdclient.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+func files(results []Result) []string {
+	files := make([]string, len(results))
+	for i, r := range results {
+		files[i] = r.File
+	}
+	return files
+}
+
+func expectFiles(t *testing.T, ix *Index, query string, expected ...string) {
+	t.Helper()
+	got := files(ix.Search(query, 0))
+	if len(got) != len(expected) {
+		t.Errorf("Expected %v for %q, got %v", expected, query, got)
+		return
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %v for %q, got %v", expected, query, got)
+			return
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	_, c := newServer(t)
+	ix := New()
+	if err := ix.Build(c); err != nil {
+		t.Fatal(err)
+	}
+	if ix.Len() != 4 {
+		t.Fatalf("Expected 4 songs, got %d", ix.Len())
+	}
+	if e := ix.Get("Beatles/let it be.ogg"); e == nil || e.Duration.Seconds() != 243 || e.Tag("Album") != "Let It Be" {
+		t.Fatalf("Unexpected entry %+v", e)
+	}
+
+	expectFiles(t, ix, "abbey road", "Beatles/Abbey Road/01.ogg", "Beatles/Abbey Road/02.ogg")
+	// Typos, prefixes and case
+	expectFiles(t, ix, "beatels SOMETH", "Beatles/Abbey Road/02.ogg")
+	expectFiles(t, ix, "harrisson", "Beatles/Abbey Road/02.ogg")
+	// The album of the Beatles song ranks it first
+	expectFiles(t, ix, "let it be", "Beatles/let it be.ogg", "loose.ogg")
+	expectFiles(t, ix, "aretha let", "loose.ogg")
+	expectFiles(t, ix, "zeppelin")
+	expectFiles(t, ix, " - ")
+	if results := ix.Search("beatles", 2); len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s, c := newServer(t)
+	ix := New()
+	if err := ix.Update(c); err != nil {
+		t.Fatal(err)
+	}
+	if ix.Len() != 4 {
+		t.Fatalf("Expected the index to be built, got %d songs", ix.Len())
+	}
+
+	// One song is modified, another deleted.
+	s.Respond("stats", "songs: 3\ndb_update: 1700000100")
+	s.Respond("find", "file: Beatles/Abbey Road/01.ogg\nTitle: Come Together (Remastered)\nArtist: The Beatles\nAlbum: Abbey Road")
+	s.Respond("list", "file: loose.ogg\nfile: Beatles/Abbey Road/01.ogg\nfile: Beatles/Abbey Road/02.ogg")
+	if err := ix.Update(c); err != nil {
+		t.Fatal(err)
+	}
+	if ix.Len() != 3 || ix.Get("Beatles/let it be.ogg") != nil {
+		t.Fatalf("Expected a song to be removed, got %d songs", ix.Len())
+	}
+	expectFiles(t, ix, "remastered", "Beatles/Abbey Road/01.ogg")
+	expectFiles(t, ix, "let it be", "loose.ogg")
+	if ix.Updated().Unix() != 1700000100 {
+		t.Errorf("Unexpected update time %v", ix.Updated())
+	}
+	for _, cmd := range s.Commands() {
+		if cmd.Name == "find" && cmd.Args[0] != "(modified-since '2023-11-14T22:13:20Z')" {
+			t.Errorf("Unexpected find %v", cmd)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ix.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 3 || !loaded.Updated().Equal(ix.Updated()) {
+		t.Fatalf("Unexpected loaded index of %d songs, updated %v", loaded.Len(), loaded.Updated())
+	}
+	expectFiles(t, loaded, "remastered", "Beatles/Abbey Road/01.ogg")
+
+	if _, err := Load(bytes.NewBufferString(`{"version":1,"len":2}` + "\n" + `{"file":"a.ogg"}` + "\n")); err == nil {
+		t.Errorf("Expected an error for a truncated index")
+	}
+}
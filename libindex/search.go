@@ -0,0 +1,121 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package libindex
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The scores of the words of the index matching a word of a query,
+// before the weight of their tag.
+const (
+	exactScore  = 1
+	prefixScore = 0.7
+	// fuzzyScore is divided by the number of typos.
+	fuzzyScore = 0.5
+)
+
+// Result is a song matching a search.
+type Result struct {
+	*Entry
+	Score float64 `json:"score"`
+}
+
+// Search returns the songs matching all the words of query, best
+// first, at most limit of them if limit is positive. The words match
+// the words of the tags exactly, as prefixes, or with a few typos,
+// regardless of case and diacritics.
+func (ix *Index) Search(query string, limit int) []Result {
+	words := tokenize(query)
+	if len(words) == 0 {
+		return nil
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	d := ix.data
+	var scores map[int]float64
+	for _, word := range words {
+		// The best match of the word in each entry.
+		matches := make(map[int]float64)
+		for w, score := range d.match(word) {
+			for id, weight := range d.postings[w] {
+				matches[id] = max(matches[id], score*weight)
+			}
+		}
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		for id := range scores {
+			if score, ok := matches[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{d.entries[id], score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].File < results[j].File
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// match returns the words of the index matching word,
+// with their score.
+func (d *data) match(word string) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := d.postings[word]; ok {
+		matches[word] = exactScore
+	}
+	for i := sort.SearchStrings(d.words, word); i < len(d.words) && strings.HasPrefix(d.words[i], word); i++ {
+		if d.words[i] != word {
+			matches[d.words[i]] = prefixScore
+		}
+	}
+	runes := []rune(word)
+	maxTypos := maxDistance(runes)
+	if maxTypos == 0 {
+		return matches
+	}
+	for _, w := range d.words {
+		if _, ok := matches[w]; ok {
+			continue
+		}
+		if n := utf8.RuneCountInString(w) - len(runes); n > maxTypos || -n > maxTypos {
+			continue
+		}
+		if n := distance(runes, []rune(w), maxTypos); n <= maxTypos {
+			matches[w] = fuzzyScore / float64(n)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,130 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package libindex
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// formatVersion is the version of the format of the saved indexes.
+const formatVersion = 1
+
+// header is the first line of a saved index,
+// the entries following one per line.
+type header struct {
+	Version int       `json:"version"`
+	Tags    []string  `json:"tags"`
+	Updated time.Time `json:"updated"`
+	Len     int       `json:"len"`
+}
+
+// Save writes the songs of the index to w, as JSON lines.
+// The words are indexed again when it is loaded.
+func (ix *Index) Save(w io.Writer) error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := enc.Encode(header{formatVersion, ix.tags, ix.data.updated, len(ix.data.ids)})
+	if err != nil {
+		return err
+	}
+	for _, e := range ix.data.entries {
+		if e == nil {
+			continue
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// SaveFile saves the index to a file, through a temporary
+// file renamed over it.
+func (ix *Index) SaveFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := ix.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load reads an index saved with Save.
+func Load(r io.Reader) (*Index, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var h header
+	if err := dec.Decode(&h); err != nil {
+		return nil, err
+	}
+	if h.Version != formatVersion {
+		return nil, errors.New(fmt.Sprintf("Unsupported index version %d", h.Version))
+	}
+	ix := New(h.Tags...)
+	d := newData()
+	d.entries = make([]*Entry, 0, h.Len)
+	for {
+		e := new(Entry)
+		if err := dec.Decode(e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		d.add(e, ix.tags)
+	}
+	if len(d.ids) != h.Len {
+		return nil, errors.New(fmt.Sprintf("Truncated index: %d songs out of %d", len(d.ids), h.Len))
+	}
+	d.sortWords()
+	d.updated = h.Updated
+	ix.data = d
+	return ix, nil
+}
+
+// LoadFile loads an index saved with SaveFile.
+func LoadFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
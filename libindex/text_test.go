@@ -0,0 +1,61 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package libindex
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		s     string
+		words string
+	}{
+		{"Café del Mar", "cafe del mar"},
+		{"Sigur Rós – Ágætis byrjun", "sigur ros agaetis byrjun"},
+		{"Mötley Crüe", "motley crue"},
+		{"Café Noir", "cafe noir"},
+		{"AC/DC: Live (1992)", "ac dc live 1992"},
+		{"Straße", "strasse"},
+	}
+	for _, test := range tests {
+		if words := strings.Join(tokenize(test.s), " "); words != test.words {
+			t.Errorf("Expected %q for %q, got %q", test.words, test.s, words)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		max, d int
+	}{
+		{"beatles", "beatles", 2, 0},
+		{"beatels", "beatles", 2, 1},
+		{"beatle", "beatles", 2, 1},
+		{"kitten", "sitting", 2, 3},
+		{"abc", "abcdef", 2, 3},
+	}
+	for _, test := range tests {
+		if d := distance([]rune(test.a), []rune(test.b), test.max); d != test.d {
+			t.Errorf("Expected %d between %q and %q, got %d", test.d, test.a, test.b, d)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdserver
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+)
+
+// DefaultBinaryLimit is the size of the binary chunks
+// until the client sets another with binarylimit.
+const DefaultBinaryLimit = 8192
+
+// Conn is a client connection to a server.
+type Conn struct {
+	conn   net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	values      map[interface{}]interface{}
+	binaryLimit int
+	// pending holds the subsystems changed since the last idle
+	pending map[string]bool
+	changed chan struct{}
+}
+
+func newConn(conn net.Conn) *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Conn{
+		conn:        conn,
+		ctx:         ctx,
+		cancel:      cancel,
+		values:      make(map[interface{}]interface{}),
+		binaryLimit: DefaultBinaryLimit,
+		pending:     make(map[string]bool),
+		changed:     make(chan struct{}, 1),
+	}
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Context returns a context canceled when the connection is closed.
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// Value returns the value the handlers associated with key.
+func (c *Conn) Value(key interface{}) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+// SetValue associates a value with key, for the handlers
+// to keep the state of the connection.
+func (c *Conn) SetValue(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+}
+
+// BinaryLimit returns the maximum size of the binary chunks
+// sent on the connection.
+func (c *Conn) BinaryLimit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.binaryLimit
+}
+
+// Notify reports a change of subsystems to the connection only,
+// as MPD does with message for the subscribers of a channel.
+func (c *Conn) Notify(subsystems ...string) {
+	c.mu.Lock()
+	for _, subsystem := range subsystems {
+		c.pending[subsystem] = true
+	}
+	c.mu.Unlock()
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and forgets the pending changes of the subsystems,
+// of all of them if subsystems is empty.
+func (c *Conn) take(subsystems []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var changed []string
+	for subsystem := range c.pending {
+		if len(subsystems) > 0 && !contains(subsystems, subsystem) {
+			continue
+		}
+		changed = append(changed, subsystem)
+		delete(c.pending, subsystem)
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.cancel()
+	return c.conn.Close()
+}
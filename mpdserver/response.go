@@ -0,0 +1,132 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// ResponseWriter buffers the response of a command,
+// which is discarded if the command fails.
+type ResponseWriter struct {
+	buf    bytes.Buffer
+	conn   *Conn
+	listOK bool
+}
+
+var newlineEscaper = strings.NewReplacer("\n", " ", "\r", " ")
+
+// Field writes a key: value line, value formatted as by fmt.Sprint.
+func (w *ResponseWriter) Field(key string, value interface{}) {
+	w.buf.WriteString(key)
+	w.buf.WriteString(": ")
+	w.buf.WriteString(newlineEscaper.Replace(fmt.Sprint(value)))
+	w.buf.WriteByte('\n')
+}
+
+// Line writes a raw response line.
+func (w *ResponseWriter) Line(line string) {
+	w.buf.WriteString(line)
+	w.buf.WriteByte('\n')
+}
+
+// ListOK ends the response of a command of a command list, written
+// by a list handler. It writes list_OK if the client asked for it.
+func (w *ResponseWriter) ListOK() {
+	if w.listOK {
+		w.buf.WriteString("list_OK\n")
+	}
+}
+
+// Binary writes a binary: line followed by data.
+func (w *ResponseWriter) Binary(data []byte) {
+	w.Field("binary", len(data))
+	w.buf.Write(data)
+	w.buf.WriteByte('\n')
+}
+
+// Chunk writes the size of data and its chunk at offset, no larger
+// than the binary limit of the connection, as albumart does.
+func (w *ResponseWriter) Chunk(data []byte, offset int) error {
+	if offset < 0 || offset > len(data) {
+		return Errorf(mpdclient.AckArg, "Bad file offset")
+	}
+	end := min(offset+w.conn.BinaryLimit(), len(data))
+	w.Field("size", len(data))
+	w.Binary(data[offset:end])
+	return nil
+}
+
+// WriteResponse writes the response of a client, to forward it,
+// and returns its error if any.
+func (w *ResponseWriter) WriteResponse(res *mpdclient.Response) error {
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.MPDErr != nil {
+		return res.MPDErr
+	}
+	binary := res.Binary
+	for _, line := range res.Data {
+		if n, ok := strings.CutPrefix(line, "binary: "); ok {
+			size, err := strconv.Atoi(n)
+			if err != nil || size > len(binary) {
+				return errors.New(fmt.Sprintf("Invalid binary line: %s", line))
+			}
+			w.Binary(binary[:size])
+			binary = binary[size:]
+			continue
+		}
+		w.Line(line)
+	}
+	return nil
+}
+
+// Errorf returns an ACK error with a formatted message.
+func Errorf(ack uint, format string, args ...interface{}) error {
+	return &mpdclient.MPDError{Ack: ack, MessageText: fmt.Sprintf(format, args...)}
+}
+
+// ackError returns the ACK error of a command error: the error itself
+// for MPD errors, a system error otherwise.
+func ackError(err error, command string, num int) *mpdclient.MPDError {
+	var mpdErr *mpdclient.MPDError
+	if errors.As(err, &mpdErr) {
+		e := *mpdErr
+		e.CommandListNum = uint(num)
+		if e.CurrentCommand == "" {
+			e.CurrentCommand = command
+		}
+		return &e
+	}
+	return &mpdclient.MPDError{Ack: mpdclient.AckSystem, CommandListNum: uint(num), CurrentCommand: command, MessageText: err.Error()}
+}
+
+func writeAck(w *bufio.Writer, mpdErr *mpdclient.MPDError) {
+	w.WriteString(newlineEscaper.Replace(mpdErr.Line()))
+	w.WriteByte('\n')
+}
@@ -0,0 +1,469 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package mpdserver serves the MPD protocol, running the handlers
+// registered for each command.
+//
+// The server handles the connections, command lists, idle and noidle,
+// and the ping, close, binarylimit and commands commands; the
+// handlers the rest:
+//
+//	s := mpdserver.NewServer()
+//	s.Handle("status", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+//		w.Field("state", "play")
+//		w.Field("volume", 50)
+//		return nil
+//	})
+//	s.Handle("setvol", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+//		if len(r.Args) != 1 {
+//			return mpdserver.Errorf(mpdclient.AckArg, "wrong number of arguments for \"%s\"", r.Name)
+//		}
+//		// ...
+//		s.Notify("mixer")
+//		return nil
+//	})
+//	err := s.ListenAndServe("tcp", ":6600")
+//
+// Requests are parsed, and errors encoded, as the client of
+// the mpdclient package does.
+package mpdserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// DefaultVersion is the protocol version servers announce by default.
+const DefaultVersion = "0.23.5"
+
+// maxLineSize bounds the size of the request lines.
+const maxLineSize = 1 << 20
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("mpdserver: Server closed")
+
+// HandlerFunc runs a command. Its response is sent if it returns nil,
+// an ACK error otherwise, see Errorf.
+type HandlerFunc func(w *ResponseWriter, r *Request) error
+
+// ListHandlerFunc runs the commands of a command list at once.
+// Unlike with HandlerFunc, the response written is sent even if it
+// returns an error, which ends the list: it should hold the responses
+// of the commands before the failing one, each ended with ListOK.
+// The CommandListNum of an MPDError is the index of the failing command.
+type ListHandlerFunc func(w *ResponseWriter, r *ListRequest) error
+
+// Request is a command sent by a client.
+type Request struct {
+	mpdclient.Command
+	Conn *Conn
+	// ListNum is the position of the command in its command list.
+	ListNum int
+}
+
+// ListRequest is a command list sent by a client.
+type ListRequest struct {
+	Commands []*mpdclient.Command
+	Conn     *Conn
+}
+
+type Server struct {
+	// Version is the protocol version announced to the clients.
+	Version string
+	// NotFound runs the commands without handler.
+	// If nil, they fail with an unknown command error.
+	NotFound HandlerFunc
+	// ListHandler, if not nil, runs the command lists instead of
+	// the handlers of their commands. The commands not allowed in
+	// a list, like idle, and those after them, aren't passed to it.
+	ListHandler ListHandlerFunc
+	// OnConnect is called with each new connection, before its
+	// first command, and OnClose once it is closed.
+	OnConnect func(c *Conn)
+	OnClose   func(c *Conn)
+	Logger    *slog.Logger
+
+	mu        sync.Mutex
+	handlers  map[string]HandlerFunc
+	listeners map[net.Listener]struct{}
+	conns     map[*Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a server with no handler besides
+// the built-in commands.
+func NewServer() *Server {
+	s := &Server{
+		Version:   DefaultVersion,
+		Logger:    slog.New(slog.DiscardHandler),
+		handlers:  make(map[string]HandlerFunc),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*Conn]struct{}),
+	}
+	s.handlers["ping"] = func(w *ResponseWriter, r *Request) error { return nil }
+	s.handlers["binarylimit"] = BinaryLimit
+	s.handlers["commands"] = s.commands
+	return s
+}
+
+// Handle registers the handler of a command, replacing
+// the built-in one if any.
+func (s *Server) Handle(name string, h HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = h
+}
+
+func (s *Server) handler(name string) HandlerFunc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.handlers[name]; ok {
+		return h
+	}
+	return s.NotFound
+}
+
+// commands lists the commands with a handler.
+func (s *Server) commands(w *ResponseWriter, r *Request) error {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.handlers)+1)
+	for name := range s.handlers {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	names = append(names, "close", "idle", "noidle")
+	sort.Strings(names)
+	for _, name := range names {
+		w.Field("command", name)
+	}
+	return nil
+}
+
+// BinaryLimit is the built-in handler of binarylimit,
+// for the handlers replacing it.
+func BinaryLimit(w *ResponseWriter, r *Request) error {
+	var limit int
+	if len(r.Args) != 1 {
+		return Errorf(mpdclient.AckArg, "wrong number of arguments for \"%s\"", r.Name)
+	}
+	if _, err := fmt.Sscan(r.Args[0], &limit); err != nil || limit < 64 {
+		return Errorf(mpdclient.AckArg, "Value too small")
+	}
+	r.Conn.mu.Lock()
+	r.Conn.binaryLimit = limit
+	r.Conn.mu.Unlock()
+	return nil
+}
+
+// Notify reports a change of subsystems to all the connections,
+// for their idle commands.
+func (s *Server) Notify(subsystems ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Notify(subsystems...)
+	}
+}
+
+// ListenAndServe listens on the named network and address,
+// and serves the connections.
+func (s *Server) ListenAndServe(network, address string) error {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves the connections accepted by ln, until Close.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+	}()
+
+	for {
+		netConn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.ServeConn(netConn)
+	}
+}
+
+// ServeConn serves a connection in its own goroutine.
+func (s *Server) ServeConn(netConn net.Conn) {
+	c := newConn(netConn)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		netConn.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer s.wg.Done()
+		if s.OnConnect != nil {
+			s.OnConnect(c)
+		}
+		s.serve(c)
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		if s.OnClose != nil {
+			s.OnClose(c)
+		}
+	}()
+}
+
+// Close stops the listeners and closes the connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for ln := range s.listeners {
+		if lnErr := ln.Close(); lnErr != nil && err == nil {
+			err = lnErr
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// serve runs the commands of a connection until it is closed.
+func (s *Server) serve(c *Conn) {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(c.conn)
+		scanner.Buffer(nil, maxLineSize)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	w := bufio.NewWriter(c.conn)
+	fmt.Fprintf(w, "OK MPD %s\n", s.Version)
+	var idle []string
+	idling := false
+	for {
+		if idling {
+			if changed := c.take(idle); len(changed) > 0 {
+				for _, subsystem := range changed {
+					fmt.Fprintf(w, "changed: %s\n", subsystem)
+				}
+				w.WriteString("OK\n")
+				idling = false
+			}
+		}
+		if w.Flush() != nil {
+			return
+		}
+		var line string
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				return
+			}
+			line = l
+		case <-c.changed:
+			continue
+		case <-c.ctx.Done():
+			return
+		}
+
+		cmd := mpdclient.ParseCommand(line)
+		if idling {
+			// Only noidle is allowed while idle
+			if cmd.Name != "noidle" {
+				return
+			}
+			w.WriteString("OK\n")
+			idling = false
+			continue
+		}
+		switch cmd.Name {
+		case "":
+			writeAck(w, &mpdclient.MPDError{Ack: mpdclient.AckUnknown, MessageText: "No command given"})
+		case "idle":
+			idle, idling = cmd.Args, true
+		case "noidle":
+			// Like MPD, ignore it outside idle
+		case "close":
+			return
+		case "command_list_begin", "command_list_ok_begin":
+			var cmds []*mpdclient.Command
+			ended := false
+			for l := range lines {
+				if l == "command_list_end" {
+					ended = true
+					break
+				}
+				cmds = append(cmds, mpdclient.ParseCommand(l))
+			}
+			if !ended {
+				return
+			}
+			s.runList(w, c, cmds, cmd.Name == "command_list_ok_begin")
+		case "command_list_end":
+			writeAck(w, &mpdclient.MPDError{Ack: mpdclient.AckNotList, CurrentCommand: cmd.Name, MessageText: "not in command list mode"})
+		default:
+			if s.run(w, c, cmd, 0) {
+				w.WriteString("OK\n")
+			}
+		}
+	}
+}
+
+// notInList are the commands not allowed in command lists.
+var notInList = map[string]bool{
+	"idle":                  true,
+	"noidle":                true,
+	"close":                 true,
+	"command_list_begin":    true,
+	"command_list_ok_begin": true,
+}
+
+func writeNotInList(w *bufio.Writer, cmd *mpdclient.Command, num int) {
+	writeAck(w, &mpdclient.MPDError{Ack: mpdclient.AckArg, CommandListNum: uint(num), CurrentCommand: cmd.Name, MessageText: fmt.Sprintf("\"%s\" not allowed in command list", cmd.Name)})
+}
+
+// runList runs the commands of a command list, until one fails.
+func (s *Server) runList(w *bufio.Writer, c *Conn, cmds []*mpdclient.Command, listOK bool) {
+	if s.ListHandler != nil {
+		s.handleList(w, c, cmds, listOK)
+		return
+	}
+	for i, cmd := range cmds {
+		if notInList[cmd.Name] {
+			writeNotInList(w, cmd, i)
+			return
+		}
+		if !s.run(w, c, cmd, i) {
+			return
+		}
+		if listOK {
+			w.WriteString("list_OK\n")
+		}
+	}
+	w.WriteString("OK\n")
+}
+
+// handleList runs a command list with the list handler.
+func (s *Server) handleList(w *bufio.Writer, c *Conn, cmds []*mpdclient.Command, listOK bool) {
+	n := len(cmds)
+	for i, cmd := range cmds {
+		if notInList[cmd.Name] {
+			n = i
+			break
+		}
+	}
+	if n > 0 && !s.runListHandler(w, c, cmds[:n], listOK) {
+		return
+	}
+	if n < len(cmds) {
+		writeNotInList(w, cmds[n], n)
+		return
+	}
+	w.WriteString("OK\n")
+}
+
+// runListHandler runs the list handler and writes its response,
+// and its error if any. It reports whether the commands succeeded.
+func (s *Server) runListHandler(w *bufio.Writer, c *Conn, cmds []*mpdclient.Command, listOK bool) (ok bool) {
+	rw := &ResponseWriter{conn: c, listOK: listOK}
+	defer func() {
+		if err := recover(); err != nil {
+			s.Logger.Error("panic in list handler", "error", err)
+			writeAck(w, ackError(fmt.Errorf("%v", err), "", 0))
+			ok = false
+		}
+	}()
+	err := s.ListHandler(rw, &ListRequest{Commands: cmds, Conn: c})
+	w.Write(rw.buf.Bytes())
+	if err != nil {
+		num := 0
+		var mpdErr *mpdclient.MPDError
+		if errors.As(err, &mpdErr) && int(mpdErr.CommandListNum) < len(cmds) {
+			num = int(mpdErr.CommandListNum)
+		}
+		writeAck(w, ackError(err, cmds[num].Name, num))
+		return false
+	}
+	return true
+}
+
+// run runs a command and writes its response, without the final OK,
+// or its error. It reports whether the command succeeded.
+func (s *Server) run(w *bufio.Writer, c *Conn, cmd *mpdclient.Command, num int) (ok bool) {
+	h := s.handler(cmd.Name)
+	if h == nil {
+		writeAck(w, &mpdclient.MPDError{Ack: mpdclient.AckUnknown, CommandListNum: uint(num), MessageText: fmt.Sprintf("unknown command \"%s\"", cmd.Name)})
+		return false
+	}
+	rw := &ResponseWriter{conn: c}
+	r := &Request{Command: *cmd, Conn: c, ListNum: num}
+	defer func() {
+		if err := recover(); err != nil {
+			s.Logger.Error("panic in handler", "command", cmd.Name, "error", err)
+			writeAck(w, ackError(fmt.Errorf("%v", err), cmd.Name, num))
+			ok = false
+		}
+	}()
+	if err := h(rw, r); err != nil {
+		writeAck(w, ackError(err, cmd.Name, num))
+		return false
+	}
+	w.Write(rw.buf.Bytes())
+	return true
+}
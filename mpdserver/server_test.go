@@ -0,0 +1,212 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+func startServer(t *testing.T) (*Server, string) {
+	s := NewServer()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return s, ln.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	s, addr := startServer(t)
+	volume := 50
+	s.Handle("status", func(w *ResponseWriter, r *Request) error {
+		w.Field("volume", volume)
+		w.Field("state", "play")
+		return nil
+	})
+	s.Handle("setvol", func(w *ResponseWriter, r *Request) error {
+		if len(r.Args) != 1 {
+			return Errorf(mpdclient.AckArg, "wrong number of arguments for \"%s\"", r.Name)
+		}
+		v, err := strconv.Atoi(r.Args[0])
+		if err != nil {
+			return Errorf(mpdclient.AckArg, "Integer expected: %s", r.Args[0])
+		}
+		volume = v
+		s.Notify("mixer")
+		return nil
+	})
+	s.Handle("crash", func(w *ResponseWriter, r *Request) error {
+		w.Field("half", "written")
+		panic("crash")
+	})
+
+	c, err := mpdclient.Dial("tcp", addr, mpdclient.WithLoops(mpdclient.IdleLoop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.ProtocolVersion.String() != DefaultVersion {
+		t.Fatalf("Expected version %s, got %s", DefaultVersion, c.ProtocolVersion)
+	}
+
+	events := c.Idle("mixer")
+	defer events.Close()
+	if err := c.SetVolume(20); err != nil {
+		t.Fatal(err)
+	}
+	if subsystem := <-events.Ch; subsystem != "mixer" {
+		t.Fatalf("Expected a %s event, got %s", "mixer", subsystem)
+	}
+	res := c.Cmd("status")
+	if res.MPDErr != nil || len(res.Data) != 2 || res.Data[0] != "volume: 20" {
+		t.Fatalf("Unexpected status %+v", res)
+	}
+
+	res = c.Cmd("setvol loud")
+	if res.MPDErr == nil || res.MPDErr.Ack != mpdclient.AckArg || res.MPDErr.CurrentCommand != "setvol" {
+		t.Fatalf("Expected an argument error, got %+v", res.MPDErr)
+	}
+	res = c.Cmd("crash")
+	if res.MPDErr == nil || res.MPDErr.Ack != mpdclient.AckSystem || len(res.Data) != 0 {
+		t.Fatalf("Expected a system error, got %+v", res)
+	}
+	res = c.Cmd("nope")
+	if res.MPDErr == nil || res.MPDErr.Ack != mpdclient.AckUnknown {
+		t.Fatalf("Expected an unknown command error, got %+v", res.MPDErr)
+	}
+
+	cl := c.BeginCommandList()
+	cl.Cmd("setvol 30")
+	cl.Cmd("status")
+	cl.Cmd("setvol")
+	cl.Cmd("setvol 40")
+	res = cl.End()
+	if res.MPDErr == nil || res.MPDErr.CommandListNum != 2 || len(res.Data) != 2 || volume != 30 {
+		t.Fatalf("Expected the list to stop at the third command, got %+v, volume %d", res, volume)
+	}
+
+	commands, err := c.Commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(commands) != "[binarylimit close commands crash idle noidle ping setvol status]" {
+		t.Fatalf("Unexpected commands %v", commands)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	s, addr := startServer(t)
+	cover := bytes.Repeat([]byte("OK\n\x00ACK "), 100)
+	s.Handle("albumart", func(w *ResponseWriter, r *Request) error {
+		offset, err := strconv.Atoi(r.Args[1])
+		if err != nil {
+			return Errorf(mpdclient.AckArg, "Integer expected: %s", r.Args[1])
+		}
+		return w.Chunk(cover, offset)
+	})
+
+	c, err := mpdclient.Dial("tcp", addr, mpdclient.WithLoops(0), mpdclient.WithBinaryLimit(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	data, err := c.AlbumArt("a.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, cover) {
+		t.Fatalf("Expected %d bytes of cover, got %d", len(cover), len(data))
+	}
+
+	// Forwarding a response with binary data gives it back
+	res := c.Cmd("albumart a.ogg 640")
+	w := &ResponseWriter{conn: newConn(nil)}
+	if err := w.WriteResponse(res); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("size: 800\nbinary: 128\n%s\n", cover[640:768]); w.buf.String() != want {
+		t.Fatalf("Expected %q, got %q", want, w.buf.String())
+	}
+}
+
+func TestListHandler(t *testing.T) {
+	s, addr := startServer(t)
+	var lists [][]*mpdclient.Command
+	s.ListHandler = func(w *ResponseWriter, r *ListRequest) error {
+		lists = append(lists, r.Commands)
+		for i, cmd := range r.Commands {
+			if cmd.Name == "fail" {
+				return &mpdclient.MPDError{Ack: mpdclient.AckArg, CommandListNum: uint(i), MessageText: "failed"}
+			}
+			w.Field("name", cmd.Name)
+			w.ListOK()
+		}
+		return nil
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	r.ReadString('\n')
+	fmt.Fprint(conn, "command_list_ok_begin\na\nb\ncommand_list_end\n")
+	fmt.Fprint(conn, "command_list_begin\na\nfail\nb\ncommand_list_end\n")
+	fmt.Fprint(conn, "command_list_ok_begin\na\nidle\nb\ncommand_list_end\n")
+	for _, want := range []string{
+		"name: a\n", "list_OK\n", "name: b\n", "list_OK\n", "OK\n",
+		"name: a\n", "ACK [2@1] {fail} failed\n",
+		"name: a\n", "list_OK\n", "ACK [2@1] {idle} \"idle\" not allowed in command list\n",
+	} {
+		if line, err := r.ReadString('\n'); err != nil || line != want {
+			t.Fatalf("Expected %q, got %q (%v)", want, line, err)
+		}
+	}
+	if len(lists) != 3 || len(lists[2]) != 1 {
+		t.Fatalf("Unexpected command lists %v", lists)
+	}
+}
+
+func TestNoIdle(t *testing.T) {
+	_, addr := startServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	r.ReadString('\n')
+	fmt.Fprint(conn, "idle player\nnoidle\nnoidle\ncommand_list_begin\nping\nidle\ncommand_list_end\n")
+	// The second noidle gets no response
+	for _, want := range []string{"OK\n", "ACK [2@1] {idle} \"idle\" not allowed in command list\n"} {
+		if line, err := r.ReadString('\n'); err != nil || line != want {
+			t.Fatalf("Expected %q, got %q (%v)", want, line, err)
+		}
+	}
+}
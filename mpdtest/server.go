@@ -0,0 +1,129 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package mpdtest provides a fake MPD server for tests.
+//
+// The server answers commands with canned responses, and supports
+// idle, noidle and command lists:
+//
+//	s, err := mpdtest.NewServer()
+//	// ...
+//	defer s.Close()
+//	s.Respond("status", "state: play\nvolume: 50\n")
+//	c, err := mpdclient.Dial("tcp", s.Addr)
+//	// ...
+//	s.Notify("player")
+package mpdtest
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+)
+
+// Server is a fake MPD server listening on the loopback interface.
+// Handlers can be registered on it for the commands which need
+// more than a canned response.
+type Server struct {
+	*mpdserver.Server
+	// Addr is the address of the server, for mpdclient.Dial.
+	Addr string
+
+	mu        sync.Mutex
+	responses map[string]string
+	errors    map[string]*mpdclient.MPDError
+	commands  []*mpdclient.Command
+	done      chan struct{}
+}
+
+// NewServer starts a server on a random port.
+// The password command is answered by default.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Server:    mpdserver.NewServer(),
+		Addr:      ln.Addr().String(),
+		responses: map[string]string{"password": ""},
+		errors:    make(map[string]*mpdclient.MPDError),
+		done:      make(chan struct{}),
+	}
+	s.Server.NotFound = s.respond
+	go func() {
+		defer close(s.done)
+		s.Serve(ln)
+	}()
+	return s, nil
+}
+
+// Respond sets the response to a command, its lines
+// without the final OK.
+func (s *Server) Respond(command, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[command] = strings.TrimSuffix(data, "\n")
+	delete(s.errors, command)
+}
+
+// Fail makes a command fail with an ACK error.
+func (s *Server) Fail(command string, ack uint, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[command] = &mpdclient.MPDError{Ack: ack, CurrentCommand: command, MessageText: message}
+}
+
+// Commands returns the commands received so far,
+// other than those mpdserver handles itself.
+func (s *Server) Commands() []*mpdclient.Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*mpdclient.Command(nil), s.commands...)
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() error {
+	err := s.Server.Close()
+	<-s.done
+	return err
+}
+
+func (s *Server) respond(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd := r.Command
+	s.commands = append(s.commands, &cmd)
+	if mpdErr, ok := s.errors[r.Name]; ok {
+		return mpdErr
+	}
+	data, ok := s.responses[r.Name]
+	if !ok {
+		return mpdserver.Errorf(mpdclient.AckUnknown, "unknown command \"%s\"", r.Name)
+	}
+	if data != "" {
+		for _, line := range strings.Split(data, "\n") {
+			w.Line(line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdtest
+
+import (
+	"testing"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+func TestServer(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Respond("stats", "songs: 3\nuptime: 10")
+	s.Fail("clear", mpdclient.AckPermission, "you don't have permission for \"clear\"")
+
+	c, err := mpdclient.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Songs != 3 {
+		t.Fatalf("Expected %d songs, got %d", 3, stats.Songs)
+	}
+	err = c.Clear()
+	if mpdErr, ok := err.(*mpdclient.MPDError); !ok || mpdErr.Ack != mpdclient.AckPermission {
+		t.Fatalf("Expected a permission error, got %v", err)
+	}
+
+	cl := c.BeginCommandList()
+	cl.Cmd("ping")
+	cl.Cmd("unknown")
+	if res := cl.End(); res.MPDErr == nil || res.MPDErr.Ack != mpdclient.AckUnknown || res.MPDErr.CommandListNum != 1 {
+		t.Fatalf("Expected the second command to fail, got %+v", res)
+	}
+
+	events := c.Idle("player")
+	defer events.Close()
+	s.Notify("mixer", "player")
+	if subsystem := <-events.Ch; subsystem != "player" {
+		t.Fatalf("Expected a %s event, got %s", "player", subsystem)
+	}
+
+	var names []string
+	for _, cmd := range s.Commands() {
+		names = append(names, cmd.Name)
+	}
+	if len(names) != 3 || names[0] != "stats" || names[1] != "clear" {
+		t.Fatalf("Unexpected commands %v", names)
+	}
+}
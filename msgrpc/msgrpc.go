@@ -0,0 +1,328 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package msgrpc implements request/response RPC on top of
+// MPD client-to-client channels.
+//
+// Every peer subscribes to a channel named after itself. Requests
+// and responses are JSON-encoded envelopes sent with sendmessage;
+// a request carries the channel the response must be sent to and an
+// id used to correlate the response with the pending call.
+//
+// A Peer only reads the messages of its own channel, so the MPDClient
+// it wraps can be shared with other readers of messages.
+package msgrpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+const DefaultTimeout = 5 * time.Second
+
+// Error codes sent back in an error envelope.
+const (
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeInternal       = -32603
+)
+
+var (
+	ErrTimeout = errors.New("msgrpc: call timed out")
+	ErrClosed  = errors.New("msgrpc: peer closed")
+)
+
+// Envelope is the JSON message exchanged on the channels.
+// Requests have a Method; responses have the Id of the request
+// and either a Result or an Error.
+type Envelope struct {
+	Id      string          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	ReplyTo string          `json:"reply_to,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("msgrpc: %s (%d)", e.Message, e.Code)
+}
+
+// Request is what a handler receives.
+type Request struct {
+	Method string
+	Params json.RawMessage
+	// From is the channel of the calling peer,
+	// empty for notifications.
+	From string
+}
+
+// Decode unmarshals the request parameters into v.
+func (r *Request) Decode(v interface{}) error {
+	if len(r.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Params, v); err != nil {
+		return &Error{ErrCodeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+// HandlerFunc handles a request. The returned value is JSON-encoded
+// in the response. Returning an *Error sends it as is to the caller.
+type HandlerFunc func(req *Request) (interface{}, error)
+
+type Peer struct {
+	// Timeout bounds how long Call waits for a response.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	c        *mpdclient.MPDClient
+	channel  string
+	events   chan string
+	stopIdle func()
+	done     chan struct{}
+
+	mu       sync.Mutex
+	handlers map[string]HandlerFunc
+	pending  map[string]chan *Envelope
+	closed   bool
+}
+
+// NewPeer creates a peer named channel on the MPD server c is connected to.
+// Handlers should be registered before calling Start.
+func NewPeer(c *mpdclient.MPDClient, channel string) *Peer {
+	return &Peer{
+		Timeout:  DefaultTimeout,
+		c:        c,
+		channel:  channel,
+		done:     make(chan struct{}),
+		handlers: make(map[string]HandlerFunc),
+		pending:  make(map[string]chan *Envelope),
+	}
+}
+
+func (p *Peer) Channel() string {
+	return p.channel
+}
+
+// Handle registers the handler for method.
+func (p *Peer) Handle(method string, h HandlerFunc) {
+	p.mu.Lock()
+	p.handlers[method] = h
+	p.mu.Unlock()
+}
+
+// Start subscribes the peer to its channel and starts
+// dispatching incoming envelopes.
+func (p *Peer) Start() error {
+	l := p.c.Idle("message")
+	p.events = l.Ch
+	p.stopIdle = l.Close
+	if err := p.c.Subscribe(p.channel); err != nil {
+		p.stopIdle()
+		return err
+	}
+	go p.loop()
+	return nil
+}
+
+// Close unsubscribes from the channel. Pending calls fail with ErrClosed.
+func (p *Peer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.done)
+	p.stopIdle()
+	return p.c.Unsubscribe(p.channel)
+}
+
+// Call invokes method on the peer listening on channel and stores
+// the result in result, which may be nil.
+func (p *Peer) Call(channel, method string, params, result interface{}) error {
+	id, err := newId()
+	if err != nil {
+		return err
+	}
+	env := &Envelope{Id: id, Method: method, ReplyTo: p.channel}
+	if env.Params, err = marshal(params); err != nil {
+		return err
+	}
+
+	ch := make(chan *Envelope, 1)
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.pending[id] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	if err := p.send(channel, env); err != nil {
+		return err
+	}
+
+	var timeout <-chan time.Time
+	if p.Timeout > 0 {
+		timer := time.NewTimer(p.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case res := <-ch:
+		if res.Error != nil {
+			return res.Error
+		}
+		if result != nil && len(res.Result) > 0 {
+			return json.Unmarshal(res.Result, result)
+		}
+		return nil
+	case <-timeout:
+		return ErrTimeout
+	case <-p.done:
+		return ErrClosed
+	}
+}
+
+// Notify invokes method on the peer listening on channel
+// without waiting for a response.
+func (p *Peer) Notify(channel, method string, params interface{}) error {
+	raw, err := marshal(params)
+	if err != nil {
+		return err
+	}
+	return p.send(channel, &Envelope{Method: method, Params: raw})
+}
+
+func (p *Peer) send(channel string, env *Envelope) error {
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return p.c.SendMessage(channel, string(b))
+}
+
+func (p *Peer) loop() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case _, ok := <-p.events:
+			if !ok {
+				return
+			}
+		}
+		msgs, err := p.c.ReadChannelMessages(p.channel)
+		if err != nil {
+			p.c.Logger.Warn("msgrpc: reading messages failed", "error", err)
+			continue
+		}
+		for _, msg := range msgs {
+			var env Envelope
+			if err := json.Unmarshal([]byte(msg.Message), &env); err != nil {
+				p.c.Logger.Warn("msgrpc: discarding message", "channel", msg.Channel, "error", err)
+				continue
+			}
+			p.dispatch(&env)
+		}
+	}
+}
+
+func (p *Peer) dispatch(env *Envelope) {
+	if env.Method == "" {
+		// The channel of the call has room for one response,
+		// a duplicate one is dropped.
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if ch, ok := p.pending[env.Id]; ok {
+			select {
+			case ch <- env:
+			default:
+			}
+		}
+		return
+	}
+	p.mu.Lock()
+	h, ok := p.handlers[env.Method]
+	p.mu.Unlock()
+	go p.serve(env, h, ok)
+}
+
+func (p *Peer) serve(env *Envelope, h HandlerFunc, found bool) {
+	res := &Envelope{Id: env.Id}
+	if !found {
+		res.Error = &Error{ErrCodeMethodNotFound, fmt.Sprintf("method not found: %s", env.Method)}
+	} else {
+		v, err := h(&Request{env.Method, env.Params, env.ReplyTo})
+		if err == nil {
+			res.Result, err = marshal(v)
+		}
+		if err != nil {
+			rpcErr, ok := err.(*Error)
+			if !ok {
+				rpcErr = &Error{ErrCodeInternal, err.Error()}
+			}
+			res.Error = rpcErr
+		}
+	}
+	// Notifications get no response
+	if env.Id == "" || env.ReplyTo == "" {
+		return
+	}
+	if err := p.send(env.ReplyTo, res); err != nil {
+		p.c.Logger.Warn("msgrpc: sending response failed", "channel", env.ReplyTo, "error", err)
+	}
+}
+
+func marshal(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func newId() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,200 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package msgrpc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+// broker implements the client-to-client commands on a fake server.
+type broker struct {
+	mu       sync.Mutex
+	subs     map[*mpdserver.Conn]map[string]bool
+	messages map[*mpdserver.Conn][]mpdclient.ChannelMessage
+}
+
+func newBroker(t *testing.T) *mpdtest.Server {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	b := &broker{
+		subs:     make(map[*mpdserver.Conn]map[string]bool),
+		messages: make(map[*mpdserver.Conn][]mpdclient.ChannelMessage),
+	}
+	s.Handle("subscribe", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.subs[r.Conn] == nil {
+			b.subs[r.Conn] = make(map[string]bool)
+		}
+		b.subs[r.Conn][r.Args[0]] = true
+		return nil
+	})
+	s.Handle("unsubscribe", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[r.Conn], r.Args[0])
+		return nil
+	})
+	s.Handle("sendmessage", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for conn, channels := range b.subs {
+			if channels[r.Args[0]] {
+				b.messages[conn] = append(b.messages[conn], mpdclient.ChannelMessage{Channel: r.Args[0], Message: r.Args[1]})
+				conn.Notify("message")
+			}
+		}
+		return nil
+	})
+	s.Handle("readmessages", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, msg := range b.messages[r.Conn] {
+			w.Field("channel", msg.Channel)
+			w.Field("message", msg.Message)
+		}
+		delete(b.messages, r.Conn)
+		return nil
+	})
+	return s
+}
+
+func dial(t *testing.T, s *mpdtest.Server) *mpdclient.MPDClient {
+	c, err := mpdclient.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+type sumArgs struct {
+	A, B int
+}
+
+func TestCallRoundTrip(t *testing.T) {
+	s := newBroker(t)
+	mpdc1, mpdc2 := dial(t, s), dial(t, s)
+
+	server := NewPeer(mpdc1, "msgrpc-test-server")
+	server.Handle("sum", func(req *Request) (interface{}, error) {
+		var args sumArgs
+		if err := req.Decode(&args); err != nil {
+			return nil, err
+		}
+		return args.A + args.B, nil
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client := NewPeer(mpdc2, "msgrpc-test-client")
+	client.Timeout = 2 * time.Second
+	if err := client.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Messages of another channel of the client are left alone.
+	if err := mpdc2.Subscribe("other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mpdc1.SendMessage("other", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	var sum int
+	if err := client.Call(server.Channel(), "sum", sumArgs{2, 3}, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 5 {
+		t.Fatalf("Expected %d, got %d", 5, sum)
+	}
+
+	err := client.Call(server.Channel(), "nope", nil, nil)
+	rpcErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected *Error, got %v", err)
+	}
+	if rpcErr.Code != ErrCodeMethodNotFound {
+		t.Fatalf("Expected code %d, got %d", ErrCodeMethodNotFound, rpcErr.Code)
+	}
+
+	msgs, err := mpdc2.ReadMessages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0] != (mpdclient.ChannelMessage{Channel: "other", Message: "hello"}) {
+		t.Fatalf("Expected the message of the other channel, got %+v", msgs)
+	}
+}
+
+func TestCallClose(t *testing.T) {
+	s := newBroker(t)
+	mpdc1, mpdc2 := dial(t, s), dial(t, s)
+
+	// A peer which doesn't answer until the end of the test
+	release := make(chan struct{})
+	defer close(release)
+	silent := NewPeer(mpdc1, "msgrpc-test-silent")
+	silent.Handle("wait", func(req *Request) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	if err := silent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	client := NewPeer(mpdc2, "msgrpc-test-client")
+	client.Timeout = 0
+	if err := client.Start(); err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Call(silent.Channel(), "wait", nil, nil)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-errCh:
+		t.Fatalf("Expected the call to wait without timeout, got %v", err)
+	default:
+	}
+	client.Close()
+	select {
+	case err := <-errCh:
+		if err != ErrClosed {
+			t.Fatalf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the call to fail")
+	}
+}
@@ -0,0 +1,69 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package multiroom
+
+import "sync"
+
+// Event is an idle event of a room.
+type Event struct {
+	Room      string `json:"room"`
+	Subsystem string `json:"subsystem"`
+}
+
+// Listener receives the idle events of all the rooms of a group.
+type Listener struct {
+	Ch   chan Event
+	done chan struct{}
+	once sync.Once
+}
+
+// Close stops the delivery of events to the listener.
+func (l *Listener) Close() {
+	l.once.Do(func() {
+		close(l.done)
+	})
+}
+
+// Idle listens to the idle events of the rooms of the group,
+// tagged with the name of their room. The rooms added to the group
+// afterwards are not listened to.
+func (g *Group) Idle(subsystems ...string) *Listener {
+	l := &Listener{Ch: make(chan Event), done: make(chan struct{})}
+	for _, r := range g.Rooms() {
+		events := r.Client.Idle(subsystems...)
+		go func() {
+			defer events.Close()
+			for {
+				select {
+				case subsystem := <-events.Ch:
+					select {
+					case l.Ch <- Event{r.Name, subsystem}:
+					case <-l.done:
+						return
+					}
+				case <-r.Client.Lost():
+					return
+				case <-l.done:
+					return
+				}
+			}
+		}()
+	}
+	return l
+}
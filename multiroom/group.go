@@ -0,0 +1,317 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package multiroom controls several MPD servers as a group,
+// one per room: broadcasting commands to them, aggregating their
+// status and idle events, and keeping the followers in sync with
+// a leader.
+//
+//	g := multiroom.NewGroup(
+//		&multiroom.Room{Name: "living", Client: living},
+//		&multiroom.Room{Name: "kitchen", Client: kitchen, VolumeOffset: -15},
+//	)
+//	g.MirrorQueue, g.Follow = true, true
+//	g.Start()
+//	defer g.Close()
+//	err := g.SetVolume(60)
+package multiroom
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// Room is a MPD server of a group.
+type Room struct {
+	Name   string
+	Client *mpdclient.MPDClient
+	// VolumeOffset is added to the volumes set on the group.
+	VolumeOffset int
+}
+
+// Errors are the errors of the rooms of a broadcast command,
+// by room name.
+type Errors map[string]error
+
+func (e Errors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Group is a group of rooms. The first room is the leader,
+// which the others follow.
+type Group struct {
+	// MirrorQueue keeps the queues of the followers the same
+	// as the queue of the leader, once started.
+	MirrorQueue bool
+	// Follow keeps the followers playing the song of the leader,
+	// seeking when they drift more than DriftThreshold, once started.
+	Follow         bool
+	DriftThreshold time.Duration
+	// SyncInterval is the interval between drift checks.
+	SyncInterval time.Duration
+	Logger       *slog.Logger
+
+	mu      sync.Mutex
+	rooms   []*Room
+	changed chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewGroup returns a group of rooms, led by the first one.
+func NewGroup(rooms ...*Room) *Group {
+	return &Group{
+		DriftThreshold: 500 * time.Millisecond,
+		SyncInterval:   5 * time.Second,
+		Logger:         slog.New(slog.DiscardHandler),
+		rooms:          rooms,
+		changed:        make(chan struct{}, 1),
+	}
+}
+
+// Rooms returns the rooms of the group, the leader first.
+func (g *Group) Rooms() []*Room {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*Room(nil), g.rooms...)
+}
+
+// Room returns the room with a name, or nil.
+func (g *Group) Room(name string) *Room {
+	for _, r := range g.Rooms() {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Leader returns the leading room, or nil for an empty group.
+func (g *Group) Leader() *Room {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.rooms) == 0 {
+		return nil
+	}
+	return g.rooms[0]
+}
+
+// SetLeader makes a room the leader.
+func (g *Group) SetLeader(name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, r := range g.rooms {
+		if r.Name == name {
+			copy(g.rooms[1:i+1], g.rooms[:i])
+			g.rooms[0] = r
+			g.touch()
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("Unknown room: %s", name))
+}
+
+// Add adds a room to the group, as a follower.
+func (g *Group) Add(r *Room) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rooms = append(g.rooms, r)
+	g.touch()
+}
+
+// Remove removes a room from the group.
+func (g *Group) Remove(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, r := range g.rooms {
+		if r.Name == name {
+			g.rooms = append(g.rooms[:i:i], g.rooms[i+1:]...)
+			g.touch()
+			return
+		}
+	}
+}
+
+// touch notifies the started group that the rooms changed.
+func (g *Group) touch() {
+	select {
+	case g.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Broadcast runs f on all the rooms concurrently.
+// It returns Errors if f fails in some of the rooms.
+func (g *Group) Broadcast(f func(r *Room) error) error {
+	rooms := g.Rooms()
+	errs := make([]error, len(rooms))
+	var wg sync.WaitGroup
+	for i, r := range rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = f(r)
+		}()
+	}
+	wg.Wait()
+	var e Errors
+	for i, err := range errs {
+		if err != nil {
+			if e == nil {
+				e = make(Errors)
+			}
+			e[rooms[i].Name] = err
+		}
+	}
+	if e != nil {
+		return e
+	}
+	return nil
+}
+
+// Play starts playing in all the rooms, at a position of their queue
+// or at their current song if pos is negative.
+func (g *Group) Play(pos int) error {
+	return g.Broadcast(func(r *Room) error { return r.Client.Play(pos) })
+}
+
+// Pause pauses or resumes all the rooms.
+func (g *Group) Pause(pause bool) error {
+	return g.Broadcast(func(r *Room) error { return r.Client.Pause(pause) })
+}
+
+// Stop stops all the rooms.
+func (g *Group) Stop() error {
+	return g.Broadcast(func(r *Room) error { return r.Client.Stop() })
+}
+
+// Next plays the next song in all the rooms.
+func (g *Group) Next() error {
+	return g.Broadcast(func(r *Room) error { return r.Client.Next() })
+}
+
+// Previous plays the previous song in all the rooms.
+func (g *Group) Previous() error {
+	return g.Broadcast(func(r *Room) error { return r.Client.Previous() })
+}
+
+// SetVolume sets the volume of the rooms to volume plus their
+// offset, within 0 and 100.
+func (g *Group) SetVolume(volume int) error {
+	return g.Broadcast(func(r *Room) error {
+		return r.Client.SetVolume(min(max(volume+r.VolumeOffset, 0), 100))
+	})
+}
+
+// Load replaces the queues of the rooms with a stored playlist.
+func (g *Group) Load(playlist string) error {
+	return g.Broadcast(func(r *Room) error {
+		if err := r.Client.Clear(); err != nil {
+			return err
+		}
+		return r.Client.Load(playlist)
+	})
+}
+
+// RoomStatus is the status of a room.
+type RoomStatus struct {
+	Name   string                 `json:"name"`
+	Player *mpdclient.PlayerState `json:"player,omitempty"`
+	Song   *mpdclient.Song        `json:"song,omitempty"`
+	Err    error                  `json:"-"`
+}
+
+// Status is the status of the rooms of a group.
+type Status struct {
+	Rooms []RoomStatus `json:"rooms"`
+	// State is the state of the players, or an empty string
+	// when they differ or some rooms failed.
+	State string `json:"state"`
+	// Playing is the number of rooms playing.
+	Playing int `json:"playing"`
+	// Drift is the largest difference between the elapsed time
+	// of the leader and of the followers playing the same song.
+	Drift time.Duration `json:"drift"`
+}
+
+// Status returns the status of all the rooms. The rooms which
+// fail have their error set instead.
+func (g *Group) Status() *Status {
+	rooms := g.Rooms()
+	s := &Status{Rooms: make([]RoomStatus, len(rooms))}
+	var wg sync.WaitGroup
+	for i, r := range rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rs := RoomStatus{Name: r.Name}
+			rs.Player, rs.Err = r.Client.PlayerState()
+			if rs.Err == nil {
+				rs.Song, rs.Err = r.Client.Playing()
+			}
+			s.Rooms[i] = rs
+		}()
+	}
+	wg.Wait()
+
+	states := make(map[string]bool)
+	failed := false
+	for _, rs := range s.Rooms {
+		if rs.Err != nil {
+			failed = true
+			continue
+		}
+		states[rs.Player.State] = true
+		if rs.Player.State == mpdclient.StatePlay {
+			s.Playing++
+		}
+	}
+	if !failed && len(states) == 1 {
+		s.State = s.Rooms[0].Player.State
+	}
+	if leader := s.Rooms; len(leader) > 0 && leader[0].Err == nil && leader[0].Song != nil {
+		for _, rs := range s.Rooms[1:] {
+			if rs.Err != nil || rs.Song == nil || rs.Song.File != leader[0].Song.File {
+				continue
+			}
+			drift := rs.Player.Elapsed - leader[0].Player.Elapsed
+			if drift < 0 {
+				drift = -drift
+			}
+			s.Drift = max(s.Drift, drift)
+		}
+	}
+	return s
+}
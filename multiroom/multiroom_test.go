@@ -0,0 +1,218 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package multiroom
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+func newRoom(t *testing.T, name string) (*Room, *mpdtest.Server) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	for _, cmd := range []string{"setvol", "clear", "add", "delete", "seek", "seekid", "play", "pause", "stop"} {
+		s.Respond(cmd, "")
+	}
+	s.Respond("replay_gain_status", "replay_gain_mode: off")
+	c, err := mpdclient.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return &Room{Name: name, Client: c}, s
+}
+
+func playing(s *mpdtest.Server, file string, id int, elapsed string) {
+	s.Respond("status", fmt.Sprintf("state: play\nsong: 0\nsongid: %d\nelapsed: %s", id, elapsed))
+	s.Respond("currentsong", fmt.Sprintf("file: %s\nPos: 0\nId: %d", file, id))
+}
+
+func commands(s *mpdtest.Server, name string) []string {
+	var cmds []string
+	for _, cmd := range s.Commands() {
+		if cmd.Name == name {
+			cmds = append(cmds, cmd.String())
+		}
+	}
+	return cmds
+}
+
+func TestBroadcast(t *testing.T) {
+	living, ls := newRoom(t, "living")
+	kitchen, ks := newRoom(t, "kitchen")
+	kitchen.VolumeOffset = -15
+	g := NewGroup(living, kitchen)
+
+	if err := g.SetVolume(10); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := commands(ls, "setvol"); len(cmds) != 1 || cmds[0] != `setvol "10"` {
+		t.Errorf("Unexpected living room commands %v", cmds)
+	}
+	if cmds := commands(ks, "setvol"); len(cmds) != 1 || cmds[0] != `setvol "0"` {
+		t.Errorf("Unexpected kitchen commands %v", cmds)
+	}
+
+	ks.Fail("stop", mpdclient.AckSystem, "broken")
+	err := g.Stop()
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 1 || errs["kitchen"] == nil {
+		t.Fatalf("Expected the kitchen to fail, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "kitchen: ") {
+		t.Errorf("Unexpected error %q", err)
+	}
+
+	if err := g.SetLeader("kitchen"); err != nil {
+		t.Fatal(err)
+	}
+	if g.Leader() != kitchen || g.Rooms()[1] != living {
+		t.Errorf("Expected the kitchen to lead")
+	}
+	if err := g.SetLeader("garage"); err == nil {
+		t.Errorf("Expected an error for an unknown room")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	living, ls := newRoom(t, "living")
+	kitchen, ks := newRoom(t, "kitchen")
+	g := NewGroup(living, kitchen)
+	playing(ls, "a.ogg", 1, "10.000")
+	playing(ks, "a.ogg", 2, "12.500")
+
+	s := g.Status()
+	if s.State != mpdclient.StatePlay || s.Playing != 2 || s.Drift != 2500*time.Millisecond {
+		t.Fatalf("Unexpected status %+v", s)
+	}
+
+	ks.Fail("status", mpdclient.AckSystem, "broken")
+	s = g.Status()
+	if s.State != "" || s.Playing != 1 || s.Rooms[1].Err == nil {
+		t.Fatalf("Unexpected status %+v", s)
+	}
+}
+
+func TestIdle(t *testing.T) {
+	living, _ := newRoom(t, "living")
+	kitchen, ks := newRoom(t, "kitchen")
+	g := NewGroup(living, kitchen)
+	l := g.Idle("player")
+	defer l.Close()
+
+	ks.Notify("player")
+	select {
+	case e := <-l.Ch:
+		if e != (Event{"kitchen", "player"}) {
+			t.Fatalf("Unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for an event")
+	}
+}
+
+func TestMirror(t *testing.T) {
+	living, ls := newRoom(t, "living")
+	kitchen, ks := newRoom(t, "kitchen")
+	g := NewGroup(living, kitchen)
+	ls.Respond("playlistinfo", "file: a.ogg\nPos: 0\nId: 1\nfile: b.ogg\nPos: 1\nId: 2\nfile: c d.ogg\nPos: 2\nId: 3")
+	ks.Respond("playlistinfo", "file: a.ogg\nPos: 0\nId: 1\nfile: x.ogg\nPos: 1\nId: 2\nfile: y.ogg\nPos: 2\nId: 3")
+
+	if err := g.Mirror(); err != nil {
+		t.Fatal(err)
+	}
+	var cmds []string
+	for _, cmd := range ks.Commands() {
+		if cmd.Name != "playlistinfo" {
+			cmds = append(cmds, cmd.String())
+		}
+	}
+	expected := []string{`delete "1:3"`, `add "b.ogg"`, `add "c d.ogg"`}
+	if strings.Join(cmds, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected %v, got %v", expected, cmds)
+	}
+	if cmds := commands(ls, "add"); len(cmds) != 0 {
+		t.Errorf("Expected the leader to be left alone, got %v", cmds)
+	}
+}
+
+func TestSync(t *testing.T) {
+	living, ls := newRoom(t, "living")
+	kitchen, ks := newRoom(t, "kitchen")
+	g := NewGroup(living, kitchen)
+	playing(ls, "a.ogg", 1, "10.000")
+	playing(ks, "a.ogg", 2, "10.200")
+
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := commands(ks, "seekid"); len(cmds) != 0 {
+		t.Fatalf("Expected no seek within the threshold, got %v", cmds)
+	}
+
+	playing(ks, "a.ogg", 2, "13.000")
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	cmds := commands(ks, "seekid")
+	if len(cmds) != 1 || !strings.HasPrefix(cmds[0], `seekid "2" "10.`) {
+		t.Fatalf("Expected a seek to the leader, got %v", cmds)
+	}
+
+	ks.Respond("status", "state: stop")
+	ks.Respond("playlistinfo", "file: a.ogg\nPos: 0\nId: 2")
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := commands(ks, "seek"); len(cmds) != 1 || !strings.HasPrefix(cmds[0], `seek "0" "10.`) {
+		t.Fatalf("Expected the kitchen to start playing, got %v", cmds)
+	}
+}
+
+func TestStart(t *testing.T) {
+	living, ls := newRoom(t, "living")
+	kitchen, ks := newRoom(t, "kitchen")
+	g := NewGroup(living, kitchen)
+	g.MirrorQueue = true
+	ls.Respond("playlistinfo", "")
+	ks.Respond("playlistinfo", "")
+	g.Start()
+	defer g.Close()
+
+	ls.Respond("playlistinfo", "file: a.ogg\nPos: 0\nId: 1")
+	ls.Notify("playlist")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(commands(ks, "add")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the queue to be mirrored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cmds := commands(ks, "add"); cmds[0] != `add "a.ogg"` {
+		t.Fatalf("Unexpected commands %v", cmds)
+	}
+}
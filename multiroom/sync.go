@@ -0,0 +1,262 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package multiroom
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// maxCommandListLen is the number of commands sent in one command list
+// when mirroring a queue.
+const maxCommandListLen = 512
+
+// Mirror makes the queues of the followers the same as the queue
+// of the leader. The songs the queues start with are kept, so
+// a follower playing one of those is not interrupted.
+func (g *Group) Mirror() error {
+	rooms := g.Rooms()
+	if len(rooms) < 2 {
+		return nil
+	}
+	queue, err := rooms[0].Client.Queue()
+	if err != nil {
+		return Errors{rooms[0].Name: err}
+	}
+	uris := make([]string, len(queue))
+	for i, song := range queue {
+		uris[i] = song.File
+	}
+	return g.broadcastFollowers(rooms, func(r *Room) error {
+		return mirror(r.Client, uris)
+	})
+}
+
+func mirror(c *mpdclient.MPDClient, uris []string) error {
+	queue, err := c.Queue()
+	if err != nil {
+		return err
+	}
+	n := 0
+	for n < len(queue) && n < len(uris) && queue[n].File == uris[n] {
+		n++
+	}
+	var cmds []string
+	if n < len(queue) {
+		cmds = append(cmds, fmt.Sprintf("delete %d:%d", n, len(queue)))
+	}
+	for _, uri := range uris[n:] {
+		cmd := &mpdclient.Command{Name: "add", Args: []string{uri}}
+		cmds = append(cmds, cmd.String())
+	}
+	for i := 0; i < len(cmds); i += maxCommandListLen {
+		l := c.BeginCommandList()
+		for _, cmd := range cmds[i:min(i+maxCommandListLen, len(cmds))] {
+			l.Cmd(cmd)
+		}
+		res := l.End()
+		if res.Err != nil {
+			return res.Err
+		}
+		if res.MPDErr != nil {
+			return res.MPDErr
+		}
+	}
+	return nil
+}
+
+// Sync makes the followers play the song of the leader, in the same
+// state. The followers whose elapsed time differs from the leader's by
+// more than DriftThreshold seek to it. The song is looked up at the
+// position of the leader's in the queue of the followers, which should
+// be mirrored.
+func (g *Group) Sync() error {
+	rooms := g.Rooms()
+	if len(rooms) < 2 {
+		return nil
+	}
+	leader := rooms[0]
+	state, err := leader.Client.PlayerState()
+	if err != nil {
+		return Errors{leader.Name: err}
+	}
+	fetched := time.Now()
+	var song *mpdclient.Song
+	if state.State != mpdclient.StateStop {
+		if song, err = leader.Client.Playing(); err != nil {
+			return Errors{leader.Name: err}
+		}
+	}
+	return g.broadcastFollowers(rooms, func(r *Room) error {
+		target := state.Elapsed
+		if state.State == mpdclient.StatePlay {
+			target += time.Since(fetched)
+		}
+		return g.follow(r, state, song, target)
+	})
+}
+
+func (g *Group) follow(r *Room, leader *mpdclient.PlayerState, song *mpdclient.Song, target time.Duration) error {
+	c := r.Client
+	state, err := c.PlayerState()
+	if err != nil {
+		return err
+	}
+	if leader.State == mpdclient.StateStop || song == nil {
+		if state.State != mpdclient.StateStop {
+			return c.Stop()
+		}
+		return nil
+	}
+	var current *mpdclient.Song
+	if state.State != mpdclient.StateStop {
+		if current, err = c.Playing(); err != nil {
+			return err
+		}
+	}
+	if current == nil || current.File != song.File {
+		queued, err := c.QueueSong(leader.Song)
+		if err != nil {
+			return err
+		}
+		if queued == nil || queued.File != song.File {
+			g.Logger.Warn("song of the leader not queued", "room", r.Name, "pos", leader.Song, "file", song.File)
+			return nil
+		}
+		if err := c.Seek(leader.Song, target); err != nil {
+			return err
+		}
+		return c.Pause(leader.State == mpdclient.StatePause)
+	}
+	if state.State != leader.State {
+		if err := c.Pause(leader.State == mpdclient.StatePause); err != nil {
+			return err
+		}
+	}
+	drift := state.Elapsed - target
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > g.DriftThreshold {
+		g.Logger.Debug("drift", "room", r.Name, "drift", drift)
+		return c.SeekId(state.SongId, target)
+	}
+	return nil
+}
+
+// broadcastFollowers runs f on all the rooms but the first, concurrently.
+func (g *Group) broadcastFollowers(rooms []*Room, f func(r *Room) error) error {
+	followers := make(map[*Room]bool, len(rooms)-1)
+	for _, r := range rooms[1:] {
+		followers[r] = true
+	}
+	return g.Broadcast(func(r *Room) error {
+		if !followers[r] {
+			return nil
+		}
+		return f(r)
+	})
+}
+
+// Start keeps the followers mirroring the queue and following the
+// playback of the leader, according to MirrorQueue and Follow, until
+// the group is closed. It returns immediately.
+func (g *Group) Start() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done != nil {
+		return
+	}
+	g.done = make(chan struct{})
+	g.wg.Add(1)
+	go g.run(g.done)
+}
+
+// Close stops the group started with Start.
+// It does not close the clients of the rooms.
+func (g *Group) Close() {
+	g.mu.Lock()
+	done := g.done
+	g.done = nil
+	g.mu.Unlock()
+	if done != nil {
+		close(done)
+		g.wg.Wait()
+	}
+}
+
+func (g *Group) run(done chan struct{}) {
+	defer g.wg.Done()
+	ticker := time.NewTicker(g.SyncInterval)
+	defer ticker.Stop()
+	for g.watch(g.Leader(), ticker, done) {
+	}
+}
+
+// watch mirrors and syncs on the events of the leader, and returns
+// whether to watch again when the rooms change.
+func (g *Group) watch(leader *Room, ticker *time.Ticker, done chan struct{}) bool {
+	var events chan string
+	var lost <-chan struct{}
+	if leader != nil {
+		l := leader.Client.Idle("playlist", "player")
+		defer l.Close()
+		events, lost = l.Ch, leader.Client.Lost()
+	}
+	g.mirror()
+	g.sync()
+	for {
+		select {
+		case subsystem := <-events:
+			if subsystem == "playlist" {
+				g.mirror()
+			} else {
+				g.sync()
+			}
+		case <-ticker.C:
+			g.sync()
+		case <-g.changed:
+			return true
+		case <-lost:
+			events, lost = nil, nil
+		case <-done:
+			return false
+		}
+	}
+}
+
+func (g *Group) mirror() {
+	if !g.MirrorQueue {
+		return
+	}
+	if err := g.Mirror(); err != nil {
+		g.Logger.Error("mirroring the queue", "error", err)
+	}
+}
+
+func (g *Group) sync() {
+	if !g.Follow {
+		return
+	}
+	if err := g.Sync(); err != nil {
+		g.Logger.Error("syncing playback", "error", err)
+	}
+}
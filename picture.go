@@ -0,0 +1,91 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// AlbumArt returns the cover file of the directory of the song uri,
+// like cover.jpg. The data comes in chunks of the binary limit.
+func (c *MPDClient) AlbumArt(uri string) ([]byte, error) {
+	if err := c.require(FeatureAlbumArt); err != nil {
+		return nil, err
+	}
+	data, _, err := c.readBinary("albumart", uri)
+	return data, err
+}
+
+// ReadPicture returns the picture embedded in the song uri and its
+// MIME type, if MPD knows it. The data is nil if there is no picture.
+func (c *MPDClient) ReadPicture(uri string) ([]byte, string, error) {
+	if err := c.require(FeatureReadPicture); err != nil {
+		return nil, "", err
+	}
+	return c.readBinary("readpicture", uri)
+}
+
+// readBinary reads the binary data of uri from offset 0 to
+// the size MPD announces, one chunk per command.
+func (c *MPDClient) readBinary(cmd, uri string) ([]byte, string, error) {
+	var data []byte
+	var mimeType string
+	for {
+		res := c.Cmd(fmt.Sprintf("%s %s %d", cmd, quoteArg(uri), len(data)))
+		if res.Err != nil {
+			return nil, "", res.Err
+		}
+		if res.MPDErr != nil {
+			return nil, "", res.MPDErr
+		}
+		info := make(Info)
+		for _, line := range res.Data {
+			key, value, err := splitLine(line)
+			if err != nil {
+				return nil, "", err
+			}
+			info[key] = value
+		}
+		sizeValue, ok := info["size"]
+		if !ok {
+			// No picture
+			return nil, "", nil
+		}
+		size, err := strconv.Atoi(sizeValue)
+		if err != nil {
+			return nil, "", err
+		}
+		if t, ok := info["type"]; ok {
+			mimeType = t
+		}
+		if data == nil {
+			data = make([]byte, 0, size)
+		}
+		data = append(data, res.Binary...)
+		if len(data) >= size {
+			return data, mimeType, nil
+		}
+		if len(res.Binary) == 0 {
+			return nil, "", errors.New(fmt.Sprintf("Invalid input: %s stopped at %d of %d bytes", cmd, len(data), size))
+		}
+	}
+}
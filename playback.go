@@ -0,0 +1,202 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	StatePlay  = "play"
+	StatePause = "pause"
+	StateStop  = "stop"
+)
+
+// PlayerState is the state of the player and its options.
+type PlayerState struct {
+	State string `json:"state"`
+	// Song and SongId are the position and the id of the current
+	// song in the queue, -1 when there is none.
+	Song      int           `json:"song"`
+	SongId    int           `json:"song_id"`
+	Elapsed   time.Duration `json:"elapsed"`
+	Random    bool          `json:"random"`
+	Repeat    bool          `json:"repeat"`
+	Single    PlaybackMode  `json:"single"`
+	Consume   PlaybackMode  `json:"consume"`
+	Crossfade time.Duration `json:"crossfade"`
+	// Volume is -1 when MPD has no mixer.
+	Volume     int    `json:"volume"`
+	ReplayGain string `json:"replay_gain"`
+}
+
+// PlayerState returns the state of the player, from
+// the status and the replay gain mode.
+func (c *MPDClient) PlayerState() (*PlayerState, error) {
+	status, err := c.Status()
+	if err != nil {
+		return nil, err
+	}
+	replayGain, err := c.ReplayGainMode()
+	if err != nil {
+		return nil, err
+	}
+	info := *status
+	s := &PlayerState{
+		State:      info["state"],
+		Song:       -1,
+		SongId:     -1,
+		Random:     info["random"] == "1",
+		Repeat:     info["repeat"] == "1",
+		Single:     PlaybackMode(info["single"]),
+		Consume:    PlaybackMode(info["consume"]),
+		Volume:     -1,
+		ReplayGain: replayGain,
+	}
+	for key, field := range map[string]*int{"song": &s.Song, "songid": &s.SongId, "volume": &s.Volume} {
+		if value, ok := info[key]; ok {
+			if *field, err = strconv.Atoi(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for key, field := range map[string]*time.Duration{"elapsed": &s.Elapsed, "xfade": &s.Crossfade} {
+		if value, ok := info[key]; ok {
+			if *field, err = parseSeconds(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// ReplayGainMode returns the replay gain mode: off, track, album or auto.
+func (c *MPDClient) ReplayGainMode() (string, error) {
+	values, err := c.listValues("replay_gain_status", "replay_gain_mode")
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+	return values[0], nil
+}
+
+func (c *MPDClient) SetReplayGainMode(mode string) error {
+	return c.simpleCmd(fmt.Sprintf("replay_gain_mode %s", quoteArg(mode)))
+}
+
+// Play starts playing the song at position pos of the queue,
+// or the current song if pos is negative.
+func (c *MPDClient) Play(pos int) error {
+	if pos < 0 {
+		return c.simpleCmd("play")
+	}
+	return c.simpleCmd(fmt.Sprintf("play %d", pos))
+}
+
+func (c *MPDClient) PlayId(id int) error {
+	return c.simpleCmd(fmt.Sprintf("playid %d", id))
+}
+
+func (c *MPDClient) Pause(pause bool) error {
+	return c.simpleCmd(fmt.Sprintf("pause %s", boolArg(pause)))
+}
+
+func (c *MPDClient) Stop() error {
+	return c.simpleCmd("stop")
+}
+
+func (c *MPDClient) Next() error {
+	return c.simpleCmd("next")
+}
+
+func (c *MPDClient) Previous() error {
+	return c.simpleCmd("previous")
+}
+
+// Seek seeks to the position t of the song at position pos
+// of the queue.
+func (c *MPDClient) Seek(pos int, t time.Duration) error {
+	return c.simpleCmd(fmt.Sprintf("seek %d %s", pos, secondsArg(t)))
+}
+
+// SeekId seeks to the position t of the song id of the queue.
+func (c *MPDClient) SeekId(id int, t time.Duration) error {
+	return c.simpleCmd(fmt.Sprintf("seekid %d %s", id, secondsArg(t)))
+}
+
+func (c *MPDClient) SetRandom(random bool) error {
+	return c.simpleCmd(fmt.Sprintf("random %s", boolArg(random)))
+}
+
+func (c *MPDClient) SetRepeat(repeat bool) error {
+	return c.simpleCmd(fmt.Sprintf("repeat %s", boolArg(repeat)))
+}
+
+func (c *MPDClient) SetCrossfade(d time.Duration) error {
+	return c.simpleCmd(fmt.Sprintf("crossfade %d", int(d/time.Second)))
+}
+
+func (c *MPDClient) SetVolume(volume int) error {
+	return c.simpleCmd(fmt.Sprintf("setvol %d", volume))
+}
+
+func boolArg(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// secondsArg formats d as fractional seconds.
+func secondsArg(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// PlaybackMode is the state of the single and consume options.
+type PlaybackMode string
+
+const (
+	ModeOff PlaybackMode = "0"
+	ModeOn  PlaybackMode = "1"
+	// ModeOneshot turns the option off after the current song.
+	ModeOneshot PlaybackMode = "oneshot"
+)
+
+func (c *MPDClient) SetSingle(mode PlaybackMode) error {
+	if mode == ModeOneshot {
+		if err := c.require(FeatureSingleOneshot); err != nil {
+			return err
+		}
+	}
+	return c.simpleCmd(fmt.Sprintf("single %s", quoteArg(string(mode))))
+}
+
+func (c *MPDClient) SetConsume(mode PlaybackMode) error {
+	if mode == ModeOneshot {
+		if err := c.require(FeatureConsumeOneshot); err != nil {
+			return err
+		}
+	}
+	return c.simpleCmd(fmt.Sprintf("consume %s", quoteArg(string(mode))))
+}
@@ -0,0 +1,139 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package playcount
+
+import (
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+type Kind int
+
+const (
+	// Started is sent when a song starts playing.
+	Started Kind = iota
+	// Played is sent when a song listened long enough ends.
+	Played
+	// Skipped is sent when a song ends before that.
+	Skipped
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Started:
+		return "started"
+	case Played:
+		return "played"
+	case Skipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Kind Kind
+	Song mpdclient.Song
+	// Start is when the song started playing.
+	Start time.Time
+	// Listened is the time the song was actually played,
+	// not counting pauses.
+	Listened time.Duration
+}
+
+// restartTolerance is how close to the start a song must go back to
+// be counted as played again, as when repeating a single song.
+// The song went back if it was listened for longer than its elapsed
+// time: the player may send no state between the two plays.
+const restartTolerance = 2 * time.Second
+
+// Detector decides from successive player states whether
+// songs are played or skipped. A song counts as played once
+// listened for MinPlayed or for MinFraction of its duration,
+// whichever comes first.
+type Detector struct {
+	MinFraction float64
+	MinPlayed   time.Duration
+
+	song         *mpdclient.Song
+	songId       int
+	start        time.Time
+	listened     time.Duration
+	playingSince time.Time
+}
+
+// NewDetector returns a detector with the rules of Last.fm:
+// half of the song or 4 minutes.
+func NewDetector() *Detector {
+	return &Detector{MinFraction: 0.5, MinPlayed: 4 * time.Minute}
+}
+
+// Update takes the state of the player and its current song at
+// time now, and returns the events it leads to.
+func (d *Detector) Update(state *mpdclient.PlayerState, song *mpdclient.Song, now time.Time) []Event {
+	var events []Event
+	if !d.playingSince.IsZero() {
+		d.listened += now.Sub(d.playingSince)
+		d.playingSince = time.Time{}
+	}
+
+	same := d.song != nil && song != nil && state.State != mpdclient.StateStop &&
+		state.SongId == d.songId && song.File == d.song.File
+	if same && state.Elapsed < restartTolerance && state.Elapsed+restartTolerance < d.listened &&
+		d.listened >= d.threshold() {
+		same = false
+	}
+	if !same {
+		if d.song != nil {
+			events = append(events, d.finish())
+		}
+		if song != nil && state.State != mpdclient.StateStop {
+			d.song = song
+			d.songId = state.SongId
+			d.start = now
+			d.listened = 0
+			events = append(events, Event{Kind: Started, Song: *song, Start: now})
+		}
+	}
+	if d.song != nil && state.State == mpdclient.StatePlay {
+		d.playingSince = now
+	}
+	return events
+}
+
+func (d *Detector) threshold() time.Duration {
+	threshold := d.MinPlayed
+	if d.song.Duration > 0 {
+		if t := time.Duration(d.MinFraction * float64(d.song.Duration)); t < threshold {
+			threshold = t
+		}
+	}
+	return threshold
+}
+
+func (d *Detector) finish() Event {
+	e := Event{Kind: Skipped, Song: *d.song, Start: d.start, Listened: d.listened}
+	if d.listened >= d.threshold() {
+		e.Kind = Played
+	}
+	d.song = nil
+	d.listened = 0
+	return e
+}
@@ -0,0 +1,95 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package playcount
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+type step struct {
+	at      time.Duration
+	state   string
+	songId  int
+	elapsed time.Duration
+	kinds   []Kind
+}
+
+func runSteps(t *testing.T, steps []step) {
+	songs := map[int]*mpdclient.Song{
+		1: {File: "a.ogg", Duration: 3 * time.Minute},
+		2: {File: "b.ogg", Duration: 10 * time.Minute},
+	}
+	d := NewDetector()
+	origin := time.Now()
+	for i, s := range steps {
+		state := &mpdclient.PlayerState{State: s.state, SongId: s.songId, Elapsed: s.elapsed}
+		events := d.Update(state, songs[s.songId], origin.Add(s.at))
+		if len(events) != len(s.kinds) {
+			t.Fatalf("Step %d: expected %v, got %v", i, s.kinds, events)
+		}
+		for j, e := range events {
+			if e.Kind != s.kinds[j] {
+				t.Fatalf("Step %d: expected %v, got %v", i, s.kinds[j], e.Kind)
+			}
+		}
+	}
+}
+
+func TestDetectorPlayed(t *testing.T) {
+	runSteps(t, []step{
+		{0, mpdclient.StatePlay, 1, 0, []Kind{Started}},
+		{100 * time.Second, mpdclient.StatePlay, 2, 0, []Kind{Played, Started}},
+		// 4 minutes of a 10 minutes song are enough
+		{340 * time.Second, mpdclient.StateStop, 0, 0, []Kind{Played}},
+	})
+}
+
+func TestDetectorSkipped(t *testing.T) {
+	runSteps(t, []step{
+		{0, mpdclient.StatePlay, 1, 0, []Kind{Started}},
+		{30 * time.Second, mpdclient.StatePause, 1, 30 * time.Second, nil},
+		// Pauses don't count
+		{10 * time.Minute, mpdclient.StatePlay, 1, 30 * time.Second, nil},
+		{10*time.Minute + 30*time.Second, mpdclient.StatePlay, 2, 0, []Kind{Skipped, Started}},
+	})
+}
+
+func TestDetectorRepeat(t *testing.T) {
+	runSteps(t, []step{
+		{0, mpdclient.StatePlay, 1, 0, []Kind{Started}},
+		{170 * time.Second, mpdclient.StatePlay, 1, 170 * time.Second, nil},
+		{180 * time.Second, mpdclient.StatePlay, 1, 0, []Kind{Played, Started}},
+		// Seeking back early isn't a repeat
+		{190 * time.Second, mpdclient.StatePlay, 1, 0, nil},
+	})
+}
+
+func TestDetectorRepeatWithoutEvents(t *testing.T) {
+	// With repeat single, MPD sends no player event
+	// between two plays of the song
+	runSteps(t, []step{
+		{0, mpdclient.StatePlay, 1, 0, []Kind{Started}},
+		{181 * time.Second, mpdclient.StatePlay, 1, time.Second, []Kind{Played, Started}},
+		{190 * time.Second, mpdclient.StatePlay, 1, 0, nil},
+	})
+}
@@ -0,0 +1,180 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package playcount counts the songs played and skipped on MPD,
+// and stores the counts in stickers.
+package playcount
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// Stickers of the songs set by the tracker. lastplayed
+// is a Unix time.
+const (
+	StickerPlayCount  = "playcount"
+	StickerSkipCount  = "skipcount"
+	StickerLastPlayed = "lastplayed"
+)
+
+// Tracker records the songs played and skipped in stickers,
+// each time a "player" idle event occurs.
+type Tracker struct {
+	Detector *Detector
+	// OnEvent, if set, is called with each event once recorded.
+	OnEvent func(Event)
+
+	c    *mpdclient.MPDClient
+	done chan struct{}
+}
+
+func NewTracker(c *mpdclient.MPDClient) *Tracker {
+	return &Tracker{
+		Detector: NewDetector(),
+		c:        c,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts tracking, from the song currently playing.
+func (t *Tracker) Start() error {
+	events := t.c.Idle("player")
+	if err := t.update(); err != nil {
+		events.Close()
+		return err
+	}
+	go func() {
+		defer events.Close()
+		for {
+			select {
+			case <-t.done:
+				return
+			case _, ok := <-events.Ch:
+				if !ok {
+					return
+				}
+			}
+			if err := t.update(); err != nil {
+				t.c.Logger.Warn("play count update failed", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *Tracker) Close() {
+	close(t.done)
+}
+
+func (t *Tracker) update() error {
+	state, err := t.c.PlayerState()
+	if err != nil {
+		return err
+	}
+	song, err := t.c.Playing()
+	if err != nil {
+		return err
+	}
+	for _, e := range t.Detector.Update(state, song, time.Now()) {
+		if err := t.record(e); err != nil {
+			return err
+		}
+		if t.OnEvent != nil {
+			t.OnEvent(e)
+		}
+	}
+	return nil
+}
+
+// record updates the stickers of the song of e. Remote songs have
+// no stickers.
+func (t *Tracker) record(e Event) error {
+	uri := e.Song.File
+	if e.Kind == Started || strings.Contains(uri, "://") {
+		return nil
+	}
+	counter := StickerSkipCount
+	if e.Kind == Played {
+		counter = StickerPlayCount
+	}
+	l := t.c.BeginCommandList()
+	if err := l.StickerInc(mpdclient.StickerSongType, uri, counter, 1); err != nil {
+		return err
+	}
+	if e.Kind == Played {
+		l.Cmd(stickerCmd("set", uri, StickerLastPlayed, strconv.FormatInt(e.Start.Unix(), 10)))
+	}
+	res := l.End()
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.MPDErr != nil {
+		return res.MPDErr
+	}
+	return nil
+}
+
+func stickerCmd(action, uri, name, value string) string {
+	cmd := mpdclient.Command{
+		Name: "sticker",
+		Args: []string{action, mpdclient.StickerSongType, uri, name, value},
+	}
+	return cmd.String()
+}
+
+// Top returns the n songs with the highest numeric value of
+// a sticker, like StickerPlayCount, highest first.
+// Songs whose value isn't a number are left out.
+func Top(c *mpdclient.MPDClient, sticker string, n int) (mpdclient.SongStickerList, error) {
+	stickers, err := c.StickerFind(mpdclient.StickerSongType, "", sticker)
+	if err != nil {
+		return nil, err
+	}
+	type ranked struct {
+		sticker mpdclient.SongSticker
+		value   float64
+	}
+	songs := make([]ranked, 0, len(stickers))
+	for _, s := range stickers {
+		value, err := strconv.ParseFloat(s.Value, 64)
+		if err != nil {
+			continue
+		}
+		songs = append(songs, ranked{s, value})
+	}
+	sort.SliceStable(songs, func(i, j int) bool {
+		if songs[i].value != songs[j].value {
+			return songs[i].value > songs[j].value
+		}
+		return songs[i].sticker.Uri < songs[j].sticker.Uri
+	})
+	if n >= 0 && len(songs) > n {
+		songs = songs[:n]
+	}
+	top := make(mpdclient.SongStickerList, len(songs))
+	for i, s := range songs {
+		top[i] = s.sticker
+	}
+	return top, nil
+}
@@ -0,0 +1,117 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package playlistfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const extInf = "#EXTINF:"
+
+// parseM3U reads M3U and extended M3U files. Lines of M3U files
+// which aren't valid UTF-8 are decoded as Latin-1.
+func parseM3U(r io.Reader, latin1 bool) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	var info *Entry
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		if latin1 && !utf8.ValidString(line) {
+			line = decodeLatin1(line)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, extInf):
+			info = parseExtInf(line[len(extInf):])
+		case strings.HasPrefix(line, "#"):
+		default:
+			var e Entry
+			if info != nil {
+				e = *info
+				info = nil
+			}
+			e.Location = line
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// parseExtInf parses "duration,title" from an #EXTINF line,
+// splitting "Artist - Title" titles.
+func parseExtInf(s string) *Entry {
+	e := &Entry{}
+	duration, title := s, ""
+	if i := strings.Index(s, ","); i != -1 {
+		duration, title = s[:i], s[i+1:]
+	}
+	// Attributes may follow the duration, as in #EXTINF:-1 tvg-id="x",Title
+	if i := strings.IndexAny(duration, " \t"); i != -1 {
+		duration = duration[:i]
+	}
+	if secs, err := strconv.ParseFloat(duration, 64); err == nil && secs > 0 {
+		e.Duration = time.Duration(secs * float64(time.Second))
+	}
+	if i := strings.Index(title, " - "); i != -1 {
+		e.Creator, e.Title = title[:i], title[i+3:]
+	} else {
+		e.Title = title
+	}
+	return e
+}
+
+func decodeLatin1(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+func writeM3U(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	for _, e := range entries {
+		if title := displayTitle(e); title != "" || e.Duration > 0 {
+			secs := -1
+			if e.Duration > 0 {
+				secs = int(e.Duration.Round(time.Second) / time.Second)
+			}
+			fmt.Fprintf(bw, "%s%d,%s\n", extInf, secs, title)
+		}
+		fmt.Fprintln(bw, e.Location)
+	}
+	return bw.Flush()
+}
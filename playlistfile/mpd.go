@@ -0,0 +1,223 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package playlistfile
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// commandListSize is the number of songs added per command list,
+// well under the default max_command_list_size of MPD.
+const commandListSize = 512
+
+// Importer writes playlist files into MPD stored playlists.
+type Importer struct {
+	Client *mpdclient.MPDClient
+	// MusicDirectory is the music_directory of MPD, to resolve
+	// absolute paths. When empty, it is asked to MPD, which only
+	// answers to clients connected on a local socket.
+	MusicDirectory string
+	// Base is the directory relative paths are resolved against,
+	// either absolute or relative to the music directory.
+	// The default is the music directory.
+	Base string
+	// Replace clears the stored playlist before adding the entries.
+	Replace bool
+}
+
+// Unresolved is an entry which couldn't be added to the playlist.
+type Unresolved struct {
+	Entry  Entry
+	Reason string
+}
+
+type ImportResult struct {
+	// Added are the URIs added to the stored playlist.
+	Added      []string
+	Unresolved []Unresolved
+}
+
+// ImportFile imports a playlist file into the stored playlist name.
+// The format is guessed from the file extension, and relative paths
+// are resolved against the directory of the file unless Base is set.
+func (im *Importer) ImportFile(name, filename string) (*ImportResult, error) {
+	format, err := FormatOf(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := Parse(f, format)
+	if err != nil {
+		return nil, err
+	}
+	if im.Base == "" {
+		dir, err := filepath.Abs(filepath.Dir(filename))
+		if err != nil {
+			return nil, err
+		}
+		fileIm := *im
+		fileIm.Base = filepath.ToSlash(dir)
+		im = &fileIm
+	}
+	return im.Import(name, entries)
+}
+
+// Import adds entries to the stored playlist name. Entries that don't
+// resolve to a URI of the database, or that MPD refuses, are reported
+// in the result, and the others are added nonetheless.
+func (im *Importer) Import(name string, entries []Entry) (*ImportResult, error) {
+	result := &ImportResult{Added: make([]string, 0)}
+	musicDir := im.MusicDirectory
+	if musicDir == "" {
+		if config, err := im.Client.Config(); err == nil {
+			musicDir = config.MusicDirectory
+		}
+	}
+
+	var pending []Entry
+	var uris []string
+	for _, e := range entries {
+		uri, reason := resolve(e.Location, im.Base, musicDir)
+		if reason != "" {
+			result.Unresolved = append(result.Unresolved, Unresolved{e, reason})
+			continue
+		}
+		pending = append(pending, e)
+		uris = append(uris, uri)
+	}
+
+	if im.Replace {
+		if err := im.Client.PlaylistClear(name); err != nil {
+			if mpdErr, ok := err.(*mpdclient.MPDError); !ok || mpdErr.Ack != mpdclient.AckNoExist {
+				return result, err
+			}
+		}
+	}
+
+	for len(uris) > 0 {
+		n := len(uris)
+		if n > commandListSize {
+			n = commandListSize
+		}
+		l := im.Client.BeginCommandList()
+		for _, uri := range uris[:n] {
+			cmd := mpdclient.Command{Name: "playlistadd", Args: []string{name, uri}}
+			l.Cmd(cmd.String())
+		}
+		res := l.End()
+		if res.Err != nil {
+			return result, res.Err
+		}
+		if res.MPDErr == nil {
+			result.Added = append(result.Added, uris[:n]...)
+			uris, pending = uris[n:], pending[n:]
+			continue
+		}
+		// MPD stopped at the failing command: report its entry and
+		// carry on with the next ones.
+		failed := int(res.MPDErr.CommandListNum)
+		if failed >= n || (res.MPDErr.Ack != mpdclient.AckNoExist && res.MPDErr.Ack != mpdclient.AckArg) {
+			return result, res.MPDErr
+		}
+		result.Added = append(result.Added, uris[:failed]...)
+		result.Unresolved = append(result.Unresolved, Unresolved{pending[failed], res.MPDErr.MessageText})
+		uris, pending = uris[failed+1:], pending[failed+1:]
+	}
+	return result, nil
+}
+
+// resolve returns the URI MPD knows location by, or why there is none.
+func resolve(location, base, musicDir string) (string, string) {
+	location = strings.ReplaceAll(location, "\\", "/")
+	if hasScheme(location) {
+		if !strings.HasPrefix(location, "file://") {
+			return location, ""
+		}
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", err.Error()
+		}
+		location = u.Path
+	}
+	if !path.IsAbs(location) {
+		location = path.Join(base, location)
+	}
+	if path.IsAbs(location) {
+		if musicDir == "" {
+			return "", "absolute path and unknown music directory"
+		}
+		dir := strings.TrimSuffix(filepath.ToSlash(musicDir), "/") + "/"
+		if !strings.HasPrefix(location, dir) {
+			return "", "outside of the music directory"
+		}
+		return strings.TrimPrefix(location, dir), ""
+	}
+	if location == ".." || strings.HasPrefix(location, "../") {
+		return "", "outside of the music directory"
+	}
+	return location, ""
+}
+
+// Exporter writes MPD stored playlists as playlist files.
+type Exporter struct {
+	Client *mpdclient.MPDClient
+	// Prefix is prepended to the paths of the songs of the database,
+	// for the players which don't see them relative to the file.
+	Prefix string
+}
+
+// Export writes the stored playlist name to w, with the
+// durations and titles of the songs found in the database.
+func (ex *Exporter) Export(name string, format Format, w io.Writer) error {
+	songs, err := ex.Client.ListPlaylistInfo(name)
+	if err != nil {
+		return err
+	}
+	entries := make([]Entry, len(songs))
+	for i, song := range songs {
+		location := song.File
+		if ex.Prefix != "" && !hasScheme(location) {
+			location = path.Join(ex.Prefix, location)
+		}
+		title := song.Title
+		if title == "" {
+			title = song.Name
+		}
+		entries[i] = Entry{
+			Location: location,
+			Title:    title,
+			Creator:  song.Artist,
+			Album:    song.Album,
+			Duration: song.Duration,
+		}
+	}
+	return Write(w, format, entries)
+}
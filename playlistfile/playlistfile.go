@@ -0,0 +1,118 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package playlistfile reads and writes M3U, M3U8, PLS and XSPF
+// playlist files, and imports them into MPD stored playlists
+// or exports stored playlists to them.
+package playlistfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Entry is a song of a playlist file.
+type Entry struct {
+	// Location is the path or the URL of the song, as in the file.
+	// File URLs of XSPF playlists are converted to paths.
+	Location string
+	Title    string
+	Creator  string
+	Album    string
+	// Duration is zero when unknown.
+	Duration time.Duration
+}
+
+type Format int
+
+const (
+	M3U Format = iota
+	M3U8
+	PLS
+	XSPF
+)
+
+var formatNames = []string{"m3u", "m3u8", "pls", "xspf"}
+
+func (f Format) String() string {
+	if int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat returns the format named s, like "m3u" or "xspf".
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(s)
+	for i, name := range formatNames {
+		if s == name {
+			return Format(i), nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("Unknown playlist format: %s", s))
+}
+
+// FormatOf returns the format of a file from its extension.
+func FormatOf(filename string) (Format, error) {
+	return ParseFormat(strings.TrimPrefix(path.Ext(filename), "."))
+}
+
+// Parse reads the entries of a playlist file.
+func Parse(r io.Reader, f Format) ([]Entry, error) {
+	switch f {
+	case M3U, M3U8:
+		return parseM3U(r, f == M3U)
+	case PLS:
+		return parsePLS(r)
+	case XSPF:
+		return parseXSPF(r)
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown playlist format: %s", f))
+}
+
+// Write writes entries as a playlist file. M3U files are written
+// in UTF-8, like M3U8 ones.
+func Write(w io.Writer, f Format, entries []Entry) error {
+	switch f {
+	case M3U, M3U8:
+		return writeM3U(w, entries)
+	case PLS:
+		return writePLS(w, entries)
+	case XSPF:
+		return writeXSPF(w, entries)
+	}
+	return errors.New(fmt.Sprintf("Unknown playlist format: %s", f))
+}
+
+// displayTitle returns the title of e as players show it.
+func displayTitle(e Entry) string {
+	if e.Creator != "" && e.Title != "" {
+		return e.Creator + " - " + e.Title
+	}
+	return e.Title
+}
+
+func hasScheme(location string) bool {
+	i := strings.Index(location, "://")
+	return i > 0 && !strings.ContainsAny(location[:i], "/\\")
+}
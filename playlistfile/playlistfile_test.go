@@ -0,0 +1,115 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package playlistfile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEntries = []Entry{
+	{Location: "Air/Moon Safari/01 La femme d'argent.flac", Title: "La femme d'argent", Creator: "Air", Album: "Moon Safari", Duration: 429 * time.Second},
+	{Location: "http://radio.example.com/stream", Title: "Radio"},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, f := range []Format{M3U, M3U8, PLS, XSPF} {
+		var buf bytes.Buffer
+		if err := Write(&buf, f, testEntries); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := Parse(&buf, f)
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+		if len(entries) != len(testEntries) {
+			t.Fatalf("%s: expected %d entries, got %d", f, len(testEntries), len(entries))
+		}
+		for i, e := range entries {
+			expected := testEntries[i]
+			if f == PLS {
+				// PLS has no separate artist
+				expected.Title = displayTitle(expected)
+				expected.Creator = ""
+			}
+			if f != XSPF {
+				expected.Album = ""
+			}
+			if e != expected {
+				t.Fatalf("%s: expected %+v, got %+v", f, expected, e)
+			}
+		}
+	}
+}
+
+func TestParseM3U(t *testing.T) {
+	input := "\ufeff#EXTM3U\n\n#EXTINF:-1 tvg-id=\"x\",Some Radio\nhttp://example.com/radio\n\n#comment\ncaf\xe9.mp3\n"
+	entries, err := Parse(strings.NewReader(input), M3U)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected %d entries, got %v", 2, entries)
+	}
+	if entries[0].Title != "Some Radio" || entries[0].Duration != 0 {
+		t.Fatalf("Unexpected entry %+v", entries[0])
+	}
+	if entries[1].Location != "café.mp3" || entries[1].Title != "" {
+		t.Fatalf("Unexpected entry %+v", entries[1])
+	}
+}
+
+func TestParsePLS(t *testing.T) {
+	input := "[playlist]\nfile2=b.ogg\nFile1=a.ogg\nTitle1=A\nLength1=-1\nNumberOfEntries=2\n"
+	entries, err := Parse(strings.NewReader(input), PLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Location != "a.ogg" || entries[0].Title != "A" || entries[1].Location != "b.ogg" {
+		t.Fatalf("Unexpected entries %+v", entries)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		location, base, musicDir string
+		uri                      string
+		resolved                 bool
+	}{
+		{"a/b.ogg", "", "", "a/b.ogg", true},
+		{"b.ogg", "a", "", "a/b.ogg", true},
+		{"../../b.ogg", "a", "", "", false},
+		{"/music/a/b.ogg", "", "/music", "a/b.ogg", true},
+		{"file:///music/a%20b.ogg", "", "/music/", "a b.ogg", true},
+		{"/elsewhere/b.ogg", "", "/music", "", false},
+		{"b.ogg", "/music/a", "/music", "a/b.ogg", true},
+		{"b.ogg", "/music/a", "", "", false},
+		{"a\\b.ogg", "", "", "a/b.ogg", true},
+		{"https://example.com/b.ogg", "a", "", "https://example.com/b.ogg", true},
+	}
+	for _, test := range tests {
+		uri, reason := resolve(test.location, test.base, test.musicDir)
+		if (reason == "") != test.resolved || uri != test.uri {
+			t.Fatalf("%s in %q: expected %q, got %q (%s)", test.location, test.base, test.uri, uri, reason)
+		}
+	}
+}
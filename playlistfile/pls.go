@@ -0,0 +1,111 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package playlistfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func parsePLS(r io.Reader) ([]Entry, error) {
+	byNum := make(map[int]*Entry)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "[") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i == -1 {
+			return nil, errors.New(fmt.Sprintf("Invalid input: %s", line))
+		}
+		key, value := strings.ToLower(line[:i]), line[i+1:]
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+		e, ok := byNum[n]
+		if !ok {
+			e = &Entry{}
+			byNum[n] = e
+		}
+		switch field {
+		case "file":
+			e.Location = value
+		case "title":
+			e.Title = value
+		case "length":
+			if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+				e.Duration = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	nums := make([]int, 0, len(byNum))
+	for n, e := range byNum {
+		if e.Location != "" {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	entries := make([]Entry, len(nums))
+	for i, n := range nums {
+		entries[i] = *byNum[n]
+	}
+	return entries, nil
+}
+
+func writePLS(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "[playlist]")
+	for i, e := range entries {
+		n := i + 1
+		fmt.Fprintf(bw, "File%d=%s\n", n, e.Location)
+		if title := displayTitle(e); title != "" {
+			fmt.Fprintf(bw, "Title%d=%s\n", n, title)
+		}
+		secs := -1
+		if e.Duration > 0 {
+			secs = int(e.Duration.Round(time.Second) / time.Second)
+		}
+		fmt.Fprintf(bw, "Length%d=%d\n", n, secs)
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\n", len(entries))
+	fmt.Fprintln(bw, "Version=2")
+	return bw.Flush()
+}
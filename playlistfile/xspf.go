@@ -0,0 +1,118 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package playlistfile
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Version string      `xml:"version,attr"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location []string `xml:"location"`
+	Title    string   `xml:"title,omitempty"`
+	Creator  string   `xml:"creator,omitempty"`
+	Album    string   `xml:"album,omitempty"`
+	// Duration is in milliseconds.
+	Duration int64 `xml:"duration,omitempty"`
+}
+
+func parseXSPF(r io.Reader) ([]Entry, error) {
+	var p xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&p); err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(p.Tracks))
+	for _, t := range p.Tracks {
+		if len(t.Location) == 0 {
+			continue
+		}
+		entries = append(entries, Entry{
+			Location: xspfPath(strings.TrimSpace(t.Location[0])),
+			Title:    t.Title,
+			Creator:  t.Creator,
+			Album:    t.Album,
+			Duration: time.Duration(t.Duration) * time.Millisecond,
+		})
+	}
+	return entries, nil
+}
+
+// xspfPath converts file URLs and relative URLs to paths.
+// Other URLs are returned as is.
+func xspfPath(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	switch u.Scheme {
+	case "file":
+		return u.Path
+	case "":
+		return u.Path
+	}
+	return location
+}
+
+// xspfLocation is the reverse of xspfPath.
+func xspfLocation(location string) string {
+	if hasScheme(location) {
+		return location
+	}
+	u := url.URL{Path: location}
+	if strings.HasPrefix(location, "/") {
+		u.Scheme = "file"
+	}
+	return u.String()
+}
+
+func writeXSPF(w io.Writer, entries []Entry) error {
+	p := xspfPlaylist{Xmlns: xspfNamespace, Version: "1", Tracks: make([]xspfTrack, len(entries))}
+	for i, e := range entries {
+		p.Tracks[i] = xspfTrack{
+			Location: []string{xspfLocation(e.Location)},
+			Title:    e.Title,
+			Creator:  e.Creator,
+			Album:    e.Album,
+			Duration: int64(e.Duration / time.Millisecond),
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,370 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PresenceChannelPrefix is prepended to the name of a client
+// to get the channel it stays subscribed to while it is alive.
+//
+// MPD drops the subscriptions of a client when its connection
+// goes away, so the channels starting with this prefix are
+// the named clients currently connected to the server.
+const PresenceChannelPrefix = "presence."
+
+// ChannelsDiff is the difference between two snapshots
+// of the channels of the MPD server.
+type ChannelsDiff struct {
+	Appeared    []string
+	Disappeared []string
+}
+
+func (d ChannelsDiff) Empty() bool {
+	return len(d.Appeared) == 0 && len(d.Disappeared) == 0
+}
+
+// ChannelWatcher reports the channels appearing and disappearing
+// on the MPD server, each time a "subscription" idle event occurs.
+type ChannelWatcher struct {
+	Ch chan ChannelsDiff
+	idleWatcher
+	prefix string
+
+	mu    sync.Mutex
+	known map[string]bool
+}
+
+// WatchChannels starts watching the channels of the MPD server.
+func (c *MPDClient) WatchChannels() (*ChannelWatcher, error) {
+	return c.watchChannels("")
+}
+
+// WatchPresence starts watching the named clients announced
+// with Announce. Names are reported without PresenceChannelPrefix.
+func (c *MPDClient) WatchPresence() (*ChannelWatcher, error) {
+	return c.watchChannels(PresenceChannelPrefix)
+}
+
+func (c *MPDClient) watchChannels(prefix string) (*ChannelWatcher, error) {
+	w := &ChannelWatcher{
+		Ch:     make(chan ChannelsDiff),
+		prefix: prefix,
+		known:  make(map[string]bool),
+	}
+	w.init(c, "subscription")
+	if _, err := w.update(); err != nil {
+		w.Close()
+		return nil, err
+	}
+	go w.loop("channel", w.refresh)
+	return w, nil
+}
+
+// Channels returns the channels currently known by the watcher, sorted.
+func (w *ChannelWatcher) Channels() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	channels := make([]string, 0, len(w.known))
+	for channel := range w.known {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+func (w *ChannelWatcher) refresh() error {
+	diff, err := w.update()
+	if err != nil {
+		return err
+	}
+	if diff.Empty() {
+		return nil
+	}
+	select {
+	case w.Ch <- diff:
+	case <-w.done:
+	}
+	return nil
+}
+
+func (w *ChannelWatcher) update() (ChannelsDiff, error) {
+	channels, err := w.c.Channels()
+	if err != nil {
+		return ChannelsDiff{}, err
+	}
+	current := make(map[string]bool)
+	for _, channel := range channels {
+		if !strings.HasPrefix(channel, w.prefix) {
+			continue
+		}
+		current[channel[len(w.prefix):]] = true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	diff := diffChannels(w.known, current)
+	w.known = current
+	return diff, nil
+}
+
+func diffChannels(before, after map[string]bool) ChannelsDiff {
+	var diff ChannelsDiff
+	for channel := range after {
+		if !before[channel] {
+			diff.Appeared = append(diff.Appeared, channel)
+		}
+	}
+	for channel := range before {
+		if !after[channel] {
+			diff.Disappeared = append(diff.Disappeared, channel)
+		}
+	}
+	sort.Strings(diff.Appeared)
+	sort.Strings(diff.Disappeared)
+	return diff
+}
+
+// Announce makes the client visible as name to the clients
+// watching presence, until Withdraw is called or the client is closed.
+func (c *MPDClient) Announce(name string) error {
+	return c.Subscribe(PresenceChannelPrefix + name)
+}
+
+func (c *MPDClient) Withdraw(name string) error {
+	return c.Unsubscribe(PresenceChannelPrefix + name)
+}
+
+// Alive returns the names of the clients currently announced on the server.
+func (c *MPDClient) Alive() ([]string, error) {
+	channels, err := c.Channels()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, channel := range channels {
+		if strings.HasPrefix(channel, PresenceChannelPrefix) {
+			names = append(names, channel[len(PresenceChannelPrefix):])
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// HeartbeatChannel is the channel of the heartbeats sent with
+// Heartbeat. Unlike the presence channels, which stay as long as the
+// connection of a client, heartbeats stop when a client hangs.
+const HeartbeatChannel = "heartbeat"
+
+// heartbeatExpiry is the number of heartbeat intervals after which
+// a client which didn't send any is considered gone.
+const heartbeatExpiry = 3
+
+// Heartbeat sends heartbeats for a named client.
+type Heartbeat struct {
+	done chan struct{}
+	once sync.Once
+}
+
+// Heartbeat sends a heartbeat for name on HeartbeatChannel every
+// interval, until the returned Heartbeat is closed. The message is
+// the name followed by the interval, for the watchers to know when
+// it expires.
+func (c *MPDClient) Heartbeat(name string, interval time.Duration) *Heartbeat {
+	h := &Heartbeat{done: make(chan struct{})}
+	msg := name + " " + interval.String()
+	send := func() {
+		err := c.SendMessage(HeartbeatChannel, msg)
+		// Nobody is watching
+		if mpdErr, ok := err.(*MPDError); ok && mpdErr.Ack == AckNoExist {
+			return
+		}
+		if err != nil {
+			c.Logger.Warn("heartbeat failed", "error", err)
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		send()
+		for {
+			select {
+			case <-h.done:
+				return
+			case <-ticker.C:
+				send()
+			}
+		}
+	}()
+	return h
+}
+
+// Close stops sending heartbeats.
+func (h *Heartbeat) Close() {
+	h.once.Do(func() {
+		close(h.done)
+	})
+}
+
+// parseHeartbeat returns the name and the interval of a heartbeat message.
+func parseHeartbeat(msg string) (string, time.Duration, error) {
+	i := strings.LastIndex(msg, " ")
+	if i <= 0 {
+		return "", 0, errors.New(fmt.Sprintf("Invalid heartbeat: %s", msg))
+	}
+	interval, err := time.ParseDuration(msg[i+1:])
+	if err != nil {
+		return "", 0, err
+	}
+	return msg[:i], interval, nil
+}
+
+// HeartbeatWatcher reports the clients starting and stopping to
+// send heartbeats. A client is gone when it didn't send any for
+// three of its intervals.
+type HeartbeatWatcher struct {
+	Ch chan ChannelsDiff
+	idleWatcher
+
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	closeOnce sync.Once
+}
+
+// WatchHeartbeats subscribes to HeartbeatChannel and starts watching
+// the heartbeats, checking every interval for the expired ones.
+func (c *MPDClient) WatchHeartbeats(interval time.Duration) (*HeartbeatWatcher, error) {
+	w := &HeartbeatWatcher{
+		Ch:      make(chan ChannelsDiff),
+		expires: make(map[string]time.Time),
+	}
+	w.init(c, "message")
+	w.interval = interval
+	if err := c.watchHeartbeats(); err != nil {
+		w.idleWatcher.Close()
+		return nil, err
+	}
+	go w.loop("heartbeat", w.refresh)
+	return w, nil
+}
+
+// watchHeartbeats subscribes to HeartbeatChannel for the first
+// heartbeat watcher of c. A subscription made by someone else
+// is left to them.
+func (c *MPDClient) watchHeartbeats() error {
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	if c.heartbeatWatchers == 0 {
+		err := c.Subscribe(HeartbeatChannel)
+		if mpdErr, ok := err.(*MPDError); ok && mpdErr.Ack == AckExist {
+			err = nil
+		} else if err == nil {
+			c.heartbeatSubscribed = true
+		}
+		if err != nil {
+			return err
+		}
+	}
+	c.heartbeatWatchers++
+	return nil
+}
+
+// unwatchHeartbeats unsubscribes from HeartbeatChannel when the last
+// heartbeat watcher of c is closed, if they subscribed to it.
+func (c *MPDClient) unwatchHeartbeats() {
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	c.heartbeatWatchers--
+	if c.heartbeatWatchers == 0 && c.heartbeatSubscribed {
+		c.heartbeatSubscribed = false
+		c.Unsubscribe(HeartbeatChannel)
+	}
+}
+
+// Alive returns the names of the clients sending heartbeats, sorted.
+func (w *HeartbeatWatcher) Alive() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	names := make([]string, 0, len(w.expires))
+	for name := range w.expires {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close stops watching the heartbeats. The last watcher of
+// the client unsubscribes from them.
+func (w *HeartbeatWatcher) Close() {
+	w.closeOnce.Do(func() {
+		w.idleWatcher.Close()
+		w.c.unwatchHeartbeats()
+	})
+}
+
+func (w *HeartbeatWatcher) refresh() error {
+	msgs, err := w.c.ReadChannelMessages(HeartbeatChannel)
+	if err != nil {
+		return err
+	}
+	diff := w.update(msgs, time.Now())
+	if diff.Empty() {
+		return nil
+	}
+	select {
+	case w.Ch <- diff:
+	case <-w.done:
+	}
+	return nil
+}
+
+// update records the heartbeats of msgs and expires the clients
+// without heartbeats at now.
+func (w *HeartbeatWatcher) update(msgs []ChannelMessage, now time.Time) ChannelsDiff {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	before := make(map[string]bool, len(w.expires))
+	for name := range w.expires {
+		before[name] = true
+	}
+	for _, msg := range msgs {
+		name, interval, err := parseHeartbeat(msg.Message)
+		if err != nil {
+			w.c.Logger.Warn("invalid heartbeat", "error", err)
+			continue
+		}
+		w.expires[name] = now.Add(heartbeatExpiry * interval)
+	}
+	after := make(map[string]bool, len(w.expires))
+	for name, expires := range w.expires {
+		if now.After(expires) {
+			delete(w.expires, name)
+		} else {
+			after[name] = true
+		}
+	}
+	return diffChannels(before, after)
+}
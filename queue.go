@@ -0,0 +1,138 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Queue returns the songs of the queue, in order.
+func (c *MPDClient) Queue() ([]Song, error) {
+	res := c.Cmd("playlistinfo")
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	return parseSongs(res.Data)
+}
+
+// Add appends uri, a song or a directory, to the queue.
+func (c *MPDClient) Add(uri string) error {
+	return c.simpleCmd(fmt.Sprintf("add %s", quoteArg(uri)))
+}
+
+// AddId adds the song uri to the queue at position pos,
+// or at the end if pos is negative, and returns its id.
+func (c *MPDClient) AddId(uri string, pos int) (int, error) {
+	cmd := fmt.Sprintf("addid %s", quoteArg(uri))
+	if pos >= 0 {
+		cmd += fmt.Sprintf(" %d", pos)
+	}
+	res := c.Cmd(cmd)
+	if res.Err != nil {
+		return -1, res.Err
+	}
+	if res.MPDErr != nil {
+		return -1, res.MPDErr
+	}
+	ids, err := parseIds(res.Data)
+	if err != nil {
+		return -1, err
+	}
+	if len(ids) != 1 {
+		return -1, errors.New(fmt.Sprintf("Invalid input: %q", res.Data))
+	}
+	return ids[0], nil
+}
+
+// parseIds returns the ids of the responses of addid commands.
+func parseIds(data []string) ([]int, error) {
+	values, err := parseValues(data, "Id")
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(values))
+	for i, value := range values {
+		if ids[i], err = strconv.Atoi(value); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// Clear removes all the songs of the queue.
+func (c *MPDClient) Clear() error {
+	return c.simpleCmd("clear")
+}
+
+func (c *MPDClient) DeleteId(id int) error {
+	return c.simpleCmd(fmt.Sprintf("deleteid %d", id))
+}
+
+// PrioId sets the priority of songs of the queue, from 0 to 255.
+// In random mode, songs with higher priorities are played first.
+func (c *MPDClient) PrioId(prio int, ids ...int) error {
+	cmd := fmt.Sprintf("prioid %d", prio)
+	for _, id := range ids {
+		cmd += fmt.Sprintf(" %d", id)
+	}
+	return c.simpleCmd(cmd)
+}
+
+// Playing returns the current song of the queue,
+// or nil if there is none. Unlike CurrentSong, which keeps
+// the raw fields, it parses the song like Queue does.
+func (c *MPDClient) Playing() (*Song, error) {
+	res := c.Cmd("currentsong")
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	songs, err := parseSongs(res.Data)
+	if err != nil || len(songs) == 0 {
+		return nil, err
+	}
+	return &songs[0], nil
+}
+
+// QueueSong returns the song at position pos of the queue.
+func (c *MPDClient) QueueSong(pos int) (*Song, error) {
+	res := c.Cmd(fmt.Sprintf("playlistinfo %d", pos))
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	songs, err := parseSongs(res.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(songs) != 1 {
+		return nil, errors.New(fmt.Sprintf("Invalid input: %q", res.Data))
+	}
+	return &songs[0], nil
+}
@@ -0,0 +1,223 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type Stats struct {
+	Artists uint
+	Albums  uint
+	Songs   uint
+	// Uptime is the time since MPD started.
+	Uptime time.Duration
+	// Playtime is the time MPD has been playing since it started.
+	Playtime time.Duration
+	// DBPlaytime is the sum of the durations of all the songs in the database.
+	DBPlaytime time.Duration
+	// DBUpdate is the time of the last database update.
+	DBUpdate time.Time
+}
+
+// ServerConfig is the configuration MPD discloses
+// to the clients connected on a local socket.
+type ServerConfig struct {
+	MusicDirectory    string
+	PlaylistDirectory string
+	PCRE              bool
+}
+
+type Decoder struct {
+	Plugin    string
+	Suffixes  []string
+	MimeTypes []string
+}
+
+// parseValues returns the values of the lines of data with the given key.
+func parseValues(data []string, key string) ([]string, error) {
+	values := make([]string, 0)
+	for _, line := range data {
+		match := responseRegexp.FindStringSubmatch(line)
+		if match == nil {
+			return nil, errors.New(fmt.Sprintf("Invalid input: %s", line))
+		}
+		if match[1] == key {
+			values = append(values, match[2])
+		}
+	}
+	return values, nil
+}
+
+func (c *MPDClient) Stats() (*Stats, error) {
+	res := c.Cmd("stats")
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	info := make(Info)
+	if err := info.Fill(res.Data); err != nil {
+		return nil, err
+	}
+
+	var stats Stats
+	var err error
+	uints := map[string]*uint{
+		"artists": &stats.Artists,
+		"albums":  &stats.Albums,
+		"songs":   &stats.Songs,
+	}
+	for key, field := range uints {
+		if v, ok := info[key]; ok {
+			n, err := strconv.ParseUint(v, 10, 0)
+			if err != nil {
+				return nil, err
+			}
+			*field = uint(n)
+		}
+	}
+	durations := map[string]*time.Duration{
+		"uptime":      &stats.Uptime,
+		"playtime":    &stats.Playtime,
+		"db_playtime": &stats.DBPlaytime,
+	}
+	for key, field := range durations {
+		if v, ok := info[key]; ok {
+			if *field, err = parseSeconds(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if v, ok := info["db_update"]; ok {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		stats.DBUpdate = time.Unix(ts, 0)
+	}
+	return &stats, nil
+}
+
+// parseSeconds parses a number of seconds, with an optional fractional part.
+func parseSeconds(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// Config returns the configuration of MPD.
+// MPD only answers to clients connected on a local socket.
+func (c *MPDClient) Config() (*ServerConfig, error) {
+	res := c.Cmd("config")
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	info := make(Info)
+	if err := info.Fill(res.Data); err != nil {
+		return nil, err
+	}
+	return &ServerConfig{
+		MusicDirectory:    info["music_directory"],
+		PlaylistDirectory: info["playlist_directory"],
+		PCRE:              info["pcre"] == "1",
+	}, nil
+}
+
+// Commands returns the commands the client is allowed to run.
+func (c *MPDClient) Commands() ([]string, error) {
+	return c.listValues("commands", "command")
+}
+
+// NotCommands returns the commands the client isn't allowed to run.
+func (c *MPDClient) NotCommands() ([]string, error) {
+	return c.listValues("notcommands", "command")
+}
+
+// URLHandlers returns the URL schemes MPD can play.
+func (c *MPDClient) URLHandlers() ([]string, error) {
+	return c.listValues("urlhandlers", "handler")
+}
+
+func (c *MPDClient) Decoders() ([]Decoder, error) {
+	res := c.Cmd("decoders")
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+
+	decoders := make([]Decoder, 0)
+	for _, line := range res.Data {
+		match := responseRegexp.FindStringSubmatch(line)
+		if match == nil {
+			return nil, errors.New(fmt.Sprintf("Invalid input: %s", line))
+		}
+		if match[1] == "plugin" {
+			decoders = append(decoders, Decoder{Plugin: match[2]})
+			continue
+		}
+		if len(decoders) == 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid input: %s, expected %s", match[1], "plugin"))
+		}
+		decoder := &decoders[len(decoders)-1]
+		switch match[1] {
+		case "suffix":
+			decoder.Suffixes = append(decoder.Suffixes, match[2])
+		case "mime_type":
+			decoder.MimeTypes = append(decoder.MimeTypes, match[2])
+		}
+	}
+	return decoders, nil
+}
+
+// listValues runs cmd and returns the values of its lines with the given key.
+func (c *MPDClient) listValues(cmd, key string) ([]string, error) {
+	res := c.Cmd(cmd)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	return parseValues(res.Data, key)
+}
+
+// simpleCmd runs cmd, for commands which return no data.
+func (c *MPDClient) simpleCmd(cmd string) error {
+	res := c.Cmd(cmd)
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.MPDErr != nil {
+		return res.MPDErr
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// Curve maps the progress of a fade, from 0 to 1,
+// to the progress of the volume, from 0 to 1.
+type Curve func(t float64) float64
+
+// Curves are the curves known by name, for jobs and messages.
+var Curves = map[string]Curve{
+	"linear": func(t float64) float64 { return t },
+	// Slow at first, as the ear is more sensitive to low volumes.
+	"quadratic": func(t float64) float64 { return t * t },
+	"cubic":     func(t float64) float64 { return t * t * t },
+	// Fast at first.
+	"sqrt": math.Sqrt,
+	// Slow at both ends.
+	"smooth": func(t float64) float64 { return t * t * (3 - 2*t) },
+}
+
+const DefaultCurve = "quadratic"
+
+func curveNamed(name string) (Curve, error) {
+	if name == "" {
+		name = DefaultCurve
+	}
+	curve, ok := Curves[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown curve: %s", name))
+	}
+	return curve, nil
+}
+
+// DefaultStep is the interval between two volume changes of a fade.
+const DefaultStep = time.Second
+
+// fadeVolume returns the volume at progress t of a fade.
+func fadeVolume(from, to int, t float64, curve Curve) int {
+	if t >= 1 {
+		return to
+	}
+	if to >= from {
+		return from + int(math.Round(float64(to-from)*curve(t)))
+	}
+	// Fading out mirrors fading in.
+	return to + int(math.Round(float64(from-to)*curve(1-t)))
+}
+
+// Fade changes the volume from from to to over d, with setvol every
+// step. It returns early with false if stop is closed.
+func Fade(c *mpdclient.MPDClient, from, to int, d, step time.Duration, curve Curve, stop <-chan struct{}) (bool, error) {
+	if step <= 0 {
+		step = DefaultStep
+	}
+	start := time.Now()
+	last := -1
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	for {
+		t := 1.0
+		if d > 0 {
+			t = float64(time.Since(start)) / float64(d)
+		}
+		if volume := fadeVolume(from, to, t, curve); volume != last {
+			if err := c.SetVolume(volume); err != nil {
+				return false, err
+			}
+			last = volume
+		}
+		if t >= 1 {
+			return true, nil
+		}
+		select {
+		case <-stop:
+			return false, nil
+		case <-ticker.C:
+		}
+	}
+}
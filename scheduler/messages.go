@@ -0,0 +1,168 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// The messages of the channel are commands, with the arguments
+// quoted as in the MPD protocol when needed:
+//
+//	sleep 30m [fade=5m] [curve=quadratic]
+//	sleep song
+//	sleep album
+//	alarm 07:30 "Morning mix" [volume=60] [fade=10m] [curve=smooth] [daily]
+//	cancel 3
+//	cancel all
+//	list
+//
+// The reply, sent on the channel followed by ".reply", is "ok" and
+// the id of the job, the jobs in JSON for list, or "error:" and
+// what went wrong.
+
+func (s *Scheduler) readMessages() {
+	msgs, err := s.c.ReadChannelMessages(s.Channel)
+	if err != nil {
+		s.Logger.Warn("reading messages failed", "error", err)
+		return
+	}
+	for _, msg := range msgs {
+		reply, err := s.handleMessage(msg.Message, time.Now())
+		if err != nil {
+			reply = "error: " + err.Error()
+		}
+		// Nobody may be listening to replies.
+		s.c.SendMessage(s.Channel+".reply", reply)
+	}
+}
+
+func (s *Scheduler) handleMessage(text string, now time.Time) (string, error) {
+	cmd := mpdclient.ParseCommand(text)
+	args, opts, err := splitOptions(cmd.Args)
+	if err != nil {
+		return "", err
+	}
+	var job *Job
+	switch cmd.Name {
+	case "sleep":
+		if len(args) != 1 {
+			return "", errors.New("Usage: sleep <duration|song|album> [fade=<duration>] [curve=<name>]")
+		}
+		switch args[0] {
+		case "song":
+			job, err = s.StopAfterSong()
+		case "album":
+			job, err = s.StopAfterAlbum()
+		default:
+			var d time.Duration
+			if d, err = time.ParseDuration(args[0]); err != nil {
+				return "", err
+			}
+			job, err = s.SleepIn(d, opts.fade, opts.curve)
+		}
+	case "alarm":
+		if len(args) != 2 {
+			return "", errors.New("Usage: alarm <hh:mm> <playlist> [volume=<n>] [fade=<duration>] [curve=<name>] [daily]")
+		}
+		var at time.Time
+		if at, err = alarmTime(args[0], now); err != nil {
+			return "", err
+		}
+		job, err = s.AddAlarm(at, args[1], opts.volume, opts.fade, opts.curve, opts.daily)
+	case "cancel":
+		if len(args) != 1 {
+			return "", errors.New("Usage: cancel <id|all>")
+		}
+		if args[0] != "all" {
+			return "ok", s.Cancel(args[0])
+		}
+		for _, job := range s.Jobs() {
+			if err := s.Cancel(job.ID); err != nil {
+				return "", err
+			}
+		}
+		return "ok", nil
+	case "list":
+		data, err := json.Marshal(s.Jobs())
+		return string(data), err
+	default:
+		return "", errors.New(fmt.Sprintf("Unknown command: %s", cmd.Name))
+	}
+	if err != nil {
+		return "", err
+	}
+	return "ok " + job.ID, nil
+}
+
+type options struct {
+	fade   time.Duration
+	curve  string
+	volume int
+	daily  bool
+}
+
+// splitOptions separates the name=value options and flags
+// from the positional arguments.
+func splitOptions(args []string) ([]string, *options, error) {
+	opts := &options{}
+	var positional []string
+	var err error
+	for _, arg := range args {
+		name, value, found := strings.Cut(arg, "=")
+		switch {
+		case name == "daily" && !found:
+			opts.daily = true
+		case name == "fade" && found:
+			opts.fade, err = time.ParseDuration(value)
+		case name == "curve" && found:
+			opts.curve = value
+		case name == "volume" && found:
+			opts.volume, err = strconv.Atoi(value)
+		default:
+			positional = append(positional, arg)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return positional, opts, nil
+}
+
+// alarmTime returns the next time at the time of day hh:mm, local
+// time, or a time in RFC 3339 format.
+func alarmTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, err
+	}
+	at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	return nextDaily(at, now), nil
+}
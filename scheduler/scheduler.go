@@ -0,0 +1,544 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package scheduler stops MPD after some time, the current song
+// or the current album, and wakes up with alarms playing a stored
+// playlist, fading the volume in and out. Jobs are kept in a JSON
+// file across restarts, and can be set by any client with messages
+// on a channel, like:
+//
+//	mpc sendmessage scheduler "sleep 30m fade=5m"
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+type Kind string
+
+const (
+	// KindSleep stops the player at At, fading out for Fade before.
+	KindSleep Kind = "sleep"
+	// KindStopAfterSong stops the player at the end of the song SongId.
+	KindStopAfterSong Kind = "stop-after-song"
+	// KindStopAfterAlbum stops the player at the end of Album.
+	KindStopAfterAlbum Kind = "stop-after-album"
+	// KindAlarm replaces the queue with Playlist at At and plays it,
+	// fading in to Volume for Fade.
+	KindAlarm Kind = "alarm"
+)
+
+type Job struct {
+	ID       string        `json:"id"`
+	Kind     Kind          `json:"kind"`
+	At       time.Time     `json:"at"`
+	Fade     time.Duration `json:"fade,omitempty"`
+	Curve    string        `json:"curve,omitempty"`
+	Playlist string        `json:"playlist,omitempty"`
+	// Volume is the volume an alarm fades in to, the current
+	// volume if zero.
+	Volume int `json:"volume,omitempty"`
+	// Daily alarms ring every day at the same time.
+	Daily  bool   `json:"daily,omitempty"`
+	SongId int    `json:"song_id,omitempty"`
+	Album  string `json:"album,omitempty"`
+}
+
+func (j *Job) timed() bool {
+	return j.Kind == KindSleep || j.Kind == KindAlarm
+}
+
+// fireAt returns when the timer of a timed job fires.
+func (j *Job) fireAt() time.Time {
+	if j.Kind == KindSleep {
+		return j.At.Add(-j.Fade)
+	}
+	return j.At
+}
+
+// DefaultChannel is the channel the scheduler takes messages on.
+// Replies are sent on the channel followed by ".reply".
+const DefaultChannel = "scheduler"
+
+// Grace is how late a job found when starting may still run.
+// Older ones are dropped, and daily alarms moved to the next day.
+const Grace = time.Minute
+
+type entry struct {
+	job    Job
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+// Scheduler runs the jobs on an MPD server.
+type Scheduler struct {
+	// Path is the JSON file keeping the jobs, none if empty.
+	Path    string
+	Channel string
+	// Step is the interval between two volume changes of a fade.
+	Step   time.Duration
+	Logger *slog.Logger
+
+	c       *mpdclient.MPDClient
+	mu      sync.Mutex
+	entries map[string]*entry
+	nextId  int
+	done    chan struct{}
+}
+
+func New(c *mpdclient.MPDClient, path string) *Scheduler {
+	return &Scheduler{
+		Path:    path,
+		Channel: DefaultChannel,
+		Step:    DefaultStep,
+		Logger:  c.Logger,
+		c:       c,
+		entries: make(map[string]*entry),
+		nextId:  1,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start loads the jobs of Path, and runs them until Close is called.
+func (s *Scheduler) Start() error {
+	jobs, err := loadJobs(s.Path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	for _, job := range jobs {
+		if id, err := strconv.Atoi(job.ID); err == nil && id >= s.nextId {
+			s.nextId = id + 1
+		}
+		if job.timed() && job.fireAt().Before(now.Add(-Grace)) {
+			if job.Kind != KindAlarm || !job.Daily {
+				s.Logger.Info("dropping late job", "id", job.ID, "kind", job.Kind)
+				continue
+			}
+			job.At = nextDaily(job.At, now)
+		}
+		s.add(job)
+	}
+	err = s.save()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.c.Subscribe(s.Channel); err != nil {
+		return err
+	}
+	events := s.c.Idle("message", "player")
+	s.checkPlayer()
+	go func() {
+		defer events.Close()
+		for {
+			var subsystem string
+			var ok bool
+			select {
+			case <-s.done:
+				return
+			case subsystem, ok = <-events.Ch:
+				if !ok {
+					return
+				}
+			}
+			switch subsystem {
+			case "message":
+				s.readMessages()
+			case "player":
+				s.checkPlayer()
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stops the scheduler. The jobs stay in Path for the next Start.
+func (s *Scheduler) Close() {
+	close(s.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		close(e.cancel)
+	}
+	s.entries = make(map[string]*entry)
+	s.c.Unsubscribe(s.Channel)
+}
+
+// Jobs returns the pending jobs, by id.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs()
+}
+
+func (s *Scheduler) jobs() []Job {
+	jobs := make([]Job, 0, len(s.entries))
+	for _, e := range s.entries {
+		jobs = append(jobs, e.job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		a, _ := strconv.Atoi(jobs[i].ID)
+		b, _ := strconv.Atoi(jobs[j].ID)
+		return a < b
+	})
+	return jobs
+}
+
+// SleepIn stops the player in d, fading out for fade before.
+func (s *Scheduler) SleepIn(d, fade time.Duration, curve string) (*Job, error) {
+	if fade > d {
+		fade = d
+	}
+	return s.schedule(Job{Kind: KindSleep, At: time.Now().Add(d), Fade: fade, Curve: curve})
+}
+
+// StopAfterSong stops the player at the end of the current song.
+func (s *Scheduler) StopAfterSong() (*Job, error) {
+	state, err := s.c.PlayerState()
+	if err != nil {
+		return nil, err
+	}
+	if state.State != mpdclient.StatePlay || state.SongId < 0 {
+		return nil, errors.New("Not playing")
+	}
+	if s.c.Supports(mpdclient.FeatureSingleOneshot) {
+		if err := s.c.SetSingle(mpdclient.ModeOneshot); err != nil {
+			return nil, err
+		}
+	}
+	return s.schedule(Job{Kind: KindStopAfterSong, SongId: state.SongId})
+}
+
+// StopAfterAlbum stops the player at the end of the album
+// of the current song.
+func (s *Scheduler) StopAfterAlbum() (*Job, error) {
+	song, err := s.c.Playing()
+	if err != nil {
+		return nil, err
+	}
+	if song == nil {
+		return nil, errors.New("Not playing")
+	}
+	job, err := s.schedule(Job{Kind: KindStopAfterAlbum, SongId: song.Id, Album: song.Album})
+	if err != nil {
+		return nil, err
+	}
+	s.checkPlayer()
+	return job, nil
+}
+
+// AddAlarm plays playlist at at, fading in to volume for fade.
+func (s *Scheduler) AddAlarm(at time.Time, playlist string, volume int, fade time.Duration, curve string, daily bool) (*Job, error) {
+	if playlist == "" {
+		return nil, errors.New("Alarm has no playlist")
+	}
+	return s.schedule(Job{Kind: KindAlarm, At: at, Playlist: playlist, Volume: volume, Fade: fade, Curve: curve, Daily: daily})
+}
+
+func (s *Scheduler) schedule(job Job) (*Job, error) {
+	if _, err := curveNamed(job.Curve); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.ID = strconv.Itoa(s.nextId)
+	s.nextId++
+	s.add(job)
+	return &job, s.save()
+}
+
+// Cancel removes a job. A fade in progress stops, and the
+// volume is put back.
+func (s *Scheduler) Cancel(id string) error {
+	s.mu.Lock()
+	e, ok := s.entries[id]
+	if !ok {
+		s.mu.Unlock()
+		return errors.New(fmt.Sprintf("No such job: %s", id))
+	}
+	s.remove(id)
+	err := s.save()
+	s.mu.Unlock()
+	if e.job.Kind == KindStopAfterSong || e.job.Kind == KindStopAfterAlbum {
+		if state, err := s.c.PlayerState(); err == nil && state.Single == mpdclient.ModeOneshot {
+			s.c.SetSingle(mpdclient.ModeOff)
+		}
+	}
+	return err
+}
+
+// add arms job. s.mu must be held.
+func (s *Scheduler) add(job Job) {
+	e := &entry{job: job, cancel: make(chan struct{})}
+	s.entries[job.ID] = e
+	if job.timed() {
+		d := time.Until(job.fireAt())
+		if d < 0 {
+			d = 0
+		}
+		e.timer = time.AfterFunc(d, func() { s.run(e) })
+	}
+}
+
+// remove disarms the job id. s.mu must be held.
+func (s *Scheduler) remove(id string) {
+	e, ok := s.entries[id]
+	if !ok {
+		return
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	close(e.cancel)
+	delete(s.entries, id)
+}
+
+// finish removes a job which ran, unless it was cancelled meanwhile.
+func (s *Scheduler) finish(e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[e.job.ID] != e {
+		return
+	}
+	s.remove(e.job.ID)
+	if err := s.save(); err != nil {
+		s.Logger.Warn("saving jobs failed", "error", err)
+	}
+}
+
+func (s *Scheduler) run(e *entry) {
+	var err error
+	switch e.job.Kind {
+	case KindSleep:
+		err = s.sleep(e)
+	case KindAlarm:
+		err = s.ring(e)
+	}
+	if err != nil {
+		s.Logger.Warn("job failed", "id", e.job.ID, "kind", e.job.Kind, "error", err)
+	}
+}
+
+func (s *Scheduler) sleep(e *entry) error {
+	defer s.finish(e)
+	state, err := s.c.PlayerState()
+	if err != nil {
+		return err
+	}
+	if e.job.Fade > 0 && state.Volume > 0 && state.State == mpdclient.StatePlay {
+		curve, _ := curveNamed(e.job.Curve)
+		done, err := Fade(s.c, state.Volume, 0, e.job.Fade, s.Step, curve, e.cancel)
+		if err != nil || !done {
+			// Put the volume back when cancelled
+			s.c.SetVolume(state.Volume)
+			return err
+		}
+	}
+	if err := s.c.Stop(); err != nil {
+		return err
+	}
+	if state.Volume >= 0 {
+		// Not to wake up with a silent player
+		return s.c.SetVolume(state.Volume)
+	}
+	return nil
+}
+
+func (s *Scheduler) ring(e *entry) error {
+	job := e.job
+	if job.Daily {
+		// Arm the next ring first, so a failing one doesn't stop them.
+		s.mu.Lock()
+		if s.entries[job.ID] == e {
+			s.remove(job.ID)
+			next := job
+			next.At = nextDaily(job.At, time.Now())
+			s.add(next)
+			if err := s.save(); err != nil {
+				s.Logger.Warn("saving jobs failed", "error", err)
+			}
+		}
+		s.mu.Unlock()
+	} else {
+		defer s.finish(e)
+	}
+
+	volume := job.Volume
+	if volume <= 0 {
+		state, err := s.c.PlayerState()
+		if err != nil {
+			return err
+		}
+		volume = state.Volume
+	}
+	if err := s.c.Clear(); err != nil {
+		return err
+	}
+	if err := s.c.Load(job.Playlist); err != nil {
+		return err
+	}
+	if job.Fade > 0 && volume > 0 {
+		if err := s.c.SetVolume(0); err != nil {
+			return err
+		}
+	} else if volume > 0 {
+		if err := s.c.SetVolume(volume); err != nil {
+			return err
+		}
+	}
+	if err := s.c.Play(0); err != nil {
+		return err
+	}
+	if job.Fade > 0 && volume > 0 {
+		curve, _ := curveNamed(job.Curve)
+		_, err := Fade(s.c, 0, volume, job.Fade, s.Step, curve, e.cancel)
+		return err
+	}
+	return nil
+}
+
+// nextDaily returns the first time after now at the time of day of at.
+func nextDaily(at, now time.Time) time.Time {
+	for !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at
+}
+
+// checkPlayer runs the stop-after jobs on player changes.
+func (s *Scheduler) checkPlayer() {
+	s.mu.Lock()
+	var entries []*entry
+	for _, e := range s.entries {
+		if !e.job.timed() {
+			entries = append(entries, e)
+		}
+	}
+	s.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+	state, err := s.c.PlayerState()
+	if err != nil {
+		s.Logger.Warn("player state failed", "error", err)
+		return
+	}
+	for _, e := range entries {
+		if err := s.checkStopAfter(e, state); err != nil {
+			s.Logger.Warn("job failed", "id", e.job.ID, "kind", e.job.Kind, "error", err)
+		}
+	}
+}
+
+func (s *Scheduler) checkStopAfter(e *entry, state *mpdclient.PlayerState) error {
+	if state.State == mpdclient.StateStop {
+		s.finish(e)
+		return nil
+	}
+	switch e.job.Kind {
+	case KindStopAfterSong:
+		if state.SongId != e.job.SongId {
+			s.finish(e)
+			return s.c.Stop()
+		}
+	case KindStopAfterAlbum:
+		song, err := s.c.Playing()
+		if err != nil {
+			return err
+		}
+		if song == nil || song.Album != e.job.Album {
+			s.finish(e)
+			return s.c.Stop()
+		}
+		if !s.c.Supports(mpdclient.FeatureSingleOneshot) || state.Single == mpdclient.ModeOneshot {
+			return nil
+		}
+		// Stop right at the end of the last song of the album
+		status, err := s.c.Status()
+		if err != nil {
+			return err
+		}
+		last := true
+		if next, ok := (*status)["nextsong"]; ok {
+			pos, err := strconv.Atoi(next)
+			if err != nil {
+				return err
+			}
+			nextSong, err := s.c.QueueSong(pos)
+			if err != nil {
+				return err
+			}
+			last = nextSong.Album != e.job.Album
+		}
+		if last {
+			return s.c.SetSingle(mpdclient.ModeOneshot)
+		}
+	}
+	return nil
+}
+
+func loadJobs(path string) ([]Job, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// save writes the jobs to Path. s.mu must be held.
+func (s *Scheduler) save() error {
+	if s.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.jobs(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
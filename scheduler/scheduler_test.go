@@ -0,0 +1,105 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFadeVolume(t *testing.T) {
+	linear := Curves["linear"]
+	tests := []struct {
+		from, to int
+		t        float64
+		expected int
+	}{
+		{0, 80, 0, 0},
+		{0, 80, 0.5, 40},
+		{0, 80, 1.5, 80},
+		{80, 0, 0.25, 60},
+		{80, 20, 1, 20},
+	}
+	for _, test := range tests {
+		if v := fadeVolume(test.from, test.to, test.t, linear); v != test.expected {
+			t.Fatalf("%+v: got %d", test, v)
+		}
+	}
+	// Quadratic fades in slowly, and out quickly.
+	quadratic := Curves["quadratic"]
+	if v := fadeVolume(0, 100, 0.5, quadratic); v != 25 {
+		t.Fatalf("Expected %d, got %d", 25, v)
+	}
+	if v := fadeVolume(100, 0, 0.5, quadratic); v != 25 {
+		t.Fatalf("Expected %d, got %d", 25, v)
+	}
+}
+
+func TestAlarmTime(t *testing.T) {
+	now := time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)
+	at, err := alarmTime("07:30", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, 3, 11, 7, 30, 0, 0, time.UTC); !at.Equal(expected) {
+		t.Fatalf("Expected %s, got %s", expected, at)
+	}
+	at, err = alarmTime("22:15", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, 3, 10, 22, 15, 0, 0, time.UTC); !at.Equal(expected) {
+		t.Fatalf("Expected %s, got %s", expected, at)
+	}
+}
+
+func TestSplitOptions(t *testing.T) {
+	args, opts, err := splitOptions([]string{"07:30", "Morning mix", "volume=60", "fade=10m", "daily"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 || args[1] != "Morning mix" {
+		t.Fatalf("Unexpected arguments %q", args)
+	}
+	if opts.volume != 60 || opts.fade != 10*time.Minute || !opts.daily {
+		t.Fatalf("Unexpected options %+v", opts)
+	}
+	if _, _, err := splitOptions([]string{"fade=soon"}); err == nil {
+		t.Fatal("Expected an error for an invalid fade")
+	}
+}
+
+func TestSaveLoadJobs(t *testing.T) {
+	s := &Scheduler{Path: filepath.Join(t.TempDir(), "jobs.json"), entries: make(map[string]*entry)}
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	s.entries["2"] = &entry{job: Job{ID: "2", Kind: KindAlarm, At: at, Playlist: "Morning", Daily: true}}
+	s.entries["10"] = &entry{job: Job{ID: "10", Kind: KindStopAfterAlbum, Album: "Kind of Blue"}}
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := loadJobs(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != "2" || !jobs[0].At.Equal(at) || jobs[1].Album != "Kind of Blue" {
+		t.Fatalf("Unexpected jobs %+v", jobs)
+	}
+}
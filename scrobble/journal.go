@@ -0,0 +1,171 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package scrobble
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrUnknownSink is returned to Replay to keep a listen
+// whose sink isn't known.
+var ErrUnknownSink = errors.New("unknown sink")
+
+type journalEntry struct {
+	Sink   string  `json:"sink"`
+	Listen *Listen `json:"listen"`
+}
+
+// Journal is a file of listens to submit again, one JSON
+// object per line.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+	// replay serializes the replays, which submit without
+	// holding mu.
+	replay sync.Mutex
+}
+
+// OpenJournal returns the journal at path, creating
+// its directory if needed.
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return &Journal{path: path}, nil
+}
+
+// Append adds a listen for sinkName and syncs the journal to disk.
+func (j *Journal) Append(sinkName string, l *Listen) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(journalEntry{sinkName, l}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Len returns the number of listens in the journal.
+func (j *Journal) Len() (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries, err := j.read()
+	return len(entries), err
+}
+
+// Replay calls submit for each listen of the journal, in order,
+// and keeps in the journal those it fails for. The journal isn't
+// locked while submitting: the listens appended meanwhile are kept.
+func (j *Journal) Replay(submit func(sinkName string, l *Listen) error) error {
+	j.replay.Lock()
+	defer j.replay.Unlock()
+	j.mu.Lock()
+	entries, err := j.read()
+	j.mu.Unlock()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	var kept []journalEntry
+	for _, e := range entries {
+		if err := submit(e.Sink, e.Listen); err != nil {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == len(entries) {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	current, err := j.read()
+	if err != nil {
+		return err
+	}
+	if len(current) > len(entries) {
+		kept = append(kept, current[len(entries):]...)
+	}
+	return j.write(kept)
+}
+
+func (j *Journal) read() ([]journalEntry, error) {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e journalEntry
+		// A line cut by a crash is skipped.
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Listen == nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// write replaces the journal with entries, through a temporary
+// file renamed over it.
+func (j *Journal) write(entries []journalEntry) error {
+	tmp := j.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
@@ -0,0 +1,256 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package scrobble submits the songs played on MPD to sinks like
+// ListenBrainz or Last.fm, keeping the failed submissions in a
+// journal on disk to retry them later.
+package scrobble
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/playcount"
+)
+
+type ListenType string
+
+const (
+	// PlayingNow tells a song started playing. They are not retried.
+	PlayingNow ListenType = "playing_now"
+	// Single is a song played, to add to the history of the user.
+	Single ListenType = "single"
+)
+
+// Track is the metadata of a song sent to the sinks.
+type Track struct {
+	Artist      string        `json:"artist"`
+	Title       string        `json:"title"`
+	Album       string        `json:"album,omitempty"`
+	AlbumArtist string        `json:"album_artist,omitempty"`
+	TrackNumber string        `json:"track_number,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	File        string        `json:"file,omitempty"`
+	// MusicBrainz identifiers, from the MUSICBRAINZ_* tags.
+	RecordingMBID    string   `json:"recording_mbid,omitempty"`
+	ReleaseMBID      string   `json:"release_mbid,omitempty"`
+	ReleaseTrackMBID string   `json:"release_track_mbid,omitempty"`
+	ArtistMBIDs      []string `json:"artist_mbids,omitempty"`
+}
+
+// TrackOf returns the metadata of song.
+func TrackOf(song *mpdclient.Song) Track {
+	return Track{
+		Artist:           song.Artist,
+		Title:            song.Title,
+		Album:            song.Album,
+		AlbumArtist:      song.AlbumArtist,
+		TrackNumber:      song.Track,
+		Duration:         song.Duration,
+		File:             song.File,
+		RecordingMBID:    song.MusicBrainzTrackID,
+		ReleaseMBID:      song.MusicBrainzAlbumID,
+		ReleaseTrackMBID: song.MusicBrainzReleaseTrackID,
+		ArtistMBIDs:      song.Tags["MUSICBRAINZ_ARTISTID"],
+	}
+}
+
+// Listen is a record sent to the sinks.
+type Listen struct {
+	Type ListenType `json:"type"`
+	// ListenedAt is when the song started playing.
+	ListenedAt time.Time `json:"listened_at"`
+	Track      Track     `json:"track"`
+}
+
+// Sink receives the listens. The name of a sink identifies it
+// in the journal, so it must not change between runs.
+type Sink interface {
+	Name() string
+	Submit(l *Listen) error
+}
+
+// DefaultRetryInterval is the interval between the retries
+// of the journaled listens.
+const DefaultRetryInterval = 5 * time.Minute
+
+// Scrobbler turns the player states into listens and submits them
+// to its sinks. The listens a sink fails to take are written to the
+// journal, if any, and retried every RetryInterval.
+type Scrobbler struct {
+	Sinks         []Sink
+	Journal       *Journal
+	RetryInterval time.Duration
+	Logger        *slog.Logger
+
+	mu       sync.Mutex
+	detector *playcount.Detector
+	done     chan struct{}
+	once     sync.Once
+}
+
+func New(sinks ...Sink) *Scrobbler {
+	return &Scrobbler{
+		Sinks:         sinks,
+		RetryInterval: DefaultRetryInterval,
+		Logger:        slog.New(slog.DiscardHandler),
+		detector:      playcount.NewDetector(),
+		done:          make(chan struct{}),
+	}
+}
+
+// Update takes the state of the player and its current song at time
+// now, and submits the listens it leads to. It is the way to feed
+// the scrobbler without Watch.
+func (s *Scrobbler) Update(state *mpdclient.PlayerState, song *mpdclient.Song, now time.Time) {
+	s.mu.Lock()
+	events := s.detector.Update(state, song, now)
+	s.mu.Unlock()
+	for _, e := range events {
+		var l Listen
+		switch e.Kind {
+		case playcount.Started:
+			l.Type = PlayingNow
+		case playcount.Played:
+			l.Type = Single
+		default:
+			continue
+		}
+		l.ListenedAt = e.Start
+		l.Track = TrackOf(&e.Song)
+		// Nothing to say about songs without artist nor title,
+		// like most streams.
+		if l.Track.Artist == "" || l.Track.Title == "" {
+			continue
+		}
+		s.submit(&l)
+	}
+}
+
+func (s *Scrobbler) submit(l *Listen) {
+	for _, sink := range s.Sinks {
+		err := sink.Submit(l)
+		if err == nil {
+			continue
+		}
+		s.Logger.Warn("submission failed", "sink", sink.Name(), "type", l.Type, "error", err)
+		if l.Type == PlayingNow || s.Journal == nil || IsPermanent(err) {
+			continue
+		}
+		if err := s.Journal.Append(sink.Name(), l); err != nil {
+			s.Logger.Error("journal append failed", "sink", sink.Name(), "error", err)
+		}
+	}
+}
+
+// Watch feeds the scrobbler with the player of c, each time
+// a "player" idle event occurs, until Close is called.
+// It also starts retrying the journal.
+func (s *Scrobbler) Watch(c *mpdclient.MPDClient) error {
+	events := c.Idle("player")
+	update := func() error {
+		state, err := c.PlayerState()
+		if err != nil {
+			return err
+		}
+		song, err := c.Playing()
+		if err != nil {
+			return err
+		}
+		s.Update(state, song, time.Now())
+		return nil
+	}
+	if err := update(); err != nil {
+		events.Close()
+		return err
+	}
+	go func() {
+		defer events.Close()
+		for {
+			select {
+			case <-s.done:
+				return
+			case _, ok := <-events.Ch:
+				if !ok {
+					return
+				}
+			}
+			if err := update(); err != nil {
+				s.Logger.Warn("player update failed", "error", err)
+			}
+		}
+	}()
+	s.StartRetrying()
+	return nil
+}
+
+// StartRetrying retries the journal every RetryInterval,
+// until Close is called.
+func (s *Scrobbler) StartRetrying() {
+	if s.Journal == nil {
+		return
+	}
+	s.once.Do(func() {
+		go func() {
+			ticker := time.NewTicker(s.RetryInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.done:
+					return
+				case <-ticker.C:
+					if err := s.Retry(); err != nil {
+						s.Logger.Warn("journal retry failed", "error", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Retry submits the journaled listens again. Those the sinks take,
+// or refuse for good, are removed from the journal.
+func (s *Scrobbler) Retry() error {
+	if s.Journal == nil {
+		return nil
+	}
+	sinks := make(map[string]Sink)
+	for _, sink := range s.Sinks {
+		sinks[sink.Name()] = sink
+	}
+	return s.Journal.Replay(func(sinkName string, l *Listen) error {
+		sink, ok := sinks[sinkName]
+		if !ok {
+			// Keep the listens of sinks not configured this time.
+			return ErrUnknownSink
+		}
+		err := sink.Submit(l)
+		if err != nil && IsPermanent(err) {
+			s.Logger.Warn("dropping journaled listen", "sink", sinkName, "error", err)
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *Scrobbler) Close() {
+	close(s.done)
+}
@@ -0,0 +1,208 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package scrobble
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+var testSong = &mpdclient.Song{
+	File:               "Air/Moon Safari/01.flac",
+	Title:              "La femme d'argent",
+	Artist:             "Air",
+	Album:              "Moon Safari",
+	Duration:           7 * time.Minute,
+	MusicBrainzTrackID: "f2b2b2d4-0000-0000-0000-000000000000",
+	Tags:               map[string][]string{"MUSICBRAINZ_ARTISTID": {"cb67438a-7f50-4f2b-a6f1-2bb2729fd538"}},
+}
+
+// playSong makes s listen to testSong for 5 minutes.
+func playSong(s *Scrobbler) {
+	origin := time.Now()
+	s.Update(&mpdclient.PlayerState{State: mpdclient.StatePlay, SongId: 1}, testSong, origin)
+	s.Update(&mpdclient.PlayerState{State: mpdclient.StateStop, SongId: -1}, nil, origin.Add(5*time.Minute))
+}
+
+type listenBrainzStub struct {
+	mu       sync.Mutex
+	failures int
+	payloads []lbPayload
+}
+
+func (stub *listenBrainzStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/1/submit-listens" || r.Header.Get("Authorization") != "Token secret" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.failures > 0 {
+		stub.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var p lbPayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stub.payloads = append(stub.payloads, p)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+func TestListenBrainzJournal(t *testing.T) {
+	stub := &listenBrainzStub{failures: 2}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(&ListenBrainz{URL: server.URL, Token: "secret"})
+	s.Journal = journal
+	playSong(s)
+
+	// The playing_now listen failed and is dropped,
+	// the single one failed and is journaled.
+	if n, err := journal.Len(); err != nil || n != 1 {
+		t.Fatalf("Expected %d journaled listen, got %d (%v)", 1, n, err)
+	}
+	if err := s.Retry(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := journal.Len(); err != nil || n != 0 {
+		t.Fatalf("Expected an empty journal, got %d (%v)", n, err)
+	}
+	if len(stub.payloads) != 1 || stub.payloads[0].ListenType != string(Single) {
+		t.Fatalf("Unexpected payloads %+v", stub.payloads)
+	}
+	metadata := stub.payloads[0].Payload[0].TrackMetadata
+	if metadata.ArtistName != "Air" || metadata.AdditionalInfo["recording_mbid"] != testSong.MusicBrainzTrackID {
+		t.Fatalf("Unexpected track metadata %+v", metadata)
+	}
+}
+
+func TestJournalAppendDuringReplay(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Listen{Type: Single, ListenedAt: time.Now()}
+	if err := journal.Append("a", l); err != nil {
+		t.Fatal(err)
+	}
+	// A listen journaled while the sinks are slow must survive the replay
+	err = journal.Replay(func(sinkName string, l *Listen) error {
+		return journal.Append("b", l)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sinks []string
+	journal.Replay(func(sinkName string, l *Listen) error {
+		sinks = append(sinks, sinkName)
+		return ErrUnknownSink
+	})
+	if len(sinks) != 1 || sinks[0] != "b" {
+		t.Fatalf("Expected the listen of %q, got %q", "b", sinks)
+	}
+}
+
+func TestPermanentErrorsAreNotJournaled(t *testing.T) {
+	server := httptest.NewServer(&listenBrainzStub{})
+	defer server.Close()
+
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(&ListenBrainz{URL: server.URL, Token: "wrong"})
+	s.Journal = journal
+	playSong(s)
+	if n, err := journal.Len(); err != nil || n != 0 {
+		t.Fatalf("Expected an empty journal, got %d (%v)", n, err)
+	}
+}
+
+func TestLastFMSignature(t *testing.T) {
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		params := r.PostForm
+		sig := params.Get("api_sig")
+		params.Del("api_sig")
+		params.Del("format")
+		if sig != lastFMSignature(params, "s3cr3t") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": 13, "message": "Invalid method signature supplied"}`))
+			return
+		}
+		method = params.Get("method")
+		w.Write([]byte(`{"scrobbles": {}}`))
+	}))
+	defer server.Close()
+
+	sink := &LastFM{URL: server.URL, APIKey: "key", Secret: "s3cr3t", SessionKey: "sk"}
+	l := &Listen{Type: Single, ListenedAt: time.Now(), Track: TrackOf(testSong)}
+	if err := sink.Submit(l); err != nil {
+		t.Fatal(err)
+	}
+	if method != "track.scrobble" {
+		t.Fatalf("Expected method %s, got %s", "track.scrobble", method)
+	}
+	sink.Secret = "wrong"
+	if err := sink.Submit(l); !IsPermanent(err) {
+		t.Fatalf("Expected a permanent error, got %v", err)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "listens.jsonl")
+	var listens []Listen
+	s := New(&FileSink{Path: path}, &FuncSink{"func", func(l *Listen) error {
+		listens = append(listens, *l)
+		return nil
+	}})
+	playSong(s)
+	if len(listens) != 2 || listens[0].Type != PlayingNow || listens[1].Type != Single {
+		t.Fatalf("Unexpected listens %+v", listens)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var l Listen
+	if err := json.Unmarshal(data, &l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Type != Single || l.Track.Title != testSong.Title {
+		t.Fatalf("Unexpected listen %+v", l)
+	}
+}
@@ -0,0 +1,325 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package scrobble
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PermanentError is an error of a sink which retrying won't fix,
+// like a listen the service refuses.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func IsPermanent(err error) bool {
+	var perr *PermanentError
+	return errors.As(err, &perr)
+}
+
+// FuncSink calls a function with the listens.
+type FuncSink struct {
+	SinkName string
+	F        func(l *Listen) error
+}
+
+func (s *FuncSink) Name() string {
+	return s.SinkName
+}
+
+func (s *FuncSink) Submit(l *Listen) error {
+	return s.F(l)
+}
+
+// FileSink appends the played listens to a file,
+// one JSON object per line.
+type FileSink struct {
+	Path string
+	// NowPlaying also writes the listens of type PlayingNow.
+	NowPlaying bool
+
+	mu sync.Mutex
+}
+
+func (s *FileSink) Name() string {
+	return "file:" + s.Path
+}
+
+func (s *FileSink) Submit(l *Listen) error {
+	if l.Type == PlayingNow && !s.NowPlaying {
+		return nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return &PermanentError{err}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// httpError returns an error for an unsuccessful response.
+// Client errors other than 429 are permanent.
+func httpError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	err := errors.New(fmt.Sprintf("%s: %s", res.Status, strings.TrimSpace(string(body))))
+	if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+		return &PermanentError{err}
+	}
+	return err
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+	return c
+}
+
+// DefaultListenBrainzURL is the root of the ListenBrainz API.
+const DefaultListenBrainzURL = "https://api.listenbrainz.org"
+
+// ListenBrainz submits the listens with the ListenBrainz API,
+// which other services implement too.
+type ListenBrainz struct {
+	// URL is the root of the API, DefaultListenBrainzURL if empty.
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func (s *ListenBrainz) Name() string {
+	u := s.URL
+	if u == "" {
+		u = DefaultListenBrainzURL
+	}
+	return "listenbrainz:" + u
+}
+
+type lbPayload struct {
+	ListenType string     `json:"listen_type"`
+	Payload    []lbListen `json:"payload"`
+}
+
+type lbListen struct {
+	ListenedAt    int64           `json:"listened_at,omitempty"`
+	TrackMetadata lbTrackMetadata `json:"track_metadata"`
+}
+
+type lbTrackMetadata struct {
+	ArtistName     string                 `json:"artist_name"`
+	TrackName      string                 `json:"track_name"`
+	ReleaseName    string                 `json:"release_name,omitempty"`
+	AdditionalInfo map[string]interface{} `json:"additional_info,omitempty"`
+}
+
+func (s *ListenBrainz) Submit(l *Listen) error {
+	t := &l.Track
+	info := map[string]interface{}{
+		"media_player":      "MPD",
+		"submission_client": "mpdclient",
+	}
+	for key, value := range map[string]string{
+		"recording_mbid":      t.RecordingMBID,
+		"release_mbid":        t.ReleaseMBID,
+		"track_mbid":          t.ReleaseTrackMBID,
+		"tracknumber":         t.TrackNumber,
+		"release_artist_name": t.AlbumArtist,
+	} {
+		if value != "" {
+			info[key] = value
+		}
+	}
+	if len(t.ArtistMBIDs) > 0 {
+		info["artist_mbids"] = t.ArtistMBIDs
+	}
+	if t.Duration > 0 {
+		info["duration_ms"] = t.Duration.Milliseconds()
+	}
+	listen := lbListen{TrackMetadata: lbTrackMetadata{
+		ArtistName:     t.Artist,
+		TrackName:      t.Title,
+		ReleaseName:    t.Album,
+		AdditionalInfo: info,
+	}}
+	if l.Type != PlayingNow {
+		listen.ListenedAt = l.ListenedAt.Unix()
+	}
+	body, err := json.Marshal(lbPayload{string(l.Type), []lbListen{listen}})
+	if err != nil {
+		return &PermanentError{err}
+	}
+
+	root := s.URL
+	if root == "" {
+		root = DefaultListenBrainzURL
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(root, "/")+"/1/submit-listens", bytes.NewReader(body))
+	if err != nil {
+		return &PermanentError{err}
+	}
+	req.Header.Set("Authorization", "Token "+s.Token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient(s.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return httpError(res)
+	}
+	return nil
+}
+
+// DefaultLastFMURL is the endpoint of the Last.fm API.
+const DefaultLastFMURL = "https://ws.audioscrobbler.com/2.0/"
+
+// LastFM submits the listens with the Last.fm API,
+// which Libre.fm and others implement too.
+type LastFM struct {
+	// URL is the endpoint of the API, DefaultLastFMURL if empty.
+	URL        string
+	APIKey     string
+	Secret     string
+	SessionKey string
+	Client     *http.Client
+}
+
+func (s *LastFM) Name() string {
+	u := s.URL
+	if u == "" {
+		u = DefaultLastFMURL
+	}
+	return "lastfm:" + u
+}
+
+// Last.fm errors worth retrying: service offline, temporarily
+// unavailable and rate limit exceeded.
+var lastFMTemporaryErrors = map[int]bool{11: true, 16: true, 29: true}
+
+func (s *LastFM) Submit(l *Listen) error {
+	t := &l.Track
+	params := url.Values{}
+	params.Set("api_key", s.APIKey)
+	params.Set("sk", s.SessionKey)
+	params.Set("artist", t.Artist)
+	params.Set("track", t.Title)
+	if t.Album != "" {
+		params.Set("album", t.Album)
+	}
+	if t.AlbumArtist != "" {
+		params.Set("albumArtist", t.AlbumArtist)
+	}
+	if t.TrackNumber != "" {
+		params.Set("trackNumber", t.TrackNumber)
+	}
+	if t.RecordingMBID != "" {
+		params.Set("mbid", t.RecordingMBID)
+	}
+	if t.Duration > 0 {
+		params.Set("duration", strconv.Itoa(int(t.Duration/time.Second)))
+	}
+	if l.Type == PlayingNow {
+		params.Set("method", "track.updateNowPlaying")
+	} else {
+		params.Set("method", "track.scrobble")
+		params.Set("timestamp", strconv.FormatInt(l.ListenedAt.Unix(), 10))
+	}
+	params.Set("api_sig", lastFMSignature(params, s.Secret))
+	params.Set("format", "json")
+
+	endpoint := s.URL
+	if endpoint == "" {
+		endpoint = DefaultLastFMURL
+	}
+	res, err := httpClient(s.Client).PostForm(endpoint, params)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || (result.Error == 0 && res.StatusCode != http.StatusOK) {
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		return httpError(res)
+	}
+	if result.Error != 0 {
+		err := errors.New(fmt.Sprintf("Last.fm error %d: %s", result.Error, result.Message))
+		if lastFMTemporaryErrors[result.Error] {
+			return err
+		}
+		return &PermanentError{err}
+	}
+	return nil
+}
+
+// lastFMSignature signs the parameters of a call: the md5 of the
+// sorted names and values, followed by the secret.
+func lastFMSignature(params url.Values, secret string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteString(params.Get(name))
+	}
+	b.WriteString(secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
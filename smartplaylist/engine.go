@@ -0,0 +1,135 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package smartplaylist
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+)
+
+// DefaultDebounce is how long the engine waits for the events
+// to settle before refreshing the playlists.
+const DefaultDebounce = 2 * time.Second
+
+// Engine materializes rules into stored playlists, and refreshes
+// them on "database" and "sticker" idle events.
+type Engine struct {
+	Debounce time.Duration
+	Logger   *slog.Logger
+
+	c     *mpdclient.MPDClient
+	mu    sync.Mutex
+	rules []*Rule
+	done  chan struct{}
+}
+
+func NewEngine(c *mpdclient.MPDClient, rules ...*Rule) *Engine {
+	return &Engine{
+		Debounce: DefaultDebounce,
+		Logger:   c.Logger,
+		c:        c,
+		rules:    rules,
+		done:     make(chan struct{}),
+	}
+}
+
+// Add adds a rule and materializes its playlist.
+func (e *Engine) Add(r *Rule) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.rules = append(e.rules, r)
+	e.mu.Unlock()
+	_, err := r.Materialize(e.c)
+	return err
+}
+
+// Remove stops refreshing the playlist name. The stored
+// playlist is left as is.
+func (e *Engine) Remove(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := e.rules[:0]
+	for _, r := range e.rules {
+		if r.Name != name {
+			rules = append(rules, r)
+		}
+	}
+	e.rules = rules
+}
+
+// Refresh materializes all the rules. It goes on after a
+// failing rule, and returns the first error.
+func (e *Engine) Refresh() error {
+	e.mu.Lock()
+	rules := append([]*Rule(nil), e.rules...)
+	e.mu.Unlock()
+	var firstErr error
+	for _, r := range rules {
+		n, err := r.Materialize(e.c)
+		if err != nil {
+			e.Logger.Warn("smart playlist refresh failed", "playlist", r.Name, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		e.Logger.Debug("smart playlist refreshed", "playlist", r.Name, "songs", n)
+	}
+	return firstErr
+}
+
+// Start refreshes the playlists, then keeps them up to date
+// until Close is called.
+func (e *Engine) Start() error {
+	events := e.c.Idle("database", "sticker")
+	if err := e.Refresh(); err != nil {
+		events.Close()
+		return err
+	}
+	go func() {
+		defer events.Close()
+		var timer <-chan time.Time
+		for {
+			select {
+			case <-e.done:
+				return
+			case _, ok := <-events.Ch:
+				if !ok {
+					return
+				}
+				// Updates of the database and stickers come in bursts
+				timer = time.After(e.Debounce)
+			case <-timer:
+				timer = nil
+				e.Refresh()
+			}
+		}
+	}()
+	return nil
+}
+
+func (e *Engine) Close() {
+	close(e.done)
+}
@@ -0,0 +1,266 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package smartplaylist keeps stored playlists filled with the
+// songs of the database matching rules on their tags and stickers.
+//
+// For example, 50 random jazz songs rated 4 or more and not played
+// in the last 30 days:
+//
+//	rule := &smartplaylist.Rule{
+//		Name:            "Jazz picks",
+//		Filter:          mpdclient.Contains("Genre", "Jazz"),
+//		Stickers:        []smartplaylist.StickerCond{{"rating", ">=", 4}},
+//		NotPlayedWithin: 30 * 24 * time.Hour,
+//		Limit:           50,
+//		Sort:            smartplaylist.SortRandom,
+//	}
+package smartplaylist
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/playcount"
+)
+
+// SortRandom shuffles the songs of a playlist.
+const SortRandom = "random"
+
+// StickerCond compares the numeric value of a song sticker.
+// Songs without the sticker don't match.
+type StickerCond struct {
+	Name string
+	// Op is one of =, !=, <, <=, > and >=.
+	Op    string
+	Value float64
+}
+
+func (sc StickerCond) match(value float64) bool {
+	switch sc.Op {
+	case "=", "==":
+		return value == sc.Value
+	case "!=":
+		return value != sc.Value
+	case "<":
+		return value < sc.Value
+	case "<=":
+		return value <= sc.Value
+	case ">":
+		return value > sc.Value
+	case ">=":
+		return value >= sc.Value
+	}
+	return false
+}
+
+// Rule describes the songs of a smart playlist.
+type Rule struct {
+	// Name is the name of the stored playlist.
+	Name string
+	// Filter selects the songs in the database. The zero
+	// Filter selects all the songs.
+	Filter   mpdclient.Filter
+	Stickers []StickerCond
+	// NotPlayedWithin leaves out the songs played recently,
+	// from the lastplayed sticker of the playcount package.
+	NotPlayedWithin time.Duration
+	// Sort is SortRandom, a tag name, "Last-Modified", "Added",
+	// "Duration", or "sticker:" followed by a sticker name.
+	// A leading "-" sorts in descending order.
+	Sort string
+	// Limit is the maximum number of songs, 0 for no limit.
+	Limit int
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("Rule has no name")
+	}
+	for _, sc := range r.Stickers {
+		if !sc.known() {
+			return errors.New(fmt.Sprintf("Invalid sticker operator: %s", sc.Op))
+		}
+	}
+	return nil
+}
+
+func (sc StickerCond) known() bool {
+	switch sc.Op {
+	case "=", "==", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// stickerNames returns the stickers r needs the values of.
+func (r *Rule) stickerNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, sc := range r.Stickers {
+		add(sc.Name)
+	}
+	if r.NotPlayedWithin > 0 {
+		add(playcount.StickerLastPlayed)
+	}
+	if key := strings.TrimPrefix(r.Sort, "-"); strings.HasPrefix(key, "sticker:") {
+		add(strings.TrimPrefix(key, "sticker:"))
+	}
+	return names
+}
+
+// Evaluate returns the songs of the database matching r.
+func (r *Rule) Evaluate(c *mpdclient.MPDClient) ([]mpdclient.Song, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	var songs []mpdclient.Song
+	var err error
+	if r.Filter.String() == "" {
+		songs, err = c.ListAllInfo("")
+	} else {
+		songs, err = c.Find(r.Filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stickers := make(map[string]map[string]string)
+	for _, name := range r.stickerNames() {
+		found, err := c.StickerFind(mpdclient.StickerSongType, "", name)
+		if err != nil {
+			// MPD fails when no song has the sticker at all.
+			if mpdErr, ok := err.(*mpdclient.MPDError); ok && mpdErr.Ack == mpdclient.AckNoExist {
+				found = nil
+			} else {
+				return nil, err
+			}
+		}
+		values := make(map[string]string, len(found))
+		for _, s := range found {
+			values[s.Uri] = s.Value
+		}
+		stickers[name] = values
+	}
+	return r.apply(songs, stickers, time.Now()), nil
+}
+
+// apply selects, sorts and limits songs, given the values of the
+// stickers by name and uri.
+func (r *Rule) apply(songs []mpdclient.Song, stickers map[string]map[string]string, now time.Time) []mpdclient.Song {
+	selected := make([]mpdclient.Song, 0, len(songs))
+	for _, song := range songs {
+		if r.matchStickers(song.File, stickers, now) {
+			selected = append(selected, song)
+		}
+	}
+
+	key, desc := r.Sort, false
+	if strings.HasPrefix(key, "-") {
+		key, desc = key[1:], true
+	}
+	switch {
+	case key == "":
+	case key == SortRandom:
+		rand.Shuffle(len(selected), func(i, j int) { selected[i], selected[j] = selected[j], selected[i] })
+	case strings.HasPrefix(key, "sticker:"):
+		values := stickers[strings.TrimPrefix(key, "sticker:")]
+		number := func(uri string) float64 {
+			n, _ := strconv.ParseFloat(values[uri], 64)
+			return n
+		}
+		sort.SliceStable(selected, func(i, j int) bool {
+			a, b := number(selected[i].File), number(selected[j].File)
+			if desc {
+				return a > b
+			}
+			return a < b
+		})
+	default:
+		sort.SliceStable(selected, func(i, j int) bool {
+			if desc {
+				return lessSong(&selected[j], &selected[i], key)
+			}
+			return lessSong(&selected[i], &selected[j], key)
+		})
+	}
+
+	if r.Limit > 0 && len(selected) > r.Limit {
+		selected = selected[:r.Limit]
+	}
+	return selected
+}
+
+func (r *Rule) matchStickers(uri string, stickers map[string]map[string]string, now time.Time) bool {
+	for _, sc := range r.Stickers {
+		value, err := strconv.ParseFloat(stickers[sc.Name][uri], 64)
+		if err != nil || !sc.match(value) {
+			return false
+		}
+	}
+	if r.NotPlayedWithin > 0 {
+		if lastPlayed, err := strconv.ParseInt(stickers[playcount.StickerLastPlayed][uri], 10, 64); err == nil {
+			if now.Sub(time.Unix(lastPlayed, 0)) < r.NotPlayedWithin {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func lessSong(a, b *mpdclient.Song, key string) bool {
+	switch key {
+	case "Last-Modified":
+		return a.LastModified.Before(b.LastModified)
+	case "Added":
+		return a.Added.Before(b.Added)
+	case "Duration":
+		return a.Duration < b.Duration
+	case "Track", "Disc":
+		na, _ := strconv.Atoi(strings.SplitN(a.Tag(key), "/", 2)[0])
+		nb, _ := strconv.Atoi(strings.SplitN(b.Tag(key), "/", 2)[0])
+		return na < nb
+	}
+	return a.Tag(key) < b.Tag(key)
+}
+
+// Materialize writes the songs matching r into its stored playlist,
+// and returns their number.
+func (r *Rule) Materialize(c *mpdclient.MPDClient) (int, error) {
+	songs, err := r.Evaluate(c)
+	if err != nil {
+		return 0, err
+	}
+	uris := make([]string, len(songs))
+	for i, song := range songs {
+		uris[i] = song.File
+	}
+	return len(uris), c.PlaylistReplace(r.Name, uris)
+}
@@ -0,0 +1,90 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package smartplaylist
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/playcount"
+)
+
+func testSongs() []mpdclient.Song {
+	return []mpdclient.Song{
+		{File: "a.flac", Tags: map[string][]string{"Artist": {"Coltrane"}, "Track": {"2/9"}}},
+		{File: "b.flac", Tags: map[string][]string{"Artist": {"Davis"}, "Track": {"10/12"}}},
+		{File: "c.flac", Tags: map[string][]string{"Artist": {"Monk"}, "Track": {"1"}}},
+		{File: "d.flac", Tags: map[string][]string{"Artist": {"Evans"}, "Track": {"3"}}},
+	}
+}
+
+func files(songs []mpdclient.Song) []string {
+	uris := make([]string, len(songs))
+	for i, song := range songs {
+		uris[i] = song.File
+	}
+	return uris
+}
+
+func TestApply(t *testing.T) {
+	now := time.Now()
+	stickers := map[string]map[string]string{
+		"rating": {"a.flac": "5", "b.flac": "4", "c.flac": "2", "d.flac": "x"},
+		playcount.StickerLastPlayed: {
+			"a.flac": strconv.FormatInt(now.Add(-2*24*time.Hour).Unix(), 10),
+			"b.flac": strconv.FormatInt(now.Add(-60*24*time.Hour).Unix(), 10),
+		},
+	}
+	tests := []struct {
+		rule     Rule
+		expected []string
+	}{
+		{Rule{Stickers: []StickerCond{{"rating", ">=", 4}}}, []string{"a.flac", "b.flac"}},
+		{Rule{Stickers: []StickerCond{{"rating", ">=", 4}}, NotPlayedWithin: 30 * 24 * time.Hour}, []string{"b.flac"}},
+		{Rule{NotPlayedWithin: 30 * 24 * time.Hour, Sort: "-Artist"}, []string{"c.flac", "d.flac", "b.flac"}},
+		{Rule{Sort: "Track", Limit: 3}, []string{"c.flac", "a.flac", "d.flac"}},
+		{Rule{Sort: "-sticker:rating", Limit: 2}, []string{"a.flac", "b.flac"}},
+	}
+	for i, test := range tests {
+		got := files(test.rule.apply(testSongs(), stickers, now))
+		if len(got) != len(test.expected) {
+			t.Fatalf("Rule %d: expected %q, got %q", i, test.expected, got)
+		}
+		for j := range got {
+			if got[j] != test.expected[j] {
+				t.Fatalf("Rule %d: expected %q, got %q", i, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestStickerNames(t *testing.T) {
+	r := Rule{
+		Stickers:        []StickerCond{{"rating", ">=", 4}},
+		NotPlayedWithin: time.Hour,
+		Sort:            "-sticker:rating",
+	}
+	names := r.stickerNames()
+	if len(names) != 2 || names[0] != "rating" || names[1] != playcount.StickerLastPlayed {
+		t.Fatalf("Unexpected stickers %q", names)
+	}
+}
@@ -0,0 +1,196 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxCommandListLen bounds the commands sent in one command list,
+// to stay under the max_command_list_size of MPD.
+const maxCommandListLen = 512
+
+// Snapshot is the queue and the player state of MPD at a time.
+// It can be marshaled to JSON, and put back with Restore.
+type Snapshot struct {
+	Time   time.Time      `json:"time"`
+	Queue  []SnapshotSong `json:"queue"`
+	Player PlayerState    `json:"player"`
+}
+
+// SnapshotSong is a song of the queue of a snapshot.
+type SnapshotSong struct {
+	URI  string `json:"uri"`
+	Prio int    `json:"prio,omitempty"`
+	// Tags are the tags of a remote song. Restore sets them
+	// back with cleartagid and addtagid.
+	Tags map[string][]string `json:"tags,omitempty"`
+}
+
+// Snapshot returns the current queue and player state.
+func (c *MPDClient) Snapshot() (*Snapshot, error) {
+	songs, err := c.Queue()
+	if err != nil {
+		return nil, err
+	}
+	player, err := c.PlayerState()
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		Time:   time.Now(),
+		Queue:  make([]SnapshotSong, len(songs)),
+		Player: *player,
+	}
+	for i, song := range songs {
+		s.Queue[i] = SnapshotSong{URI: song.File, Prio: song.Prio}
+		// Only the tags of remote songs can be set.
+		if isRemote(song.File) && len(song.Tags) > 0 {
+			s.Queue[i].Tags = song.Tags
+		}
+	}
+	return s, nil
+}
+
+func isRemote(uri string) bool {
+	return strings.Contains(uri, "://")
+}
+
+// Restore replaces the queue and the player state with those of s.
+// The player resumes the current song of s at its elapsed time,
+// playing or paused.
+func (c *MPDClient) Restore(s *Snapshot) error {
+	p := &s.Player
+	for _, mode := range []struct {
+		mode    PlaybackMode
+		feature Feature
+	}{{p.Single, FeatureSingleOneshot}, {p.Consume, FeatureConsumeOneshot}} {
+		if mode.mode == ModeOneshot {
+			if err := c.require(mode.feature); err != nil {
+				return err
+			}
+		}
+	}
+
+	// First fill the queue, to learn the ids of the songs.
+	ids := make([]int, 0, len(s.Queue))
+	cmds := make([]string, 0, len(s.Queue)+1)
+	cmds = append(cmds, "stop", "clear")
+	for _, song := range s.Queue {
+		cmds = append(cmds, fmt.Sprintf("addid %s", quoteArg(song.URI)))
+	}
+	for i := 0; i < len(cmds); i += maxCommandListLen {
+		end := i + maxCommandListLen
+		if end > len(cmds) {
+			end = len(cmds)
+		}
+		data, err := c.runCommandList(cmds[i:end])
+		if err != nil {
+			return err
+		}
+		chunkIds, err := parseIds(data)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, chunkIds...)
+	}
+	if len(ids) != len(s.Queue) {
+		return errors.New(fmt.Sprintf("Expected %d ids, got %d", len(s.Queue), len(ids)))
+	}
+
+	// Then set the priorities, tags, options, and the current song.
+	cmds = cmds[:0]
+	for i, song := range s.Queue {
+		if song.Prio > 0 {
+			cmds = append(cmds, fmt.Sprintf("prioid %d %d", song.Prio, ids[i]))
+		}
+		if len(song.Tags) == 0 {
+			continue
+		}
+		// Clear the tags MPD read from the song, which are
+		// part of the snapshot, so that none is doubled.
+		cmds = append(cmds, fmt.Sprintf("cleartagid %d", ids[i]))
+		tags := make([]string, 0, len(song.Tags))
+		for tag := range song.Tags {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			for _, value := range song.Tags[tag] {
+				cmds = append(cmds, fmt.Sprintf("addtagid %d %s %s", ids[i], quoteArg(tag), quoteArg(value)))
+			}
+		}
+	}
+	cmds = append(cmds,
+		fmt.Sprintf("random %s", boolArg(p.Random)),
+		fmt.Sprintf("repeat %s", boolArg(p.Repeat)),
+		fmt.Sprintf("crossfade %d", int(p.Crossfade/time.Second)),
+	)
+	if p.Single != "" {
+		cmds = append(cmds, fmt.Sprintf("single %s", quoteArg(string(p.Single))))
+	}
+	if p.Consume != "" {
+		cmds = append(cmds, fmt.Sprintf("consume %s", quoteArg(string(p.Consume))))
+	}
+	if p.ReplayGain != "" {
+		cmds = append(cmds, fmt.Sprintf("replay_gain_mode %s", quoteArg(p.ReplayGain)))
+	}
+	if p.Volume >= 0 {
+		cmds = append(cmds, fmt.Sprintf("setvol %d", p.Volume))
+	}
+	if p.Song >= 0 && p.Song < len(ids) && p.State != StateStop {
+		id := ids[p.Song]
+		cmds = append(cmds, fmt.Sprintf("seekid %d %s", id, secondsArg(p.Elapsed)))
+		if p.State == StatePause {
+			cmds = append(cmds, "pause 1")
+		}
+	}
+	for i := 0; i < len(cmds); i += maxCommandListLen {
+		end := i + maxCommandListLen
+		if end > len(cmds) {
+			end = len(cmds)
+		}
+		if _, err := c.runCommandList(cmds[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCommandList sends cmds in a command list and returns
+// the lines of their responses.
+func (c *MPDClient) runCommandList(cmds []string) ([]string, error) {
+	l := c.BeginCommandList()
+	for _, cmd := range cmds {
+		l.Cmd(cmd)
+	}
+	res := l.End()
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	return res.Data, nil
+}
@@ -0,0 +1,216 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+type queueSong struct {
+	id   int
+	file string
+	prio int
+	tags [][2]string
+}
+
+// queueServer keeps the queue and the repeat mode of a fake server.
+// Remote songs get a Name tag when added, like a stream would.
+type queueServer struct {
+	mu     sync.Mutex
+	songs  []*queueSong
+	nextId int
+	repeat bool
+}
+
+func (q *queueServer) song(arg string) (*queueSong, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, mpdserver.Errorf(mpdclient.AckArg, "Integer expected: %s", arg)
+	}
+	for _, song := range q.songs {
+		if song.id == id {
+			return song, nil
+		}
+	}
+	return nil, mpdserver.Errorf(mpdclient.AckNoExist, "No such song")
+}
+
+func newQueueServer(t *testing.T) *mpdtest.Server {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	for _, cmd := range []string{"stop", "random", "crossfade", "single", "consume", "replay_gain_mode", "setvol", "seekid", "pause"} {
+		s.Respond(cmd, "")
+	}
+	s.Respond("replay_gain_status", "replay_gain_mode: off")
+
+	q := &queueServer{nextId: 1}
+	handle := func(name string, h func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error) {
+		s.Handle(name, func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return h(w, r)
+		})
+	}
+	handle("clear", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		q.songs = nil
+		return nil
+	})
+	handle("addid", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		song := &queueSong{id: q.nextId, file: r.Args[0]}
+		if strings.Contains(song.file, "://") {
+			song.tags = [][2]string{{"Name", "Stream"}}
+		}
+		q.nextId++
+		q.songs = append(q.songs, song)
+		w.Field("Id", song.id)
+		return nil
+	})
+	handle("prioid", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		song, err := q.song(r.Args[1])
+		if err != nil {
+			return err
+		}
+		song.prio, _ = strconv.Atoi(r.Args[0])
+		return nil
+	})
+	handle("addtagid", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		song, err := q.song(r.Args[0])
+		if err != nil {
+			return err
+		}
+		song.tags = append(song.tags, [2]string{r.Args[1], r.Args[2]})
+		return nil
+	})
+	handle("cleartagid", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		song, err := q.song(r.Args[0])
+		if err != nil {
+			return err
+		}
+		song.tags = nil
+		return nil
+	})
+	handle("repeat", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		q.repeat = r.Args[0] == "1"
+		return nil
+	})
+	handle("playlistinfo", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		for pos, song := range q.songs {
+			w.Field("file", song.file)
+			for _, tag := range song.tags {
+				w.Field(tag[0], tag[1])
+			}
+			w.Field("Pos", pos)
+			w.Field("Id", song.id)
+			if song.prio > 0 {
+				w.Field("Prio", song.prio)
+			}
+		}
+		return nil
+	})
+	handle("status", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		repeat := 0
+		if q.repeat {
+			repeat = 1
+		}
+		w.Field("volume", 50)
+		w.Field("repeat", repeat)
+		w.Field("random", 0)
+		w.Field("single", 0)
+		w.Field("consume", 0)
+		w.Field("playlistlength", len(q.songs))
+		w.Field("state", "stop")
+		return nil
+	})
+	return s
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	s := newQueueServer(t)
+	mpdc, err := mpdclient.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpdc.Close()
+
+	const songUri, streamUri = "tests/song.ogg", "http://radio.example.com/stream"
+	if _, err := mpdc.AddId(songUri, -1); err != nil {
+		t.Fatal(err)
+	}
+	id, err := mpdc.AddId(streamUri, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mpdc.PrioId(42, id); err != nil {
+		t.Fatal(err)
+	}
+	if res := mpdc.Cmd("addtagid " + strconv.Itoa(id) + " Title \"Live\""); res.Err != nil || res.MPDErr != nil {
+		t.Fatalf("addtagid failed: %v %v", res.Err, res.MPDErr)
+	}
+	if err := mpdc.SetRepeat(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshot and restore twice, the tags must not add up
+	for i := 0; i < 2; i++ {
+		snapshot, err := mpdc.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mpdc.Clear(); err != nil {
+			t.Fatal(err)
+		}
+		if err := mpdc.SetRepeat(false); err != nil {
+			t.Fatal(err)
+		}
+		if err := mpdc.Restore(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue, err := mpdc.Queue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 2 || queue[0].File != songUri || queue[1].File != streamUri || queue[1].Prio != 42 {
+		t.Fatalf("Unexpected queue %+v", queue)
+	}
+	expectedTags := map[string][]string{"Name": {"Stream"}, "Title": {"Live"}}
+	if !reflect.DeepEqual(queue[1].Tags, expectedTags) {
+		t.Fatalf("Expected tags %v, got %v", expectedTags, queue[1].Tags)
+	}
+	player, err := mpdc.PlayerState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !player.Repeat {
+		t.Fatal("Expected repeat to be restored")
+	}
+}
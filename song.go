@@ -0,0 +1,160 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Song is a song of the database or of the queue.
+type Song struct {
+	File         string
+	LastModified time.Time
+	// Added is the time the song was added to the database (MPD 0.24).
+	Added    time.Time
+	Duration time.Duration
+
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Genre       string
+	Date        string
+	Track       string
+	Disc        string
+	Name        string
+
+	MusicBrainzTrackID        string
+	MusicBrainzAlbumID        string
+	MusicBrainzArtistID       string
+	MusicBrainzAlbumArtistID  string
+	MusicBrainzReleaseTrackID string
+
+	// Pos, Id and Prio are only set for the songs of the queue.
+	Pos  int
+	Id   int
+	Prio int
+
+	// Tags holds all the tags of the song, with all their values.
+	Tags map[string][]string
+}
+
+// Tag returns the first value of a tag, or an empty string.
+func (s *Song) Tag(name string) string {
+	if values := s.Tags[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// splitLine splits a response line into its key and value.
+func splitLine(line string) (string, string, error) {
+	i := strings.Index(line, ": ")
+	if i == -1 {
+		// Empty values, as the mount point of the music directory,
+		// may come without the trailing space.
+		if strings.HasSuffix(line, ":") {
+			return line[:len(line)-1], "", nil
+		}
+		return "", "", errors.New(fmt.Sprintf("Invalid input: %s", line))
+	}
+	return line[:i], line[i+2:], nil
+}
+
+var songTags = map[string]func(*Song) *string{
+	"Title":                      func(s *Song) *string { return &s.Title },
+	"Artist":                     func(s *Song) *string { return &s.Artist },
+	"Album":                      func(s *Song) *string { return &s.Album },
+	"AlbumArtist":                func(s *Song) *string { return &s.AlbumArtist },
+	"Genre":                      func(s *Song) *string { return &s.Genre },
+	"Date":                       func(s *Song) *string { return &s.Date },
+	"Track":                      func(s *Song) *string { return &s.Track },
+	"Disc":                       func(s *Song) *string { return &s.Disc },
+	"Name":                       func(s *Song) *string { return &s.Name },
+	"MUSICBRAINZ_TRACKID":        func(s *Song) *string { return &s.MusicBrainzTrackID },
+	"MUSICBRAINZ_ALBUMID":        func(s *Song) *string { return &s.MusicBrainzAlbumID },
+	"MUSICBRAINZ_ARTISTID":       func(s *Song) *string { return &s.MusicBrainzArtistID },
+	"MUSICBRAINZ_ALBUMARTISTID":  func(s *Song) *string { return &s.MusicBrainzAlbumArtistID },
+	"MUSICBRAINZ_RELEASETRACKID": func(s *Song) *string { return &s.MusicBrainzReleaseTrackID },
+}
+
+// setSongField sets the field of song the key of a response line is about.
+func setSongField(song *Song, key, value string) error {
+	var err error
+	switch key {
+	case "Last-Modified":
+		song.LastModified, err = time.Parse(time.RFC3339, value)
+	case "Added":
+		song.Added, err = time.Parse(time.RFC3339, value)
+	case "duration":
+		song.Duration, err = parseSeconds(value)
+	case "Time":
+		// Deprecated by duration, which comes after it
+		if song.Duration == 0 {
+			song.Duration, err = parseSeconds(value)
+		}
+	case "Pos":
+		song.Pos, err = strconv.Atoi(value)
+	case "Id":
+		song.Id, err = strconv.Atoi(value)
+	case "Prio":
+		song.Prio, err = strconv.Atoi(value)
+	case "Format", "Range":
+	default:
+		song.Tags[key] = append(song.Tags[key], value)
+		if field, ok := songTags[key]; ok && *field(song) == "" {
+			*field(song) = value
+		}
+	}
+	return err
+}
+
+// parseSongs parses a list of songs, each starting with a file line.
+// Directories and playlists of the list are skipped.
+func parseSongs(data []string) ([]Song, error) {
+	songs := make([]Song, 0)
+	var song *Song
+	for _, line := range data {
+		key, value, err := splitLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "file":
+			songs = append(songs, Song{File: value, Tags: make(map[string][]string)})
+			song = &songs[len(songs)-1]
+			continue
+		case "directory", "playlist":
+			song = nil
+			continue
+		}
+		if song == nil {
+			continue
+		}
+		if err := setSongField(song, key, value); err != nil {
+			return nil, err
+		}
+	}
+	return songs, nil
+}
@@ -0,0 +1,287 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Mount is a storage mounted in the music directory.
+// The music directory itself is the mount with an empty Point.
+type Mount struct {
+	Point   string
+	Storage string
+}
+
+// Neighbor is a storage discovered by a neighbor plugin,
+// which can be given to Mount.
+type Neighbor struct {
+	URI  string
+	Name string
+}
+
+func (c *MPDClient) Mount(point, uri string) error {
+	if err := c.require(FeatureMounts); err != nil {
+		return err
+	}
+	return c.simpleCmd(fmt.Sprintf("mount %s %s", quoteArg(point), quoteArg(uri)))
+}
+
+func (c *MPDClient) Unmount(point string) error {
+	if err := c.require(FeatureMounts); err != nil {
+		return err
+	}
+	return c.simpleCmd(fmt.Sprintf("unmount %s", quoteArg(point)))
+}
+
+func (c *MPDClient) ListMounts() ([]Mount, error) {
+	if err := c.require(FeatureMounts); err != nil {
+		return nil, err
+	}
+	res := c.Cmd("listmounts")
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	return parseMounts(res.Data)
+}
+
+// ListNeighbors returns the storages found on the network.
+// It fails if the server has no neighbor plugin configured.
+func (c *MPDClient) ListNeighbors() ([]Neighbor, error) {
+	if err := c.require(FeatureNeighbors); err != nil {
+		return nil, err
+	}
+	res := c.Cmd("listneighbors")
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	return parseNeighbors(res.Data)
+}
+
+func parseMounts(data []string) ([]Mount, error) {
+	mounts := make([]Mount, 0)
+	for _, line := range data {
+		key, value, err := splitLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "mount":
+			mounts = append(mounts, Mount{Point: value})
+		case "storage":
+			if len(mounts) == 0 {
+				return nil, errors.New(fmt.Sprintf("Invalid input: %s, expected %s", key, "mount"))
+			}
+			mounts[len(mounts)-1].Storage = value
+		}
+	}
+	return mounts, nil
+}
+
+func parseNeighbors(data []string) ([]Neighbor, error) {
+	neighbors := make([]Neighbor, 0)
+	for _, line := range data {
+		key, value, err := splitLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "neighbor":
+			neighbors = append(neighbors, Neighbor{URI: value})
+		case "name":
+			if len(neighbors) == 0 {
+				return nil, errors.New(fmt.Sprintf("Invalid input: %s, expected %s", key, "neighbor"))
+			}
+			neighbors[len(neighbors)-1].Name = value
+		}
+	}
+	return neighbors, nil
+}
+
+// MountsDiff is sent by a MountWatcher when the mounts change.
+type MountsDiff struct {
+	Before    []Mount
+	After     []Mount
+	Mounted   []Mount
+	Unmounted []Mount
+}
+
+// NeighborsDiff is sent by a NeighborWatcher when neighbors
+// are found or lost.
+type NeighborsDiff struct {
+	Before      []Neighbor
+	After       []Neighbor
+	Appeared    []Neighbor
+	Disappeared []Neighbor
+}
+
+// MountWatcher reports the changes of the mounts,
+// each time a "mount" idle event occurs.
+type MountWatcher struct {
+	Ch chan MountsDiff
+	idleWatcher
+
+	mu     sync.Mutex
+	mounts []Mount
+}
+
+// NeighborWatcher reports the changes of the neighbors,
+// each time a "neighbor" idle event occurs.
+type NeighborWatcher struct {
+	Ch chan NeighborsDiff
+	idleWatcher
+
+	mu        sync.Mutex
+	neighbors []Neighbor
+}
+
+// WatchMounts starts watching the mounts of the MPD server.
+func (c *MPDClient) WatchMounts() (*MountWatcher, error) {
+	mounts, err := c.ListMounts()
+	if err != nil {
+		return nil, err
+	}
+	w := &MountWatcher{Ch: make(chan MountsDiff), mounts: mounts}
+	w.init(c, "mount")
+	go w.loop("mount", w.refresh)
+	return w, nil
+}
+
+// Mounts returns the mounts currently known by the watcher.
+func (w *MountWatcher) Mounts() []Mount {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Mount(nil), w.mounts...)
+}
+
+func (w *MountWatcher) refresh() error {
+	mounts, err := w.c.ListMounts()
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	diff := diffMounts(w.mounts, mounts)
+	w.mounts = mounts
+	w.mu.Unlock()
+	if len(diff.Mounted) == 0 && len(diff.Unmounted) == 0 {
+		return nil
+	}
+	select {
+	case w.Ch <- diff:
+	case <-w.done:
+	}
+	return nil
+}
+
+// WatchNeighbors starts watching the neighbors found by the MPD server.
+func (c *MPDClient) WatchNeighbors() (*NeighborWatcher, error) {
+	neighbors, err := c.ListNeighbors()
+	if err != nil {
+		return nil, err
+	}
+	w := &NeighborWatcher{Ch: make(chan NeighborsDiff), neighbors: neighbors}
+	w.init(c, "neighbor")
+	go w.loop("neighbor", w.refresh)
+	return w, nil
+}
+
+// Neighbors returns the neighbors currently known by the watcher.
+func (w *NeighborWatcher) Neighbors() []Neighbor {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Neighbor(nil), w.neighbors...)
+}
+
+func (w *NeighborWatcher) refresh() error {
+	neighbors, err := w.c.ListNeighbors()
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	diff := diffNeighbors(w.neighbors, neighbors)
+	w.neighbors = neighbors
+	w.mu.Unlock()
+	if len(diff.Appeared) == 0 && len(diff.Disappeared) == 0 {
+		return nil
+	}
+	select {
+	case w.Ch <- diff:
+	case <-w.done:
+	}
+	return nil
+}
+
+// diffMounts compares mounts by point and storage, so a point
+// mounted again elsewhere is both unmounted and mounted.
+func diffMounts(before, after []Mount) MountsDiff {
+	diff := MountsDiff{Before: before, After: after}
+	was := make(map[Mount]bool)
+	for _, m := range before {
+		was[m] = true
+	}
+	is := make(map[Mount]bool)
+	for _, m := range after {
+		is[m] = true
+		if !was[m] {
+			diff.Mounted = append(diff.Mounted, m)
+		}
+	}
+	for _, m := range before {
+		if !is[m] {
+			diff.Unmounted = append(diff.Unmounted, m)
+		}
+	}
+	sort.Slice(diff.Mounted, func(i, j int) bool { return diff.Mounted[i].Point < diff.Mounted[j].Point })
+	sort.Slice(diff.Unmounted, func(i, j int) bool { return diff.Unmounted[i].Point < diff.Unmounted[j].Point })
+	return diff
+}
+
+// diffNeighbors compares neighbors by URI.
+func diffNeighbors(before, after []Neighbor) NeighborsDiff {
+	diff := NeighborsDiff{Before: before, After: after}
+	was := make(map[string]bool)
+	for _, n := range before {
+		was[n.URI] = true
+	}
+	is := make(map[string]bool)
+	for _, n := range after {
+		is[n.URI] = true
+		if !was[n.URI] {
+			diff.Appeared = append(diff.Appeared, n)
+		}
+	}
+	for _, n := range before {
+		if !is[n.URI] {
+			diff.Disappeared = append(diff.Disappeared, n)
+		}
+	}
+	sort.Slice(diff.Appeared, func(i, j int) bool { return diff.Appeared[i].URI < diff.Appeared[j].URI })
+	sort.Slice(diff.Disappeared, func(i, j int) bool { return diff.Disappeared[i].URI < diff.Disappeared[j].URI })
+	return diff
+}
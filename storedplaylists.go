@@ -65,8 +65,8 @@ func (c *MPDClient) ListPlaylists() ([]PlaylistInfo, error) {
 
 func (c *MPDClient) Save(name string) error {
 	res := c.Cmd(fmt.Sprintf(
-		"save \"%s\"",
-		name,
+		"save %s",
+		quoteArg(name),
 	))
 	if res.Err != nil {
 		return res.Err
@@ -80,8 +80,8 @@ func (c *MPDClient) Save(name string) error {
 
 func (c *MPDClient) Rm(name string) error {
 	res := c.Cmd(fmt.Sprintf(
-		"rm \"%s\"",
-		name,
+		"rm %s",
+		quoteArg(name),
 	))
 	if res.Err != nil {
 		return res.Err
@@ -95,8 +95,8 @@ func (c *MPDClient) Rm(name string) error {
 
 func (c *MPDClient) PlaylistClear(name string) error {
 	res := c.Cmd(fmt.Sprintf(
-		"playlistclear \"%s\"",
-		name,
+		"playlistclear %s",
+		quoteArg(name),
 	))
 	if res.Err != nil {
 		return res.Err
@@ -110,8 +110,8 @@ func (c *MPDClient) PlaylistClear(name string) error {
 
 func (c *MPDClient) ListPlaylist(name string) ([]string, error) {
 	res := c.Cmd(fmt.Sprintf(
-		"listplaylist \"%s\"",
-		name,
+		"listplaylist %s",
+		quoteArg(name),
 	))
 	if res.Err != nil {
 		return nil, res.Err
@@ -134,9 +134,9 @@ func (c *MPDClient) ListPlaylist(name string) ([]string, error) {
 
 func (c *MPDClient) PlaylistAdd(name, uri string) error {
 	res := c.Cmd(fmt.Sprintf(
-		"playlistadd \"%s\" \"%s\"",
-		name,
-		uri,
+		"playlistadd %s %s",
+		quoteArg(name),
+		quoteArg(uri),
 	))
 	if res.Err != nil {
 		return res.Err
@@ -147,3 +147,88 @@ func (c *MPDClient) PlaylistAdd(name, uri string) error {
 
 	return nil
 }
+
+// PlaylistAddAt inserts uri at position pos of a stored playlist.
+// Servers which don't support playlistadd with a position get
+// the song appended then moved.
+func (c *MPDClient) PlaylistAddAt(name, uri string, pos int) error {
+	if c.Supports(FeaturePlaylistAddPosition) {
+		return c.simpleCmd(fmt.Sprintf(
+			"playlistadd %s %s %d",
+			quoteArg(name),
+			quoteArg(uri),
+			pos,
+		))
+	}
+	songs, err := c.ListPlaylist(name)
+	if err != nil {
+		return err
+	}
+	if err := c.PlaylistAdd(name, uri); err != nil {
+		return err
+	}
+	return c.simpleCmd(fmt.Sprintf(
+		"playlistmove %s %d %d",
+		quoteArg(name),
+		len(songs),
+		pos,
+	))
+}
+
+// ListPlaylistInfo returns the songs of a stored playlist with
+// their metadata from the database.
+func (c *MPDClient) ListPlaylistInfo(name string) ([]Song, error) {
+	res := c.Cmd(fmt.Sprintf("listplaylistinfo %s", quoteArg(name)))
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.MPDErr != nil {
+		return nil, res.MPDErr
+	}
+	return parseSongs(res.Data)
+}
+
+// PlaylistReplace replaces the songs of a stored playlist with
+// uris, creating it if needed. Songs are added with command lists,
+// built before the playlist is cleared so that a command refused by
+// the interceptors leaves it untouched.
+func (c *MPDClient) PlaylistReplace(name string, uris []string) error {
+	var lists []*CommandList
+	for i := 0; i < len(uris); i += maxCommandListLen {
+		end := i + maxCommandListLen
+		if end > len(uris) {
+			end = len(uris)
+		}
+		l := c.BeginCommandList()
+		for _, uri := range uris[i:end] {
+			l.Cmd(fmt.Sprintf("playlistadd %s %s", quoteArg(name), quoteArg(uri)))
+		}
+		if l.res != nil {
+			if l.res.Err != nil {
+				return l.res.Err
+			}
+			return l.res.MPDErr
+		}
+		lists = append(lists, l)
+	}
+	if err := c.PlaylistClear(name); err != nil {
+		if mpdErr, ok := err.(*MPDError); !ok || mpdErr.Ack != AckNoExist {
+			return err
+		}
+	}
+	for _, l := range lists {
+		res := l.End()
+		if res.Err != nil {
+			return res.Err
+		}
+		if res.MPDErr != nil {
+			return res.MPDErr
+		}
+	}
+	return nil
+}
+
+// Load appends the songs of a stored playlist to the queue.
+func (c *MPDClient) Load(name string) error {
+	return c.simpleCmd(fmt.Sprintf("load %s", quoteArg(name)))
+}
@@ -22,6 +22,7 @@ package mpdclient
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 type ChannelMessage struct {
@@ -29,12 +30,36 @@ type ChannelMessage struct {
 	Message string
 }
 
-func (c *MPDClient) subscriptionCmd(cmd string) *response {
-	c.Logger.Println(cmd, "> entering")
+func (c *MPDClient) subscriptionCmd(cmd string) *Response {
+	// Without a subscription loop, the subscriptions
+	// belong to the main connection.
+	if c.subscriptionConn == nil {
+		return c.Cmd(cmd)
+	}
+	return c.invoke(ParseCommand(cmd), c.sendIdle)
+}
+
+// sendIdle is the Invoker of the subscription connection.
+func (c *MPDClient) sendIdle(cmd *Command) *Response {
+	start := time.Now()
+	res := c.idleCmd(cmd.String())
+	c.logCmd(cmd, start, res)
+	return res
+}
+
+// idleCmd sends cmd on the subscription connection, interrupting
+// the subscription loop which reads the response. The commands are
+// sent one at a time, each once the loop is idle again.
+func (c *MPDClient) idleCmd(cmd string) *Response {
+	var r Response
+	if err := c.Err(); err != nil {
+		r.Err = err
+		return &r
+	}
+	c.idleCmdMu.Lock()
+	defer c.idleCmdMu.Unlock()
 	c.idle.MaybeWait()
-	var r response
 
-	c.Logger.Println(cmd, "> sending noidle")
 	id, err := c.subscriptionConn.Cmd("noidle")
 	if err != nil {
 		r.Err = err
@@ -47,24 +72,21 @@ func (c *MPDClient) subscriptionCmd(cmd string) *response {
 		r.Err = err
 		return &r
 	}
-	c.Logger.Println(cmd, "> sent noidle")
-	id, err = c.subscriptionConn.Cmd(cmd)
+	id, err = c.subscriptionConn.Cmd("%s", cmd)
 	if err != nil {
 		r.Err = err
 		return &r
 	}
-	c.Logger.Println(cmd, "> sending id", id)
 	var req request = request(id)
 	c.idle.reqCh <- &req
-	c.Logger.Println(cmd, "> sent, waiting response", id)
 	res := <-c.idle.resCh
 	return res
 }
 
 func (c *MPDClient) Subscribe(channel string) error {
 	res := c.subscriptionCmd(fmt.Sprintf(
-		"subscribe \"%s\"",
-		channel,
+		"subscribe %s",
+		quoteArg(channel),
 	))
 	if res.MPDErr != nil {
 		return res.MPDErr
@@ -74,8 +96,8 @@ func (c *MPDClient) Subscribe(channel string) error {
 
 func (c *MPDClient) Unsubscribe(channel string) error {
 	res := c.subscriptionCmd(fmt.Sprintf(
-		"unsubscribe \"%s\"",
-		channel,
+		"unsubscribe %s",
+		quoteArg(channel),
 	))
 	if res.Err != nil {
 		return res.Err
@@ -86,7 +108,43 @@ func (c *MPDClient) Unsubscribe(channel string) error {
 	return nil
 }
 
+// ReadMessages returns the messages received on all the channels
+// the client is subscribed to.
 func (c *MPDClient) ReadMessages() ([]ChannelMessage, error) {
+	c.messagesMu.Lock()
+	defer c.messagesMu.Unlock()
+	msgs, err := c.readMessages()
+	if err != nil {
+		return nil, err
+	}
+	msgs = append(c.messages, msgs...)
+	c.messages = nil
+	return msgs, nil
+}
+
+// ReadChannelMessages returns the messages received on channel.
+// The messages of the other channels are kept for ReadMessages, so
+// that several readers of a client don't take each other's messages.
+func (c *MPDClient) ReadChannelMessages(channel string) ([]ChannelMessage, error) {
+	c.messagesMu.Lock()
+	defer c.messagesMu.Unlock()
+	msgs, err := c.readMessages()
+	if err != nil {
+		return nil, err
+	}
+	var matched, kept []ChannelMessage
+	for _, msg := range append(c.messages, msgs...) {
+		if msg.Channel == channel {
+			matched = append(matched, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	c.messages = kept
+	return matched, nil
+}
+
+func (c *MPDClient) readMessages() ([]ChannelMessage, error) {
 	res := c.subscriptionCmd("readmessages")
 	if res.Err != nil {
 		return nil, res.Err
@@ -137,9 +195,9 @@ func (c *MPDClient) Channels() ([]string, error) {
 
 func (c *MPDClient) SendMessage(channel, text string) error {
 	res := c.Cmd(fmt.Sprintf(
-		"sendmessage \"%s\" \"%s\"",
-		channel,
-		text,
+		"sendmessage %s %s",
+		quoteArg(channel),
+		quoteArg(text),
 	))
 
 	if res.Err != nil {
@@ -154,31 +212,32 @@ func (c *MPDClient) SendMessage(channel, text string) error {
 func (c *MPDClient) subscriptionLoop() {
 	defer func() {
 		if err := recover(); err != nil {
-			c.Logger.Panicf("Panic in subscriptionloop: %s\n", err)
+			c.Logger.Error("panic in subscription loop", "error", err)
+			panic(err)
 		}
 	}()
 	for {
-		c.Logger.Println("Entering subscriptionloop")
+		c.Logger.Debug("entering idle mode", "conn", "subscription")
 		id, err := c.subscriptionConn.Cmd("idle message")
 		if err != nil {
-			panic(err)
+			if c.idle.closing() {
+				return
+			}
+			c.lose(err)
+			return
 		}
 
-		c.Logger.Println("subscriptionloop ready1")
 		c.subscriptionConn.StartResponse(id)
-		c.Logger.Println("subscriptionloop ready2")
 
 		// Signal other goroutines that idle mode is ready
-		c.idle.c.L.Lock()
-		c.idle.c.Signal()
-		c.idle.c.L.Unlock()
-		c.idle.isIdle = true
+		c.idle.setIdle(true)
 
-		var subsystem *string
+		var subsystems []string
 		var idleErr error
 		for {
-			line, idleErr := c.subscriptionConn.ReadLine()
-			if idleErr != nil {
+			line, err := c.subscriptionConn.ReadLine()
+			if err != nil {
+				idleErr = err
 				break
 			}
 			if line == "OK" {
@@ -190,33 +249,34 @@ func (c *MPDClient) subscriptionLoop() {
 				}
 				key := match[1]
 				if key == "changed" {
-					l := match[2]
-					subsystem = &l
+					subsystems = append(subsystems, match[2])
 				}
 			}
 		}
 
 		c.subscriptionConn.EndResponse(id)
-		c.idle.isIdle = false
+		c.idle.setIdle(false)
 		if idleErr != nil {
-			panic(idleErr)
+			if c.idle.closing() {
+				return
+			}
+			c.lose(idleErr)
+			return
 		}
 
-		if subsystem != nil {
-			c.Logger.Println("subsystem", *subsystem, "changed")
-			go c.sendIdleChange(*subsystem)
+		if len(subsystems) > 0 {
+			c.Logger.Debug("idle changes", "conn", "subscription", "subsystems", subsystems)
+			go c.sendIdleChanges(subsystems)
 		} else {
-			c.Logger.Println("Noidle triggered")
+			c.Logger.Debug("noidle triggered", "conn", "subscription")
 			select {
 			case <-c.idle.quitCh:
 				return
 			default:
-				c.Logger.Println("waiting the request id")
 				req := <-c.idle.reqCh
 				reqId := uint(*(req))
-				c.Logger.Println("got request id", reqId)
 				c.subscriptionConn.StartResponse(reqId)
-				res := processConnData(c.subscriptionConn)
+				res := processConnData(c.subscriptionConn, maxBinaryChunk)
 				c.subscriptionConn.EndResponse(reqId)
 				c.idle.resCh <- &res
 			}
@@ -0,0 +1,159 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vincent-petithory/mpdclient"
+	"github.com/vincent-petithory/mpdclient/mpdserver"
+	"github.com/vincent-petithory/mpdclient/mpdtest"
+)
+
+func TestConcurrentSubscriptions(t *testing.T) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, cmd := range []string{"subscribe", "unsubscribe", "readmessages"} {
+		s.Handle(cmd, func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+			return nil
+		})
+	}
+	c, err := mpdclient.Dial("tcp", s.Addr, mpdclient.WithLoops(mpdclient.SubscriptionLoop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 60)
+	for i := 0; i < 20; i++ {
+		channel := fmt.Sprintf("channel%d", i)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			errs <- c.Subscribe(channel)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := c.ReadChannelMessages(channel)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- c.Unsubscribe(channel)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Concurrent subscription commands hung")
+	}
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHeartbeatWatchersUnsubscribe(t *testing.T) {
+	s, err := mpdtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var mu sync.Mutex
+	subscribed := make(map[string]bool)
+	unsubscribes := 0
+	s.Handle("subscribe", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if subscribed[r.Args[0]] {
+			return mpdserver.Errorf(mpdclient.AckExist, "already subscribed to this channel")
+		}
+		subscribed[r.Args[0]] = true
+		return nil
+	})
+	s.Handle("unsubscribe", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(subscribed, r.Args[0])
+		unsubscribes++
+		return nil
+	})
+	s.Handle("readmessages", func(w *mpdserver.ResponseWriter, r *mpdserver.Request) error {
+		return nil
+	})
+	c, err := mpdclient.Dial("tcp", s.Addr, mpdclient.WithLoops(mpdclient.IdleLoop|mpdclient.SubscriptionLoop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	isSubscribed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return subscribed[mpdclient.HeartbeatChannel]
+	}
+
+	w1, err := c.WatchHeartbeats(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := c.WatchHeartbeats(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w1.Close()
+	w1.Close()
+	if !isSubscribed() {
+		t.Fatal("Expected the other watcher to stay subscribed")
+	}
+	w2.Close()
+	if isSubscribed() {
+		t.Fatal("Expected the last watcher to unsubscribe")
+	}
+
+	// A subscription made by someone else is left as is
+	if err := c.Subscribe(mpdclient.HeartbeatChannel); err != nil {
+		t.Fatal(err)
+	}
+	w3, err := c.WatchHeartbeats(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w3.Close()
+	mu.Lock()
+	n := unsubscribes
+	mu.Unlock()
+	if !isSubscribed() || n != 1 {
+		t.Fatalf("Expected the subscription to be kept, got %d unsubscribes", n)
+	}
+}
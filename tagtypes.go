@@ -0,0 +1,137 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"strings"
+)
+
+// Tag types and protocol features are settings of the connection:
+// they only affect the responses to the commands sent with Cmd,
+// not the ones of the idle and subscription loops.
+
+// TagTypes returns the tag types enabled on the connection.
+func (c *MPDClient) TagTypes() ([]string, error) {
+	return c.listValues("tagtypes", "tagtype")
+}
+
+// TagTypesAvailable returns all the tag types MPD supports,
+// enabled or not (MPD 0.24).
+func (c *MPDClient) TagTypesAvailable() ([]string, error) {
+	if err := c.require(FeatureTagTypesReset); err != nil {
+		return nil, err
+	}
+	return c.listValues("tagtypes available", "tagtype")
+}
+
+func (c *MPDClient) TagTypesDisable(tagTypes ...string) error {
+	if err := c.require(FeatureTagTypesToggle); err != nil {
+		return err
+	}
+	return c.simpleCmd(joinCommand("tagtypes disable", tagTypes))
+}
+
+func (c *MPDClient) TagTypesEnable(tagTypes ...string) error {
+	if err := c.require(FeatureTagTypesToggle); err != nil {
+		return err
+	}
+	return c.simpleCmd(joinCommand("tagtypes enable", tagTypes))
+}
+
+// TagTypesClear disables all the tag types.
+func (c *MPDClient) TagTypesClear() error {
+	if err := c.require(FeatureTagTypesToggle); err != nil {
+		return err
+	}
+	return c.simpleCmd("tagtypes clear")
+}
+
+// TagTypesAll enables all the tag types.
+func (c *MPDClient) TagTypesAll() error {
+	if err := c.require(FeatureTagTypesToggle); err != nil {
+		return err
+	}
+	return c.simpleCmd("tagtypes all")
+}
+
+// TagTypesReset enables exactly the given tag types (MPD 0.24).
+func (c *MPDClient) TagTypesReset(tagTypes ...string) error {
+	if err := c.require(FeatureTagTypesReset); err != nil {
+		return err
+	}
+	return c.simpleCmd(joinCommand("tagtypes reset", tagTypes))
+}
+
+// ProtocolFeatures returns the protocol features enabled
+// on the connection (MPD 0.24).
+func (c *MPDClient) ProtocolFeatures() ([]string, error) {
+	if err := c.require(FeatureProtocol); err != nil {
+		return nil, err
+	}
+	return c.listValues("protocol", "feature")
+}
+
+// ProtocolAvailable returns all the protocol features MPD supports.
+func (c *MPDClient) ProtocolAvailable() ([]string, error) {
+	if err := c.require(FeatureProtocol); err != nil {
+		return nil, err
+	}
+	return c.listValues("protocol available", "feature")
+}
+
+func (c *MPDClient) ProtocolEnable(features ...string) error {
+	if err := c.require(FeatureProtocol); err != nil {
+		return err
+	}
+	return c.simpleCmd(joinCommand("protocol enable", features))
+}
+
+func (c *MPDClient) ProtocolDisable(features ...string) error {
+	if err := c.require(FeatureProtocol); err != nil {
+		return err
+	}
+	return c.simpleCmd(joinCommand("protocol disable", features))
+}
+
+// ProtocolClear disables all the protocol features.
+func (c *MPDClient) ProtocolClear() error {
+	if err := c.require(FeatureProtocol); err != nil {
+		return err
+	}
+	return c.simpleCmd("protocol clear")
+}
+
+// ProtocolAll enables all the protocol features.
+func (c *MPDClient) ProtocolAll() error {
+	if err := c.require(FeatureProtocol); err != nil {
+		return err
+	}
+	return c.simpleCmd("protocol all")
+}
+
+// joinCommand appends the quoted args to cmd.
+func joinCommand(cmd string, args []string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, cmd)
+	for _, arg := range args {
+		quoted = append(quoted, quoteArg(arg))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,87 @@
+/* Copyright (C) 2013 Vincent Petithory <vincent.petithory@gmail.com>
+ *
+ * This file is part of mpdclient.
+ *
+ * mpdclient is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * mpdclient is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with mpdclient.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mpdclient
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"strings"
+)
+
+// redacted replaces the passwords in logs.
+const redacted = "***"
+
+// maxTraceLineLength bounds the length of the traced lines,
+// binary responses being split arbitrarily.
+const maxTraceLineLength = 512
+
+// traceConn logs every protocol line read and written on a connection.
+type traceConn struct {
+	net.Conn
+	logger *slog.Logger
+	name   string
+	rbuf   []byte
+	wbuf   []byte
+}
+
+func (c *traceConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.rbuf = c.trace("recv", append(c.rbuf, b[:n]...))
+	}
+	return n, err
+}
+
+func (c *traceConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.wbuf = c.trace("send", append(c.wbuf, b[:n]...))
+	}
+	return n, err
+}
+
+// trace logs the complete lines of buf and returns what remains.
+func (c *traceConn) trace(direction string, buf []byte) []byte {
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i == -1 {
+			break
+		}
+		c.log(direction, buf[:i])
+		buf = buf[i+1:]
+	}
+	if len(buf) > maxTraceLineLength {
+		c.log(direction, buf)
+		return nil
+	}
+	return append([]byte(nil), buf...)
+}
+
+func (c *traceConn) log(direction string, b []byte) {
+	line := strings.TrimSuffix(string(b), "\r")
+	if strings.HasPrefix(line, "password ") {
+		line = "password " + redacted
+	}
+	if len(line) > maxTraceLineLength {
+		line = line[:maxTraceLineLength] + "..."
+	}
+	c.logger.Debug("wire", "conn", c.name, "direction", direction, "line", line)
+}